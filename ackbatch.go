@@ -0,0 +1,204 @@
+package amqphelper
+
+import (
+	"sort"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//ackBatcher holds back the acknowledgments of Configuration.AckBatchSize and AckBatchInterval, sending a single multiple acknowledgment for the run of messages after the last one flushed that are all settled. Delivery tags on a channel are consecutive, so the run stops at the first message still being handled or not yet tracked, possibly delivered to another consumer of the channel, and a message is never acknowledged before its handler did it. The acknowledgments held past the run are sent one at a time, so a tag that is never tracked doesn't hold them back
+type ackBatcher struct {
+	mu    sync.Mutex
+	acker amqp.Acknowledger
+	//tags is sorted by delivery tag, consumers of a channel track their deliveries at their own pace
+	tags []ackEntry
+	//flushed is the last tag of the runs flushed so far
+	flushed uint64
+	pending int
+	armed   bool
+}
+
+type ackState int
+
+const (
+	//ackUnsettled messages are being handled
+	ackUnsettled ackState = iota
+	//ackHeld messages were acknowledged by their handler, the acknowledgment is held back
+	ackHeld
+	//ackSettled messages were nacked, rejected or auto acknowledged, there is nothing to send for them
+	ackSettled
+)
+
+//ackEntry is a delivered message and how far it is settled
+type ackEntry struct {
+	tag   uint64
+	state ackState
+}
+
+func (q *Queue) batchingAcks() bool {
+	cfg := q.config()
+	return !cfg.AutoAcknowledgeMessages && (cfg.AckBatchSize > 0 || cfg.AckBatchInterval > 0)
+}
+
+//reset forgets the messages of the previous channel, their acknowledgments are lost with it and the broker redelivers them. Tags start again from 1 on the new channel
+func (b *ackBatcher) reset(acker amqp.Acknowledger) {
+	b.mu.Lock()
+	b.acker, b.tags, b.flushed, b.pending = acker, nil, 0, 0
+	b.mu.Unlock()
+}
+
+//delivered tracks d in tag order
+func (b *ackBatcher) delivered(d *amqp.Delivery, state ackState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d.Acknowledger != b.acker || d.DeliveryTag <= b.flushed {
+		return
+	}
+	i := sort.Search(len(b.tags), func(i int) bool { return b.tags[i].tag >= d.DeliveryTag })
+	if i < len(b.tags) && b.tags[i].tag == d.DeliveryTag {
+		return
+	}
+	b.tags = append(b.tags, ackEntry{})
+	copy(b.tags[i+1:], b.tags[i:])
+	b.tags[i] = ackEntry{tag: d.DeliveryTag, state: state}
+}
+
+//find returns the index of tag, or -1 when it isn't tracked
+func (b *ackBatcher) find(tag uint64) int {
+	i := sort.Search(len(b.tags), func(i int) bool { return b.tags[i].tag >= tag })
+	if i < len(b.tags) && b.tags[i].tag == tag {
+		return i
+	}
+	return -1
+}
+
+//batchAck holds back the acknowledgment of d, reporting false when d isn't tracked and must be acknowledged directly
+func (q *Queue) batchAck(d *amqp.Delivery) (bool, error) {
+	b := &q.acks
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := -1
+	if d.Acknowledger == b.acker {
+		i = b.find(d.DeliveryTag)
+	}
+	if i < 0 || b.tags[i].state != ackUnsettled {
+		return false, nil
+	}
+	b.tags[i].state = ackHeld
+	b.pending++
+	return true, q.flushIfDueLocked()
+}
+
+//settleAck marks d, which is being nacked or rejected, as settled, and with multiple forgets every message up to it, the broker settles them all
+func (q *Queue) settleAck(d *amqp.Delivery, multiple bool) {
+	b := &q.acks
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d.Acknowledger != b.acker {
+		return
+	}
+	if multiple {
+		n := sort.Search(len(b.tags), func(i int) bool { return b.tags[i].tag > d.DeliveryTag })
+		for _, e := range b.tags[:n] {
+			if e.state == ackHeld {
+				b.pending--
+			}
+		}
+		b.tags = b.tags[n:]
+		if d.DeliveryTag > b.flushed {
+			b.flushed = d.DeliveryTag
+		}
+	} else if i := b.find(d.DeliveryTag); i >= 0 {
+		if b.tags[i].state == ackHeld {
+			b.pending--
+		}
+		b.tags[i].state = ackSettled
+	}
+	//settling the head of the run may let the acknowledgments held behind it go
+	if err := q.flushIfDueLocked(); err != nil {
+		q.reportError(ErrorScopeConsume, err)
+	}
+}
+
+//flushIfDueLocked flushes once AckBatchSize acknowledgments are held and arms the AckBatchInterval timer while any is, it must be called with the lock held
+func (q *Queue) flushIfDueLocked() error {
+	b := &q.acks
+	var err error
+	if size := q.config().AckBatchSize; size > 0 && b.pending >= size {
+		err = b.flushLocked()
+	}
+	q.armAckTimerLocked()
+	return err
+}
+
+//armAckTimerLocked makes sure a flush is coming when acknowledgments are held, including those a flush left behind an unsettled message
+func (q *Queue) armAckTimerLocked() {
+	b := &q.acks
+	interval := q.config().AckBatchInterval
+	if interval <= 0 || b.pending == 0 || b.armed {
+		return
+	}
+	b.armed = true
+	after := q.Clock().After(interval)
+	go func() {
+		<-after
+		if err := q.flushAcks(); err != nil {
+			q.reportError(ErrorScopeConsume, err)
+		}
+	}()
+}
+
+//flushAcks sends the acknowledgments held back that can be, the others wait for the messages before them to be settled
+func (q *Queue) flushAcks() error {
+	b := &q.acks
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.armed = false
+	err := b.flushLocked()
+	q.armAckTimerLocked()
+	return err
+}
+
+//flushLocked acknowledges the settled run starting right after the last flushed tag, up to its last held acknowledgment, then the acknowledgments held past it one by one. Settled messages contiguous with the run are kept so a later run can go past them, those after a tag that isn't tracked are forgotten
+func (b *ackBatcher) flushLocked() error {
+	next := b.flushed + 1
+	var tag uint64
+	n := 0
+	for ; n < len(b.tags) && b.tags[n].tag == next && b.tags[n].state != ackUnsettled; n++ {
+		if b.tags[n].state == ackHeld {
+			tag = next
+			b.pending--
+		}
+		next++
+	}
+	b.tags = b.tags[n:]
+	b.flushed = next - 1
+	var err error
+	if tag != 0 {
+		err = wrapError(b.acker.Ack(tag, true))
+	}
+	if b.pending == 0 {
+		return err
+	}
+
+	kept := b.tags[:0]
+	prev, gap := b.flushed, false
+	for _, e := range b.tags {
+		gap = gap || e.tag != prev+1
+		prev = e.tag
+		if e.state == ackHeld {
+			//once the channel failed the remaining acknowledgments are lost with it
+			if err == nil {
+				err = wrapError(b.acker.Ack(e.tag, false))
+			}
+			e.state = ackSettled
+			b.pending--
+		}
+		if !gap || e.state == ackUnsettled {
+			kept = append(kept, e)
+		}
+	}
+	b.tags = kept
+	return err
+}
@@ -0,0 +1,98 @@
+package amqphelper
+
+import (
+	"reflect"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type ackCall struct {
+	tag      uint64
+	multiple bool
+}
+
+//recordingAcker records the acknowledgments sent to the channel
+type recordingAcker struct {
+	acks []ackCall
+}
+
+func (r *recordingAcker) Ack(tag uint64, multiple bool) error {
+	r.acks = append(r.acks, ackCall{tag, multiple})
+	return nil
+}
+
+func (r *recordingAcker) Nack(tag uint64, multiple, requeue bool) error { return nil }
+func (r *recordingAcker) Reject(tag uint64, requeue bool) error         { return nil }
+
+//ackStep tracks a delivery, has its handler ack or nack it, or flushes as the AckBatchInterval timer does
+type ackStep struct {
+	op  string
+	tag uint64
+}
+
+func steps(op string, tags ...uint64) []ackStep {
+	s := make([]ackStep, len(tags))
+	for i, tag := range tags {
+		s[i] = ackStep{op, tag}
+	}
+	return s
+}
+
+func join(s ...[]ackStep) []ackStep {
+	var out []ackStep
+	for _, e := range s {
+		out = append(out, e...)
+	}
+	return out
+}
+
+//TestAckBatching acknowledges with a batch size of 3. tracked is how many deliveries the batcher still holds afterwards
+func TestAckBatching(t *testing.T) {
+	flush := []ackStep{{"flush", 0}}
+	for _, c := range []struct {
+		name    string
+		steps   []ackStep
+		want    []ackCall
+		tracked int
+	}{
+		{"contiguous", join(steps("track", 1, 2, 3), steps("ack", 1, 2, 3)), []ackCall{{3, true}}, 0},
+		{"under the batch size", join(steps("track", 1, 2), steps("ack", 1, 2)), nil, 2},
+		{"flushed by the timer", join(steps("track", 1, 2), steps("ack", 1, 2), flush), []ackCall{{2, true}}, 0},
+		{"nacked in the run", join(steps("track", 1, 2, 3), steps("nack", 2), steps("ack", 1, 3), flush), []ackCall{{3, true}}, 0},
+		{"untracked tag", join(steps("track", 1, 2, 4, 5), steps("ack", 1, 2, 4)), []ackCall{{2, true}, {4, false}}, 1},
+		{"untracked tag on the timer", join(steps("track", 1, 3), steps("ack", 3), flush), []ackCall{{3, false}}, 1},
+		{"untracked tag tracked late", join(steps("track", 1, 3), steps("ack", 3), flush, steps("track", 2), steps("ack", 1, 2), flush), []ackCall{{3, false}, {2, true}}, 0},
+		{"unsettled head", join(steps("track", 1, 2, 3, 4), steps("ack", 2, 3, 4)), []ackCall{{2, false}, {3, false}, {4, false}}, 4},
+		{"unsettled head acked", join(steps("track", 1, 2, 3, 4), steps("ack", 2, 3, 4, 1), flush, steps("track", 5, 6, 7), steps("ack", 5, 6, 7)), []ackCall{{2, false}, {3, false}, {4, false}, {1, true}, {7, true}}, 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			q := newQueue(&Configuration{AckBatchSize: 3})
+			acker := &recordingAcker{}
+			q.acks.reset(acker)
+			for _, s := range c.steps {
+				d := &amqp.Delivery{Acknowledger: acker, DeliveryTag: s.tag}
+				switch s.op {
+				case "track":
+					q.track(d)
+				case "ack":
+					if held, err := q.batchAck(d); !held || err != nil {
+						t.Fatalf("ack of %d held %v, %v", s.tag, held, err)
+					}
+				case "nack":
+					q.settleAck(d, false)
+				case "flush":
+					if err := q.flushAcks(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if !reflect.DeepEqual(acker.acks, c.want) {
+				t.Errorf("acknowledged %v, want %v", acker.acks, c.want)
+			}
+			if len(q.acks.tags) != c.tracked {
+				t.Errorf("%d deliveries tracked, want %d", len(q.acks.tags), c.tracked)
+			}
+		})
+	}
+}
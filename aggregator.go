@@ -0,0 +1,161 @@
+package amqphelper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//AggregatedMessage is a message held by an Aggregator until its group completes
+type AggregatedMessage struct {
+	MessageID   string
+	ContentType string
+	Headers     amqp.Table
+	Body        []byte
+	Received    time.Time
+}
+
+//AggregateStore keeps the groups of an Aggregator, implementations must be safe for concurrent use. Back it with a database for groups to survive restarts
+type AggregateStore interface {
+	//Append adds m to the group key and returns the group's size
+	Append(key string, m AggregatedMessage) (int, error)
+	//Take removes the group key and returns its messages, nil if it doesn't exist
+	Take(key string) ([]AggregatedMessage, error)
+	//Expired returns the keys of groups whose first message was received before t
+	Expired(t time.Time) ([]string, error)
+}
+
+//MemoryAggregateStore keeps groups in memory, they are lost when the process exits
+type MemoryAggregateStore struct {
+	mu     sync.Mutex
+	groups map[string][]AggregatedMessage
+}
+
+//NewMemoryAggregateStore returns an empty MemoryAggregateStore
+func NewMemoryAggregateStore() *MemoryAggregateStore {
+	return &MemoryAggregateStore{groups: map[string][]AggregatedMessage{}}
+}
+
+//Append adds m to the group key
+func (s *MemoryAggregateStore) Append(key string, m AggregatedMessage) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups[key] = append(s.groups[key], m)
+	return len(s.groups[key]), nil
+}
+
+//Take removes the group key
+func (s *MemoryAggregateStore) Take(key string) ([]AggregatedMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.groups[key]
+	delete(s.groups, key)
+	return g, nil
+}
+
+//Expired returns the keys of groups started before t
+func (s *MemoryAggregateStore) Expired(t time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k, g := range s.groups {
+		if len(g) > 0 && g[0].Received.Before(t) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+//Aggregator collects messages sharing a key into groups, handing a group to Handle once it holds Count messages or Timeout passed since its first one
+type Aggregator struct {
+	//Key returns the group of a message, its CorrelationId when nil
+	Key     func(m *Message) string
+	Count   int
+	Timeout time.Duration
+	//Store defaults to a MemoryAggregateStore
+	Store AggregateStore
+	//Handle receives completed groups, a group it fails on is stored again and retried by Run once it timed out
+	Handle func(key string, group []AggregatedMessage) error
+
+	once sync.Once
+}
+
+func (a *Aggregator) store() AggregateStore {
+	a.once.Do(func() {
+		if a.Store == nil {
+			a.Store = NewMemoryAggregateStore()
+		}
+	})
+	return a.Store
+}
+
+func (a *Aggregator) key(m *Message) string {
+	if a.Key != nil {
+		return a.Key(m)
+	}
+	return m.CorrelationID()
+}
+
+//Consume adds the message to its group and acks it once stored, completing the group when it is full. It can be passed directly to SpawnWorkers, messages are requeued when the store fails
+func (a *Aggregator) Consume(m *Message) {
+	cfg := m.queue.config()
+	key := a.key(m)
+	n, err := a.store().Append(key, AggregatedMessage{MessageID: m.MessageID(), ContentType: m.ContentType, Headers: m.HeaderTable(), Body: m.Body, Received: m.queue.Clock().Now()})
+	if err != nil {
+		m.logger().Error("Could not store aggregated message", m.fields(F("group", key), F("error", err))...)
+		if m.queue == nil || !cfg.AutoAcknowledgeMessages {
+			m.Nack(false, true)
+		}
+		return
+	}
+	if m.queue == nil || !cfg.AutoAcknowledgeMessages {
+		m.Ack(false)
+	}
+	if a.Count > 0 && n >= a.Count {
+		a.complete(m.queue, key)
+	}
+}
+
+func (a *Aggregator) complete(q *Queue, key string) {
+	s := a.store()
+	group, err := s.Take(key)
+	if err != nil {
+		q.logger().Error("Could not take aggregated group", F("group", key), F("error", err))
+		return
+	}
+	if len(group) == 0 {
+		return
+	}
+	if err = a.Handle(key, group); err != nil {
+		q.logger().Warn("Aggregated group handler failed", F("group", key), F("error", err))
+		q.reportError(ErrorScopeConsume, err)
+		for _, m := range group {
+			s.Append(key, m)
+		}
+	}
+}
+
+//Run spawns a goroutine completing groups that timed out, checking every interval until ctx is done. q is only used for logging and may be nil
+func (a *Aggregator) Run(ctx context.Context, q *Queue, interval time.Duration) {
+	go func() {
+		t := q.Clock().NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C():
+			}
+			keys, err := a.store().Expired(q.Clock().Now().Add(-a.Timeout))
+			if err != nil {
+				q.logger().Error("Could not list expired aggregated groups", F("error", err))
+				continue
+			}
+			for _, k := range keys {
+				a.complete(q, k)
+			}
+		}
+	}()
+}
@@ -0,0 +1,274 @@
+//Package amqp10 is an amqphelper backend speaking AMQP 1.0, for brokers such as Azure Service Bus, ActiveMQ Artemis or Qpid. Import it and set Configuration.Backend to Backend to get one from amqphelper.Open. It is a module of its own, so only its importers depend on go-amqp
+package amqp10
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/ermyuriel/amqphelper"
+)
+
+//Backend is the Configuration.Backend value selecting this package
+const Backend = "amqp10"
+
+const (
+	//TypeProperty carries Publishing.Type, which AMQP 1.0 has no property for
+	TypeProperty = "x-type"
+	//AppIDProperty carries Publishing.AppId
+	AppIDProperty = "x-app-id"
+)
+
+func init() {
+	amqphelper.RegisterBackend(Backend, func(ctx context.Context, config *amqphelper.Configuration) (amqphelper.QueueClient, error) {
+		c, err := Dial(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+//Client publishes and consumes over a single AMQP 1.0 session. Configuration.RoutingKey is the address consumed from and published to, a non empty exchange is used as the address instead with the routing key as the message subject. Exchanges, bindings and queue arguments are not declared, the addresses must exist on the broker
+type Client struct {
+	config  *amqphelper.Configuration
+	conn    *amqp.Conn
+	session *amqp.Session
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	senders map[string]*amqp.Sender
+	tag     uint64
+}
+
+var _ amqphelper.QueueClient = (*Client)(nil)
+
+//Dial connects to config.Host, credentials in the URI are sent as SASL PLAIN and Configuration.TLSConfig is used for amqps hosts. Configuration.Heartbeat becomes the idle timeout
+func Dial(ctx context.Context, config *amqphelper.Configuration) (*Client, error) {
+	conn, err := amqp.Dial(ctx, config.Host, &amqp.ConnOptions{TLSConfig: config.TLSConfig, IdleTimeout: config.Heartbeat})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", amqphelper.ErrNotConnected, amqphelper.RedactError(err, config.Host))
+	}
+	session, err := conn.NewSession(ctx, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := &Client{config: config, conn: conn, session: session, senders: map[string]*amqp.Sender{}}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+//Name returns the consumed address
+func (c *Client) Name() string {
+	return c.config.RoutingKey
+}
+
+//Publish publishes to the configured exchange and routing key
+func (c *Client) Publish(message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
+	return c.PublishWithContext(context.Background(), message, headers, mandatory, immediate)
+}
+
+//PublishWithContext publishes to the configured exchange and routing key, giving up when ctx is done
+func (c *Client) PublishWithContext(ctx context.Context, message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
+	return c.PublishTo(ctx, c.config.Exchange, c.config.RoutingKey, amqphelper.Publishing{ContentType: c.config.ContentType, ContentEncoding: c.config.ContentEncoding, Headers: headers, Body: message}, mandatory, immediate)
+}
+
+//PublishTo sends msg to exchange, or to routingKey when exchange is empty, and waits for the broker to settle it. mandatory and immediate have no AMQP 1.0 equivalent and are ignored
+func (c *Client) PublishTo(ctx context.Context, exchange, routingKey string, msg amqphelper.Publishing, mandatory, immediate bool) error {
+	address, subject := routingKey, ""
+	if exchange != "" {
+		address, subject = exchange, routingKey
+	}
+	s, err := c.sender(ctx, address)
+	if err != nil {
+		return err
+	}
+	if msg.Timestamp.IsZero() {
+		clock := c.config.Clock
+		if clock == nil {
+			clock = amqphelper.SystemClock
+		}
+		msg.Timestamp = clock.Now()
+	}
+	return s.Send(ctx, toMessage(msg, subject), nil)
+}
+
+func (c *Client) sender(ctx context.Context, address string) (*amqp.Sender, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.senders[address]; ok {
+		return s, nil
+	}
+	s, err := c.session.NewSender(ctx, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.senders[address] = s
+	return s, nil
+}
+
+//SpawnWorkers opens n receivers on the consumed address, each granting Configuration.PrefetchCount credit, and passes every message to f. Deliveries settle like AMQP 0-9-1 ones: Ack accepts, Nack and Reject release the message when requeueing and reject it otherwise, the multiple flag only settles the message itself. With AutoAcknowledgeMessages messages are accepted before f runs
+func (c *Client) SpawnWorkers(consumerPrefix string, consumers int, f func(m *amqphelper.Message)) error {
+	credit := int32(c.config.PrefetchCount)
+	if credit < 1 {
+		credit = 1
+	}
+	for i := 0; i < consumers; i++ {
+		r, err := c.session.NewReceiver(c.ctx, c.config.RoutingKey, &amqp.ReceiverOptions{Credit: credit, Name: fmt.Sprintf("%s:%v", consumerPrefix, i)})
+		if err != nil {
+			return err
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			for {
+				msg, err := r.Receive(c.ctx, nil)
+				if err != nil {
+					return
+				}
+				d := c.fromMessage(r, msg)
+				if c.config.AutoAcknowledgeMessages {
+					r.AcceptMessage(c.ctx, msg)
+				}
+				f(&amqphelper.Message{Delivery: &d})
+			}
+		}()
+	}
+	return nil
+}
+
+//KeepRunning blocks until every receiver stopped
+func (c *Client) KeepRunning() {
+	c.wg.Wait()
+}
+
+//Close stops the receivers and closes the connection
+func (c *Client) Close() error {
+	c.cancel()
+	c.wg.Wait()
+	return c.conn.Close()
+}
+
+//acker settles a received message the way AMQP 0-9-1 deliveries are settled
+type acker struct {
+	r   *amqp.Receiver
+	msg *amqp.Message
+}
+
+func (a acker) Ack(tag uint64, multiple bool) error {
+	return a.r.AcceptMessage(context.Background(), a.msg)
+}
+
+func (a acker) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		return a.r.ReleaseMessage(context.Background(), a.msg)
+	}
+	return a.r.RejectMessage(context.Background(), a.msg, nil)
+}
+
+func (a acker) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func toMessage(p amqphelper.Publishing, subject string) *amqp.Message {
+	m := amqp.NewMessage(p.Body)
+	m.Header = &amqp.MessageHeader{Durable: p.DeliveryMode == amqphelper.Persistent, Priority: p.Priority}
+	if p.Priority == 0 {
+		m.Header.Priority = 4
+	}
+	if ms, err := strconv.ParseInt(p.Expiration, 10, 64); err == nil {
+		m.Header.TTL = time.Duration(ms) * time.Millisecond
+	}
+	m.Properties = &amqp.MessageProperties{}
+	set := func(v string) *string {
+		if v == "" {
+			return nil
+		}
+		return &v
+	}
+	if p.MessageId != "" {
+		m.Properties.MessageID = p.MessageId
+	}
+	if p.CorrelationId != "" {
+		m.Properties.CorrelationID = p.CorrelationId
+	}
+	if p.UserId != "" {
+		m.Properties.UserID = []byte(p.UserId)
+	}
+	m.Properties.Subject = set(subject)
+	m.Properties.ReplyTo = set(p.ReplyTo)
+	m.Properties.ContentType = set(p.ContentType)
+	m.Properties.ContentEncoding = set(p.ContentEncoding)
+	if !p.Timestamp.IsZero() {
+		t := p.Timestamp
+		m.Properties.CreationTime = &t
+	}
+	m.ApplicationProperties = map[string]any{}
+	for k, v := range p.Headers {
+		m.ApplicationProperties[k] = v
+	}
+	if p.Type != "" {
+		m.ApplicationProperties[TypeProperty] = p.Type
+	}
+	if p.AppId != "" {
+		m.ApplicationProperties[AppIDProperty] = p.AppId
+	}
+	return m
+}
+
+func (c *Client) fromMessage(r *amqp.Receiver, m *amqp.Message) amqphelper.Delivery {
+	c.mu.Lock()
+	c.tag++
+	tag := c.tag
+	c.mu.Unlock()
+	d := amqphelper.Delivery{Acknowledger: acker{r, m}, DeliveryTag: tag, Body: m.GetData(), RoutingKey: r.Address(), Headers: amqphelper.Table{}}
+	for k, v := range m.ApplicationProperties {
+		switch k {
+		case TypeProperty:
+			d.Type, _ = v.(string)
+		case AppIDProperty:
+			d.AppId, _ = v.(string)
+		default:
+			d.Headers[k] = v
+		}
+	}
+	if h := m.Header; h != nil {
+		d.Redelivered = h.DeliveryCount > 0
+		d.Priority = h.Priority
+		if h.Durable {
+			d.DeliveryMode = amqphelper.Persistent
+		}
+	}
+	if p := m.Properties; p != nil {
+		if p.MessageID != nil {
+			d.MessageId = fmt.Sprint(p.MessageID)
+		}
+		if p.CorrelationID != nil {
+			d.CorrelationId = fmt.Sprint(p.CorrelationID)
+		}
+		d.UserId = string(p.UserID)
+		get := func(v *string) string {
+			if v == nil {
+				return ""
+			}
+			return *v
+		}
+		if s := get(p.Subject); s != "" {
+			d.RoutingKey = s
+		}
+		d.ReplyTo = get(p.ReplyTo)
+		d.ContentType = get(p.ContentType)
+		d.ContentEncoding = get(p.ContentEncoding)
+		if p.CreationTime != nil {
+			d.Timestamp = *p.CreationTime
+		}
+	}
+	return d
+}
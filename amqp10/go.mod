@@ -0,0 +1,19 @@
+module github.com/ermyuriel/amqphelper/amqp10
+
+go 1.23
+
+require (
+	github.com/Azure/go-amqp v1.3.0
+	github.com/ermyuriel/amqphelper v0.0.0
+)
+
+require (
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/rabbitmq/amqp091-go v1.10.0 // indirect
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	google.golang.org/protobuf v1.36.12 // indirect
+)
+
+replace github.com/ermyuriel/amqphelper => ../
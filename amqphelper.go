@@ -1,12 +1,16 @@
 package amqphelper
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/streadway/amqp"
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 //Configuration is a configuration object of AMQP standard parameters
@@ -24,173 +28,652 @@ type Configuration struct {
 	NoLocal                 bool
 	PrefetchCount           int
 	PrefetchByteSize        int
-	arguments               amqp.Table
+	Codec                   Codec
+	KeyProvider             KeyProvider
+	Signer                  Signer
+	AppID                   string
+	AutoStampMessages       bool
+	CopyBodies              bool
+	ConfirmPublishes        bool
+	Metrics                 Metrics
+	Logger                  Logger
+	HealthCheckDeclare      bool
+	EventJournalSize        int
+	MessageIDGenerator      MessageIDGenerator
+	Debug                   bool
+	DebugRateLimit          int
+	TrackHandlerLatency     bool
+	//MaxLatencyKeys caps the routing key and message type pairs TrackHandlerLatency keeps a histogram of, DefaultMaxLatencyKeys when it is 0
+	MaxLatencyKeys       int
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	DeadLetterQueue      string
+	DeadLetterRateLimit  float64
+	DeadLetterRateWindow time.Duration
+	Auditor              func(r AuditRecord)
+	SlowHandlerThreshold time.Duration
+	SlowConsumerWindow   time.Duration
+	//With ExchangeType set the exchange is declared durable with that type on connection, with PublishOnly no queue is declared or bound and with BindingKeys the queue is bound with each of them instead of RoutingKey
+	ExchangeType string
+	PublishOnly  bool
+	BindingKeys  []string
+	//PersistentMessages marks publishes without a delivery mode as persistent
+	PersistentMessages bool
+	//With a BlobStore bodies over ClaimCheckThreshold bytes are stored there and published by reference
+	BlobStore           BlobStore
+	ClaimCheckThreshold int
+	//Clock replaces the system clock for every time dependent feature and TLSConfig is used to dial amqps hosts, negotiating Heartbeat or DefaultHeartbeat when it is 0
+	Clock     Clock
+	TLSConfig *tls.Config
+	Heartbeat time.Duration
+	//ConfirmTimeout bounds the wait for publish confirmations, 0 waits as long as the channel is open
+	ConfirmTimeout time.Duration
+	//Backend selects the implementation Open returns
+	Backend string
+	//Strict makes connecting fail on any problem Validate finds, including settings that would be ignored
+	Strict bool
+	//AsyncPublishBuffer sizes the buffer of AsyncPublish, DefaultAsyncPublishBuffer when it is 0
+	AsyncPublishBuffer int
+	//PublisherChannels opens that many extra channels publishes are spread over, so concurrent publishers don't wait for each other's confirmations on a single channel
+	PublisherChannels int
+	//AckBatchSize and AckBatchInterval batch acknowledgments into one multiple acknowledgment every that many acks or that often, whichever comes first, bounding what is redelivered after a crash. The acknowledgments held behind a message left unsettled are sent one at a time
+	AckBatchSize     int
+	AckBatchInterval time.Duration
+	//MaxConcurrentHandlers caps the handlers running at once over all the consumers of SpawnWorkers, which then handle deliveries concurrently instead of one at a time each. A cap changed by UpdateConfig applies to the running consumers from the next connection
+	MaxConcurrentHandlers int
+	//ReuseMessages recycles the Message and Delivery of SpawnWorkers handlers once they return, so handlers must not retain either, nor hand them to helpers that settle messages later like Aggregator
+	ReuseMessages bool
+	//DeliveryBuffer bounds the deliveries a consumer of SpawnWorkers reads ahead of its handlers, applying the Backpressure policy once it is full
+	DeliveryBuffer int
+	Backpressure   BackpressurePolicy
+	//AsyncBatchWindow delays each batch of AsyncPublish up to that long to gather more messages, trading latency for fewer, larger batches of confirmations. It is off when 0
+	AsyncBatchWindow time.Duration
+	//MaxDecodedSize caps the bytes a ContentEncoding compressed body is decompressed to, DefaultMaxDecodedSize when it is 0 and unlimited when negative
+	MaxDecodedSize int
+	arguments      amqp.Table
 }
 
-//Queue is the object defined by the Configuration object
+//DefaultHeartbeat is the heartbeat interval negotiated when Configuration.Heartbeat is 0
+const DefaultHeartbeat = 10 * time.Second
+
+//Queue is the object defined by the Configuration object, publishing and consuming on a connection of its own. Connection opens its publishing and consuming halves, QueuePublisher and QueueConsumer, on one shared connection instead
 type Queue struct {
 	wg            *sync.WaitGroup
 	Connected     bool
 	connection    *amqp.Connection
 	channel       *amqp.Channel
 	internalQueue *amqp.Queue
-	Config        *Configuration
-	workers       *int
+	//Config is the Configuration the queue was created with
+	//
+	//Deprecated: it isn't updated by UpdateConfig and writing it races with the queue, use Configuration
+	Config                *Configuration
+	current               atomic.Pointer[Configuration]
+	workers               *int32
+	middleware            []Middleware
+	publishMiddleware     []PublishMiddleware
+	codecs                codecRegistry
+	publishMu             sync.Mutex
+	confirms              chan amqp.Confirmation
+	journal               journal
+	reconnects            int64
+	debugLimiter          debugLimiter
+	latencies             sync.Map
+	latencyKeys           atomic.Int64
+	deadLetters           rateCounter
+	onDeadLetterThreshold func(rate float64)
+	errorCallbacks        errorCallbacks
+	slowDetector          slowDetector
+	stats                 queueStats
+	brokerLatency         int64
+	configMu              sync.Mutex
+	pendingConfig         *Configuration
+	shared                *Connection
+	lifecycle             lifecycle
+	publishSeq            uint64
+	async                 asyncPublisher
+	pool                  *channelPool
+	acks                  ackBatcher
+	handlerSlots          handlerSlots
 }
 
-//Message represents an element to be consumed from the queue
+//Message represents an element to be consumed from the queue. The delivery's fields are promoted as they are, the accessor methods are nil safe and named so they don't shadow them
 type Message struct {
 	*amqp.Delivery
+	queue  *Queue
+	ctx    context.Context
+	pooled *pooledMessage
 }
 
 //GetQueue receives Config object and returns a queue for publishing and consuming
 func GetQueue(config *Configuration) (*Queue, error) {
+	return GetQueueContext(context.Background(), config)
+}
+
+//GetQueueContext is GetQueue giving up on dialing and declaring when ctx is done
+func GetQueueContext(ctx context.Context, config *Configuration) (*Queue, error) {
+	if config.Strict {
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	q := newQueue(config)
+
+	err := q.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func newQueue(config *Configuration) *Queue {
 	var wg sync.WaitGroup
-	var wk int
+	var wk int32
+
+	q := &Queue{wg: &wg, workers: &wk, Config: config}
+	q.current.Store(config)
+	return q
+}
 
-	q := Queue{&wg, false, nil, nil, nil, nil, &wk}
+//Configuration returns the Configuration in effect, the one passed to UpdateConfig once it was applied. It must not be modified, pass a changed copy to UpdateConfig instead
+func (q *Queue) Configuration() *Configuration {
+	return q.config()
+}
+
+//config is read once per operation, UpdateConfig swaps it atomically so each operation sees a single Configuration
+func (q *Queue) config() *Configuration {
+	if q == nil {
+		return nil
+	}
+	return q.current.Load()
+}
+
+//handshakeTimeout bounds the TLS and AMQP handshakes when ctx has no deadline, like amqp.Dial does
+const handshakeTimeout = 30 * time.Second
+
+//dial opens a connection with the connection settings of config, returning ctx's error as soon as it is done. A connection completing after that is closed. Errors have the host's password redacted
+func dial(ctx context.Context, config *Configuration) (*amqp.Connection, error) {
+	heartbeat := config.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	netDial := func(network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(handshakeTimeout)
+		}
+		//the deadline is cleared by the amqp library once the handshake completed
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
 
-	q.Config = config
+	type result struct {
+		conn *amqp.Connection
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := amqp.DialConfig(config.Host, amqp.Config{Heartbeat: heartbeat, Locale: "en_US", TLSClientConfig: config.TLSConfig, Dial: netDial})
+		done <- result{conn, err}
+	}()
+	select {
+	case r := <-done:
+		return r.conn, RedactError(r.err, config.Host)
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
 
-	conn, err := amqp.Dial(config.Host)
+//connect dials, or reuses the shared Connection, and declares the topology on a new channel. Dial failures wrap ErrNotConnected and broker errors are wrapped by wrapError
+func (q *Queue) connect(ctx context.Context) error {
+	q.applyPendingConfig()
+	var conn *amqp.Connection
+	var err error
+	if q.shared != nil {
+		conn, err = q.shared.get(ctx)
+	} else {
+		conn, err = dial(ctx, q.config())
+	}
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("%w: %w", ErrNotConnected, err)
 	}
+	return wrapError(q.declare(conn))
+}
+
+func (q *Queue) declare(conn *amqp.Connection) error {
+	cfg := q.config()
+	var err error
 
 	q.connection = conn
 	q.Connected = true
+	q.metrics().ConnectionState(true)
+	q.logger().Info("Connected", F("queue", cfg.RoutingKey), F("host", cfg.SafeURI()))
 	ch, err := q.connection.Channel()
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	q.channel = ch
-	q.channel.Qos(config.PrefetchCount, config.PrefetchByteSize, true)
+	q.acks.reset(ch)
+	q.watch(conn, ch)
+	q.record(Event{Type: EventConnected})
+	q.stats.connected(q.Clock().Now())
+	q.channel.Qos(cfg.PrefetchCount, cfg.PrefetchByteSize, true)
+	q.stats.prefetch.Store(int64(cfg.PrefetchCount))
+
+	if cfg.ConfirmPublishes {
+		err = q.channel.Confirm(false)
+		if err != nil {
+			return err
+		}
+		q.confirms = q.channel.NotifyPublish(make(chan amqp.Confirmation, q.asyncBufferSize()))
+		q.publishSeq = 0
+	}
+	go q.handleReturns(q.channel.NotifyReturn(make(chan amqp.Return, 1)))
 
-	iq, err := q.channel.QueueDeclare(config.RoutingKey, config.Durable, config.DeleteIfUnused, config.Exclusive, config.NoWait, config.arguments)
+	if q.pool != nil {
+		q.pool.close()
+		q.pool = nil
+	}
+	if cfg.PublisherChannels > 0 {
+		q.pool, err = q.openChannelPool(conn, cfg.PublisherChannels)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.ExchangeType != "" {
+		err = q.channel.ExchangeDeclare(cfg.Exchange, cfg.ExchangeType, true, false, false, cfg.NoWait, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.PublishOnly {
+		return nil
+	}
+
+	if cfg.DeadLetterExchange != "" {
+		err = q.declareDeadLetter()
+		if err != nil {
+			return err
+		}
+	}
+
+	iq, err := q.channel.QueueDeclare(cfg.RoutingKey, cfg.Durable, cfg.DeleteIfUnused, cfg.Exclusive, cfg.NoWait, q.queueArguments())
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if config.Exchange != "" {
+	q.internalQueue = &iq
+	if cfg.Exchange != "" {
 		err = q.bind()
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	q.internalQueue = &iq
+	return nil
+}
 
-	return &q, nil
+func (q *Queue) handleReturns(returns chan amqp.Return) {
+	for r := range returns {
+		q.metrics().Returned()
+		q.logger().Warn("Message returned by the broker", F("message_id", r.MessageId), F("routing_key", r.RoutingKey), F("code", r.ReplyCode), F("reason", r.ReplyText))
+		q.reportError(ErrorScopeReturn, &ReturnError{r})
+	}
 }
 
 func (q *Queue) bind() error {
-	return q.channel.QueueBind(q.Config.RoutingKey, q.Config.RoutingKey, q.Config.Exchange, q.Config.NoWait, q.Config.arguments)
+	cfg := q.config()
+	if len(cfg.BindingKeys) == 0 {
+		return q.channel.QueueBind(q.Name(), cfg.RoutingKey, cfg.Exchange, cfg.NoWait, cfg.arguments)
+	}
+	for _, key := range cfg.BindingKeys {
+		err := q.channel.QueueBind(q.Name(), key, cfg.Exchange, cfg.NoWait, cfg.arguments)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 //Publish publishes a message to the queue, receives mandatory and immediate flags for the message
 func (q *Queue) Publish(message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
-	var err error
+	cfg := q.config()
+	return q.publish(context.Background(), amqp.Publishing{ContentType: cfg.ContentType, ContentEncoding: cfg.ContentEncoding, Body: message, Headers: headers}, mandatory, immediate)
+}
+
+//PublishWithContext publishes like Publish and injects the W3C trace context carried by ctx into the message headers
+func (q *Queue) PublishWithContext(ctx context.Context, message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
+	cfg := q.config()
+	return q.publish(ctx, amqp.Publishing{ContentType: cfg.ContentType, ContentEncoding: cfg.ContentEncoding, Body: message, Headers: headers}, mandatory, immediate)
+}
+
+//PublishTo publishes msg as is to the exchange and routing key, through the same stamping, middleware and confirmation as Publish. It is meant for replies and other messages that need their properties set or don't go to the queue's own routing key
+func (q *Queue) PublishTo(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+	return q.publishTo(ctx, exchange, routingKey, msg, mandatory, immediate)
+}
+
+func (q *Queue) publish(ctx context.Context, msg amqp.Publishing, mandatory, immediate bool) error {
+	cfg := q.config()
+	return q.publishTo(ctx, cfg.Exchange, cfg.RoutingKey, msg, mandatory, immediate)
+}
+
+//publishTo stamps the message and runs it through the publish middleware before sending it to the exchange and routing key
+func (q *Queue) publishTo(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+	return q.publishVia(ctx, nil, exchange, routingKey, &msg, mandatory, immediate)
+}
+
+//sendFunc puts a prepared message on the channel
+type sendFunc func(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error
+
+//publishVia is publishTo with deliver doing the final send of msg, which it changes in place, a nil deliver is q.send. Without publish middleware no closure is built, so it doesn't allocate of its own
+func (q *Queue) publishVia(ctx context.Context, deliver sendFunc, exchange, routingKey string, msg *amqp.Publishing, mandatory, immediate bool) error {
+	cfg := q.config()
 	if q.channel == nil {
-		return fmt.Errorf("Queue has not been initialized")
+		return ErrNotConnected
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = q.Clock().Now()
+	}
+	if cfg.PersistentMessages && msg.DeliveryMode == 0 {
+		msg.DeliveryMode = amqp.Persistent
+	}
+	if cfg.AutoStampMessages || cfg.MessageIDGenerator != nil {
+		q.stamp(msg)
 	}
-	err = q.channel.Publish(q.Config.Exchange, q.Config.RoutingKey, mandatory, immediate, amqp.Publishing{ContentType: q.Config.ContentType, ContentEncoding: q.Config.ContentEncoding, Body: []byte(message), Timestamp: time.Now(), Headers: headers})
 
-	if err != nil {
-		err = q.Recover()
-		if err != nil {
+	var err error
+	if len(q.publishMiddleware) == 0 {
+		err = q.deliverPrepared(ctx, deliver, exchange, routingKey, msg, mandatory, immediate)
+	} else {
+		send := func(ctx context.Context, exchange, routingKey string, msg *amqp.Publishing) error {
+			return q.deliverPrepared(ctx, deliver, exchange, routingKey, msg, mandatory, immediate)
+		}
+		for i := len(q.publishMiddleware) - 1; i >= 0; i-- {
+			send = q.publishMiddleware[i](send)
+		}
+		err = send(ctx, exchange, routingKey, msg)
+	}
+	q.metrics().Published(err)
+	q.reportError(ErrorScopePublish, err)
+	if cfg.Auditor != nil {
+		q.audit(exchange, routingKey, msg, err)
+	}
+	if cfg.Debug {
+		q.debug("Published", F("exchange", exchange), F("routing_key", routingKey), F("size", len(msg.Body)), F("content_type", msg.ContentType), F("content_encoding", msg.ContentEncoding), F("message_id", msg.MessageId), F("correlation_id", msg.CorrelationId), F("reply_to", msg.ReplyTo), F("type", msg.Type), F("delivery_mode", msg.DeliveryMode), F("priority", msg.Priority), F("headers", len(msg.Headers)), F("mandatory", mandatory), F("immediate", immediate), F("error", err))
+	}
+	return err
+}
+
+//deliverPrepared encrypts, signs and checks in msg then sends it with deliver, recovering and retrying once when that fails, or on the transaction's channel inside PublishAll
+func (q *Queue) deliverPrepared(ctx context.Context, deliver sendFunc, exchange, routingKey string, msg *amqp.Publishing, mandatory, immediate bool) error {
+	cfg := q.config()
+	if deliver == nil {
+		deliver = q.send
+	}
+	var err error
+	injectTraceContext(ctx, msg)
+	if cfg.KeyProvider != nil && msg.Headers[EncryptionHeader] == nil {
+		if err = q.encrypt(msg); err != nil {
 			return err
 		}
-		err = q.channel.Publish(q.Config.Exchange, q.Config.RoutingKey, mandatory, immediate, amqp.Publishing{ContentType: q.Config.ContentType, ContentEncoding: q.Config.ContentEncoding, Body: []byte(message), Timestamp: time.Now(), Headers: headers})
 	}
+	if cfg.Signer != nil {
+		if err = sign(cfg.Signer, msg); err != nil {
+			return err
+		}
+	}
+	if cfg.BlobStore != nil {
+		if err = q.checkIn(ctx, msg); err != nil {
+			return err
+		}
+	}
+	if tx, ok := ctx.Value(txChannelKey{}).(*amqp.Channel); ok {
+		return tx.PublishWithContext(ctx, exchange, routingKey, mandatory, immediate, *msg)
+	}
+	err = deliver(ctx, exchange, routingKey, *msg, mandatory, immediate)
 
+	if err != nil && !errors.Is(err, ErrPublishNacked) && !errors.Is(err, ErrConfirmTimeout) && ctx.Err() == nil {
+		err = q.RecoverContext(ctx)
+		if err == nil {
+			err = deliver(ctx, exchange, routingKey, *msg, mandatory, immediate)
+		}
+	}
 	return err
 }
 
+//send publishes on the current channel, or one of the pool's with PublisherChannels, in confirm mode it waits for the broker's confirmation, up to Configuration.ConfirmTimeout when it is set or until ctx is done
+func (q *Queue) send(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+	if q.pool != nil {
+		return q.pool.send(ctx, q, exchange, routingKey, msg, mandatory, immediate)
+	}
+	if !q.config().ConfirmPublishes {
+		return wrapError(q.channel.PublishWithContext(ctx, exchange, routingKey, mandatory, immediate, msg))
+	}
+
+	q.publishMu.Lock()
+	defer q.publishMu.Unlock()
+	return q.confirmedSend(ctx, q.channel, q.confirms, &q.publishSeq, exchange, routingKey, msg, mandatory, immediate)
+}
+
+//confirmedSend publishes on ch and waits for the confirmation of the next delivery tag after *seq on confirms, the caller serializes the sends on ch
+func (q *Queue) confirmedSend(ctx context.Context, ch *amqp.Channel, confirms chan amqp.Confirmation, seq *uint64, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+	cfg := q.config()
+	err := ch.PublishWithContext(ctx, exchange, routingKey, mandatory, immediate, msg)
+	if err != nil {
+		return wrapError(err)
+	}
+	*seq++
+	var timeout <-chan time.Time
+	if cfg.ConfirmTimeout > 0 {
+		timeout = q.Clock().After(cfg.ConfirmTimeout)
+	}
+	for {
+		var c amqp.Confirmation
+		var ok bool
+		select {
+		case c, ok = <-confirms:
+		case <-timeout:
+			return ErrConfirmTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !ok {
+			return fmt.Errorf("%w: %w", ErrChannelClosed, amqp.ErrClosed)
+		}
+		q.metrics().Confirmed(c.Ack)
+		q.debug("Confirm received", F("delivery_tag", c.DeliveryTag), F("ack", c.Ack))
+		//confirmations of publishes that timed out arrive late, they are counted and skipped
+		if c.DeliveryTag < *seq {
+			continue
+		}
+		if !c.Ack {
+			return ErrPublishNacked
+		}
+		return nil
+	}
+}
+
+func cloneTable(t amqp.Table) amqp.Table {
+	c := make(amqp.Table, len(t)+2)
+	for k, v := range t {
+		c[k] = v
+	}
+	return c
+}
+
+//Name returns the name the queue was declared with, the one generated by the broker when Configuration.RoutingKey is empty
+func (q *Queue) Name() string {
+	if q.internalQueue != nil {
+		return q.internalQueue.Name
+	}
+	return q.config().RoutingKey
+}
+
 // GetConsumer returns a consumer with the specified id
 func (q *Queue) GetConsumer(ConsumerID string) (<-chan amqp.Delivery, error) {
-	return q.channel.Consume(q.Config.RoutingKey, ConsumerID, q.Config.AutoAcknowledgeMessages, q.Config.Exclusive, q.Config.NoLocal, q.Config.NoWait, q.Config.arguments)
+	cfg := q.config()
+	if q.channel == nil {
+		return nil, ErrNotConnected
+	}
+	msgs, err := q.channel.Consume(q.Name(), ConsumerID, cfg.AutoAcknowledgeMessages, cfg.Exclusive, cfg.NoLocal, cfg.NoWait, cfg.arguments)
+	return msgs, wrapError(err)
+}
+
+//CancelConsumer stops the consumer with the given tag, its deliveries channel is closed once the broker confirmed
+func (q *Queue) CancelConsumer(tag string) error {
+	return q.channel.Cancel(tag, false)
 }
 
 func (q *Queue) notifyErrors() chan *amqp.Error {
 	return q.connection.NotifyClose(make(chan *amqp.Error))
 }
 
-//LogErrors spanws a goroutine that logs connection errors for the queue
+//LogErrors spanws a goroutine that logs connection errors for the queue through Configuration.Logger
 func (q *Queue) LogErrors() {
 	ech := q.notifyErrors()
 	q.wg.Add(1)
-	*q.workers++
+	atomic.AddInt32(q.workers, 1)
 	go func() {
 		for err := range ech {
-			log.Println(err)
+			q.logger().Error("Connection closed", F("code", err.Code), F("reason", err.Reason))
 			q.Connected = false
+			q.metrics().ConnectionState(false)
 		}
-		*q.workers--
+		atomic.AddInt32(q.workers, -1)
 		q.wg.Done()
 	}()
 }
 
-//SpawnWorkers initializes n consumers in n goroutines and processes each received message by passing it to the argument function. Queue.KeepRunning should be called next
+//SpawnWorkers initializes n consumers in n goroutines and processes each received message by passing it to the argument function, with Configuration.MaxConcurrentHandlers the consumers share that many concurrent handlers instead. Queue.Run should be called next
 func (q *Queue) SpawnWorkers(consumerPrefix string, consumers int, f func(m *Message)) error {
+	return q.SpawnWorkersContext(context.Background(), consumerPrefix, consumers, f)
+}
+
+//SpawnWorkersContext is SpawnWorkers with ctx as the parent of every message's context, the consumers are cancelled once ctx is done and stop after their last delivery was handled
+func (q *Queue) SpawnWorkersContext(ctx context.Context, consumerPrefix string, consumers int, f func(m *Message)) error {
+	cfg := q.config()
 	now := time.Now().UnixNano()
+	f = q.wrap(f)
 	for i := 0; i < consumers; i++ {
-		msgs, err := q.GetConsumer(fmt.Sprintf("%s:%v:%v", consumerPrefix, now, i))
+		tag := fmt.Sprintf("%s:%v:%v", consumerPrefix, now, i)
+		msgs, err := q.GetConsumer(tag)
 		if err != nil {
+			q.reportError(ErrorScopeConsume, err)
 			return err
 		}
-		*q.workers++
+		q.logger().Info("Consumer started", F("queue", cfg.RoutingKey), F("consumer", tag))
+		atomic.AddInt32(q.workers, 1)
 		q.wg.Add(1)
+		q.lifecycle.started(tag)
+		stop := context.AfterFunc(ctx, func() { q.CancelConsumer(tag) })
 		go func() {
-			for msg := range msgs {
-				f(&Message{&msg})
+			defer stop()
+			q.consume(ctx, tag, msgs, f)
+			if q.batchingAcks() {
+				q.flushAcks()
 			}
-			*q.workers--
+			q.logger().Info("Consumer stopped", F("queue", cfg.RoutingKey), F("consumer", tag))
+			atomic.AddInt32(q.workers, -1)
+			q.lifecycle.stopped(tag)
 			q.wg.Done()
 		}()
 	}
 	return nil
 }
 
-//KeepRunning keeps queue processes running
+//Close closes the queue's connection, which stops its consumers. Queues opened on a shared Connection only close their channel
+func (q *Queue) Close() error {
+	if q.pool != nil {
+		q.pool.close()
+	}
+	if q.shared != nil {
+		if q.channel == nil {
+			return nil
+		}
+		return q.channel.Close()
+	}
+	if q.connection == nil {
+		return nil
+	}
+	return q.connection.Close()
+}
+
+//CloseContext is Close returning ctx's error if the broker didn't acknowledge the close before ctx is done, the close carries on in the background
+func (q *Queue) CloseContext(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() { done <- q.Close() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//KeepRunning keeps queue processes running, including LogErrors until the connection closes
+//
+//Deprecated: use Run, which can be cancelled and shuts the consumers down gracefully
 func (q *Queue) KeepRunning() {
 	q.wg.Wait()
 }
 
 //Recover allows for client recovery on channel errors
 func (q *Queue) Recover() error {
-	conn, err := amqp.Dial(q.Config.Host)
-	if err != nil {
-		return err
-	}
-
-	q.connection = conn
-	q.Connected = true
-	ch, err := q.connection.Channel()
+	return q.RecoverContext(context.Background())
+}
 
+//RecoverContext is Recover giving up on dialing and declaring when ctx is done
+func (q *Queue) RecoverContext(ctx context.Context) error {
+	cfg := q.config()
+	q.metrics().Reconnected()
+	n := q.recordReconnect()
+	q.logger().Info("Recovering connection", F("queue", cfg.RoutingKey), F("attempt", n))
+	err := q.connect(ctx)
 	if err != nil {
-		return err
+		q.logger().Error("Recovery failed", F("queue", cfg.RoutingKey), F("attempt", n), F("error", err))
+		q.reportError(ErrorScopeRecover, err)
+		q.stats.reconnectFailures.Add(1)
+		q.record(Event{Type: EventReconnectFailed, Attempt: n, Reason: err.Error()})
 	}
+	return err
+}
 
-	q.channel = ch
-	q.channel.Qos(q.Config.PrefetchCount, q.Config.PrefetchByteSize, true)
-
-	iq, err := q.channel.QueueDeclare(q.Config.RoutingKey, q.Config.Durable, q.Config.DeleteIfUnused, q.Config.Exclusive, q.Config.NoWait, q.Config.arguments)
+//DirectReplyTo is RabbitMQ's direct reply-to pseudo queue, replies sent to it reach the consumer on the channel that published the request without a reply queue
+const DirectReplyTo = "amq.rabbitmq.reply-to"
 
+//ConsumeDirectReplies consumes the DirectReplyTo pseudo queue on the queue's channel, so messages it publishes with ReplyTo set to DirectReplyTo get their replies passed to f. It must be called before publishing such messages and consumes until the channel closes, a recovered channel needs it called again
+func (q *Queue) ConsumeDirectReplies(f func(m *Message)) error {
+	if q.channel == nil {
+		return ErrNotConnected
+	}
+	msgs, err := q.channel.Consume(DirectReplyTo, "", true, false, false, false, nil)
 	if err != nil {
 		return err
 	}
-
-	if q.Config.Exchange != "" {
-		err = q.bind()
-		if err != nil {
-			return err
+	go func() {
+		for msg := range msgs {
+			//replies take delivery tags on the channel too, they are auto acknowledged
+			if q.batchingAcks() {
+				q.acks.delivered(&msg, ackSettled)
+			}
+			f(q.newMessage(context.Background(), msg))
 		}
-	}
-	q.internalQueue = &iq
-
+	}()
 	return nil
-
 }
@@ -0,0 +1,423 @@
+//Package amqphelpertest provides an in memory broker implementing amqphelper's QueueClient, for fast deterministic unit tests of message flows
+package amqphelpertest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ermyuriel/amqphelper"
+	"github.com/ermyuriel/amqphelper/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//ErrUnroutable is returned by mandatory publishes no queue is bound for
+var ErrUnroutable = fmt.Errorf("Message could not be routed")
+
+//Broker routes messages between in memory queues. The default exchange "" routes to the queue named by the routing key, other exchanges route by their bindings using topic matching, which covers direct exchanges as well
+type Broker struct {
+	//Clock stamps messages and dead letters, SystemClock when nil
+	Clock amqphelper.Clock
+
+	mu       sync.Mutex
+	queues   map[string]*queue
+	bindings map[string][]binding
+	tag      uint64
+}
+
+type binding struct {
+	pattern string
+	queue   string
+}
+
+type entry struct {
+	d        amqp.Delivery
+	attempts int
+}
+
+type queue struct {
+	name    string
+	opts    QueueOptions
+	ready   []*entry
+	unacked map[uint64]*entry
+	cond    *sync.Cond
+}
+
+//QueueOptions configures a queue of the broker
+type QueueOptions struct {
+	//Exchange and RoutingKey are where the Queue's Publish sends to, the default exchange and the queue's name when empty. The queue is bound to Exchange with RoutingKey when both are set
+	Exchange   string
+	RoutingKey string
+	//AutoAck acknowledges messages as they are delivered
+	AutoAck bool
+	//DeadLetterQueue receives rejected and nacked messages that aren't requeued, with an x-death header like RabbitMQ's
+	DeadLetterQueue string
+	//MaxRedeliveries dead letters messages requeued more than that, 0 requeues them forever
+	MaxRedeliveries int
+}
+
+func (b *Broker) clock() amqphelper.Clock {
+	if b.Clock != nil {
+		return b.Clock
+	}
+	return amqphelper.SystemClock
+}
+
+//NewBroker returns an empty Broker
+func NewBroker() *Broker {
+	return &Broker{queues: map[string]*queue{}, bindings: map[string][]binding{}}
+}
+
+//Declare creates the queue name if it doesn't exist yet and returns a client for it
+func (b *Broker) Declare(name string, opts QueueOptions) *Queue {
+	b.mu.Lock()
+	q := b.declare(name)
+	q.opts = opts
+	if opts.Exchange != "" && opts.RoutingKey != "" {
+		b.bindings[opts.Exchange] = append(b.bindings[opts.Exchange], binding{opts.RoutingKey, name})
+	}
+	if opts.DeadLetterQueue != "" {
+		b.declare(opts.DeadLetterQueue)
+	}
+	b.mu.Unlock()
+	return &Queue{broker: b, queue: q, closed: make(chan struct{})}
+}
+
+func (b *Broker) declare(name string) *queue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &queue{name: name, unacked: map[uint64]*entry{}, cond: sync.NewCond(&b.mu)}
+		b.queues[name] = q
+	}
+	return q
+}
+
+//Bind routes messages published to exchange with a routing key matching pattern to the queue
+func (b *Broker) Bind(exchange, pattern, queue string) {
+	b.mu.Lock()
+	b.declare(queue)
+	b.bindings[exchange] = append(b.bindings[exchange], binding{pattern, queue})
+	b.mu.Unlock()
+}
+
+//Publish routes msg like a broker would, returning ErrUnroutable for mandatory messages no queue received
+func (b *Broker) Publish(exchange, routingKey string, mandatory bool, msg amqp.Publishing) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var targets []string
+	if exchange == "" {
+		if _, ok := b.queues[routingKey]; ok {
+			targets = append(targets, routingKey)
+		}
+	}
+	seen := map[string]bool{}
+	for _, bd := range b.bindings[exchange] {
+		if !seen[bd.queue] && pubsub.Match(bd.pattern, routingKey) {
+			seen[bd.queue] = true
+			targets = append(targets, bd.queue)
+		}
+	}
+	if len(targets) == 0 && mandatory {
+		return ErrUnroutable
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = b.clock().Now()
+	}
+	for _, t := range targets {
+		b.enqueue(b.queues[t], delivery(exchange, routingKey, msg))
+	}
+	return nil
+}
+
+//cloneHeaders copies h along with the tables and arrays nested in it
+func cloneHeaders(h amqp.Table) amqp.Table {
+	if h == nil {
+		return nil
+	}
+	c := make(amqp.Table, len(h))
+	for k, v := range h {
+		c[k] = cloneHeaderValue(v)
+	}
+	return c
+}
+
+func cloneHeaderValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case amqp.Table:
+		return cloneHeaders(v)
+	case map[string]interface{}:
+		return map[string]interface{}(cloneHeaders(v))
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = cloneHeaderValue(e)
+		}
+		return c
+	case []byte:
+		return append([]byte(nil), v...)
+	}
+	return v
+}
+
+//delivery copies msg the way a broker would, so each queue it is routed to gets its own headers and body
+func delivery(exchange, routingKey string, msg amqp.Publishing) amqp.Delivery {
+	return amqp.Delivery{
+		Headers:         cloneHeaders(msg.Headers),
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Exchange:        exchange,
+		RoutingKey:      routingKey,
+		Body:            append([]byte(nil), msg.Body...),
+	}
+}
+
+//enqueue must be called with the lock held
+func (b *Broker) enqueue(q *queue, d amqp.Delivery) {
+	q.ready = append(q.ready, &entry{d: d})
+	q.cond.Signal()
+}
+
+//next blocks until a message is ready on q or done is closed, it must be called with the lock held. Once done is closed nothing more is delivered, even with messages ready
+func (b *Broker) next(q *queue, done chan struct{}) (*amqphelper.Message, bool) {
+	for {
+		select {
+		case <-done:
+			return nil, false
+		default:
+		}
+		if len(q.ready) > 0 {
+			return b.deliver(q), true
+		}
+		q.cond.Wait()
+	}
+}
+
+//deliver pops the first ready message of q, it must be called with the lock held
+func (b *Broker) deliver(q *queue) *amqphelper.Message {
+	e := q.ready[0]
+	q.ready = q.ready[1:]
+	b.tag++
+	d := e.d
+	//a handler changing the message must not change its redelivery
+	d.Headers, d.Body = cloneHeaders(d.Headers), append([]byte(nil), d.Body...)
+	d.DeliveryTag = b.tag
+	d.Redelivered = e.attempts > 0
+	d.Acknowledger = acker{b, q}
+	d.ConsumerTag = q.name
+	e.attempts++
+	if !q.opts.AutoAck {
+		q.unacked[d.DeliveryTag] = e
+	}
+	return &amqphelper.Message{Delivery: &d}
+}
+
+//Get returns the first ready message of the queue without waiting, false when there is none
+func (b *Broker) Get(queue string) (*amqphelper.Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.queues[queue]
+	if !ok || len(q.ready) == 0 {
+		return nil, false
+	}
+	return b.deliver(q), true
+}
+
+//Ready returns the messages waiting on the queue, in order
+func (b *Broker) Ready(queue string) []amqp.Delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ds []amqp.Delivery
+	if q, ok := b.queues[queue]; ok {
+		for _, e := range q.ready {
+			ds = append(ds, e.d)
+		}
+	}
+	return ds
+}
+
+//Unacked returns how many messages of the queue were delivered and not settled yet
+func (b *Broker) Unacked(queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if q, ok := b.queues[queue]; ok {
+		return len(q.unacked)
+	}
+	return 0
+}
+
+type acker struct {
+	b *Broker
+	q *queue
+}
+
+//settle removes tag, or with multiple every unacked tag up to it, and passes the entries to f in delivery order
+func (a acker) settle(tag uint64, multiple bool, f func(es []*entry)) error {
+	a.b.mu.Lock()
+	defer a.b.mu.Unlock()
+	if !multiple {
+		e, ok := a.q.unacked[tag]
+		if !ok {
+			return fmt.Errorf("Unknown delivery tag %d", tag)
+		}
+		delete(a.q.unacked, tag)
+		f([]*entry{e})
+		return nil
+	}
+	var tags []uint64
+	for t := range a.q.unacked {
+		if t <= tag {
+			tags = append(tags, t)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	es := make([]*entry, len(tags))
+	for i, t := range tags {
+		es[i] = a.q.unacked[t]
+		delete(a.q.unacked, t)
+	}
+	f(es)
+	return nil
+}
+
+func (a acker) Ack(tag uint64, multiple bool) error {
+	return a.settle(tag, multiple, func(es []*entry) {})
+}
+
+func (a acker) Nack(tag uint64, multiple, requeue bool) error {
+	return a.settle(tag, multiple, func(es []*entry) { a.requeueOrDeadLetter(es, requeue) })
+}
+
+func (a acker) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+//requeueOrDeadLetter puts the requeued entries back at the front of the queue and dead letters the others, both in the order given, it must be called with the lock held
+func (a acker) requeueOrDeadLetter(es []*entry, requeue bool) {
+	q := a.q
+	var requeued []*entry
+	for _, e := range es {
+		if requeue && (q.opts.MaxRedeliveries == 0 || e.attempts <= q.opts.MaxRedeliveries) {
+			requeued = append(requeued, e)
+		} else if q.opts.DeadLetterQueue != "" {
+			a.deadLetter(e, requeue)
+		}
+	}
+	if len(requeued) > 0 {
+		q.ready = append(requeued, q.ready...)
+		q.cond.Broadcast()
+	}
+}
+
+//deadLetter routes e to the dead letter queue with an x-death header
+func (a acker) deadLetter(e *entry, requeue bool) {
+	q := a.q
+	d := e.d
+	h := amqp.Table{}
+	for k, v := range d.Headers {
+		h[k] = v
+	}
+	reason := "rejected"
+	if requeue {
+		reason = "delivery_limit"
+	}
+	h["x-death"] = []interface{}{amqp.Table{
+		"queue":        q.name,
+		"reason":       reason,
+		"count":        int64(1),
+		"time":         a.b.clock().Now(),
+		"exchange":     d.Exchange,
+		"routing-keys": []interface{}{d.RoutingKey},
+	}}
+	d.Headers = h
+	d.Exchange, d.RoutingKey = "", q.opts.DeadLetterQueue
+	a.b.enqueue(a.b.queues[q.opts.DeadLetterQueue], d)
+}
+
+//Queue is a client of one broker queue, implementing amqphelper.QueueClient
+type Queue struct {
+	broker *Broker
+	queue  *queue
+	wg     sync.WaitGroup
+	once   sync.Once
+	closed chan struct{}
+}
+
+var _ amqphelper.QueueClient = (*Queue)(nil)
+
+func (q *Queue) target() (string, string) {
+	if q.queue.opts.Exchange == "" {
+		return "", q.queue.name
+	}
+	return q.queue.opts.Exchange, q.queue.opts.RoutingKey
+}
+
+//Publish sends the message to the queue's exchange and routing key
+func (q *Queue) Publish(message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
+	return q.PublishWithContext(context.Background(), message, headers, mandatory, immediate)
+}
+
+//PublishWithContext sends the message to the queue's exchange and routing key
+func (q *Queue) PublishWithContext(ctx context.Context, message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
+	exchange, routingKey := q.target()
+	return q.PublishTo(ctx, exchange, routingKey, amqp.Publishing{Headers: headers, Body: message}, mandatory, immediate)
+}
+
+//PublishTo sends msg to exchange with routingKey
+func (q *Queue) PublishTo(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return q.broker.Publish(exchange, routingKey, mandatory, msg)
+}
+
+//SpawnWorkers starts n goroutines handling the queue's messages with f until Close
+func (q *Queue) SpawnWorkers(consumerPrefix string, consumers int, f func(m *amqphelper.Message)) error {
+	for i := 0; i < consumers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for {
+				q.broker.mu.Lock()
+				m, ok := q.broker.next(q.queue, q.closed)
+				q.broker.mu.Unlock()
+				if !ok {
+					return
+				}
+				f(m)
+			}
+		}()
+	}
+	return nil
+}
+
+//KeepRunning waits for the workers to stop after Close
+func (q *Queue) KeepRunning() {
+	q.wg.Wait()
+}
+
+//Name returns the queue's name
+func (q *Queue) Name() string {
+	return q.queue.name
+}
+
+//Close stops the queue's workers once their current message is handled, unsettled messages stay unacked
+func (q *Queue) Close() error {
+	q.once.Do(func() {
+		close(q.closed)
+		q.broker.mu.Lock()
+		q.queue.cond.Broadcast()
+		q.broker.mu.Unlock()
+	})
+	return nil
+}
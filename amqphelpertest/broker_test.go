@@ -0,0 +1,237 @@
+package amqphelpertest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestBrokerRouting(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		exchange   string
+		routingKey string
+		mandatory  bool
+		want       []string
+		err        error
+	}{
+		{"default exchange", "", "jobs", false, []string{"jobs"}, nil},
+		{"default exchange unknown queue", "", "missing", false, nil, nil},
+		{"topic binding", "events", "order.created", false, []string{"audit", "orders"}, nil},
+		{"wildcard binding", "events", "user.deleted", false, []string{"audit"}, nil},
+		{"unbound", "events", "other", false, nil, nil},
+		{"mandatory unroutable", "events", "other", true, nil, ErrUnroutable},
+		{"mandatory routed", "", "jobs", true, []string{"jobs"}, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := NewBroker()
+			b.Declare("jobs", QueueOptions{})
+			b.Declare("orders", QueueOptions{Exchange: "events", RoutingKey: "order.*"})
+			b.Bind("events", "*.*", "audit")
+			err := b.Publish(c.exchange, c.routingKey, c.mandatory, amqp.Publishing{Body: []byte("body")})
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Publish returned %v, want %v", err, c.err)
+			}
+			var got []string
+			for _, name := range []string{"audit", "jobs", "orders"} {
+				for _, d := range b.Ready(name) {
+					got = append(got, name)
+					if d.Exchange != c.exchange || d.RoutingKey != c.routingKey || string(d.Body) != "body" {
+						t.Errorf("%s got %s/%s %q", name, d.Exchange, d.RoutingKey, d.Body)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("routed to %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+//TestBrokerCopiesMessages changes what was published and what was delivered, neither may reach another queue or a redelivery
+func TestBrokerCopiesMessages(t *testing.T) {
+	b := NewBroker()
+	b.Bind("fanout", "#", "a")
+	b.Bind("fanout", "#", "b")
+	body := []byte("body")
+	headers := amqp.Table{"nested": amqp.Table{"key": "value"}}
+	if err := b.Publish("fanout", "key", false, amqp.Publishing{Headers: headers, Body: body}); err != nil {
+		t.Fatal(err)
+	}
+	body[0] = 'X'
+	headers["nested"].(amqp.Table)["key"] = "published"
+
+	m, _ := b.Get("a")
+	m.Body[0] = 'Y'
+	m.Headers["nested"].(amqp.Table)["key"] = "handled"
+	if err := m.Nack(false, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		d := b.Ready(name)[0]
+		if string(d.Body) != "body" || d.Headers["nested"].(amqp.Table)["key"] != "value" {
+			t.Errorf("%s holds %q with headers %v", name, d.Body, d.Headers)
+		}
+	}
+}
+
+//settleStep gets a message of jobs and settles it with op: ack, nack or reject, requeued or not, or keep to leave it unacked
+type settleStep struct {
+	op      string
+	requeue bool
+}
+
+//TestBrokerSettlement publishes messages 1 to 3 to jobs and settles the messages it gets in turn. ready is what is left on each queue by body, dead the reasons of the dead lettered ones
+func TestBrokerSettlement(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		opts    QueueOptions
+		steps   []settleStep
+		ready   map[string][]string
+		unacked int
+		dead    []string
+	}{
+		{"ack", QueueOptions{DeadLetterQueue: "dlq"}, []settleStep{{"ack", false}}, map[string][]string{"jobs": {"2", "3"}}, 0, nil},
+		{"keep", QueueOptions{}, []settleStep{{"keep", false}, {"keep", false}}, map[string][]string{"jobs": {"3"}}, 2, nil},
+		{"auto ack", QueueOptions{AutoAck: true}, []settleStep{{"keep", false}}, map[string][]string{"jobs": {"2", "3"}}, 0, nil},
+		{"requeue", QueueOptions{DeadLetterQueue: "dlq"}, []settleStep{{"nack", true}}, map[string][]string{"jobs": {"1", "2", "3"}}, 0, nil},
+		{"requeue keeps the order", QueueOptions{}, []settleStep{{"keep", false}, {"reject", true}}, map[string][]string{"jobs": {"2", "3"}}, 1, nil},
+		{"dead letter", QueueOptions{DeadLetterQueue: "dlq"}, []settleStep{{"nack", false}, {"reject", false}}, map[string][]string{"jobs": {"3"}, "dlq": {"1", "2"}}, 0, []string{"rejected", "rejected"}},
+		{"drop without a dead letter queue", QueueOptions{}, []settleStep{{"reject", false}}, map[string][]string{"jobs": {"2", "3"}}, 0, nil},
+		{"delivery limit", QueueOptions{DeadLetterQueue: "dlq", MaxRedeliveries: 1}, []settleStep{{"nack", true}, {"nack", true}}, map[string][]string{"jobs": {"2", "3"}, "dlq": {"1"}}, 0, []string{"delivery_limit"}},
+		{"multiple ack", QueueOptions{}, []settleStep{{"keep", false}, {"keep", false}, {"ack multiple", false}}, map[string][]string{}, 0, nil},
+		{"multiple nack", QueueOptions{DeadLetterQueue: "dlq"}, []settleStep{{"keep", false}, {"nack multiple", false}}, map[string][]string{"jobs": {"3"}, "dlq": {"1", "2"}}, 0, []string{"rejected", "rejected"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := NewBroker()
+			b.Declare("jobs", c.opts)
+			for _, body := range []string{"1", "2", "3"} {
+				b.Publish("", "jobs", false, amqp.Publishing{Body: []byte(body)})
+			}
+			redelivered := map[string]int{}
+			for _, s := range c.steps {
+				m, ok := b.Get("jobs")
+				if !ok {
+					t.Fatal("nothing to get from jobs")
+				}
+				body := string(m.Body)
+				if m.Redelivered != (redelivered[body] > 0) {
+					t.Errorf("message %s redelivered %v after %d requeues", body, m.Redelivered, redelivered[body])
+				}
+				var err error
+				switch s.op {
+				case "ack":
+					err = m.Ack(false)
+				case "ack multiple":
+					err = m.Ack(true)
+				case "nack":
+					err = m.Nack(false, s.requeue)
+				case "nack multiple":
+					err = m.Nack(true, s.requeue)
+				case "reject":
+					err = m.Reject(s.requeue)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.requeue {
+					redelivered[body]++
+				}
+			}
+
+			for _, name := range []string{"jobs", "dlq"} {
+				var got []string
+				for _, d := range b.Ready(name) {
+					got = append(got, string(d.Body))
+				}
+				if want := c.ready[name]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s holds %v, want %v", name, got, want)
+				}
+			}
+			if n := b.Unacked("jobs"); n != c.unacked {
+				t.Errorf("%d messages unacked, want %d", n, c.unacked)
+			}
+			var dead []string
+			for _, d := range b.Ready("dlq") {
+				death, _ := amqphelper.GetStringHeader(d.Headers, "x-death", "0", "reason")
+				queue, _ := amqphelper.GetStringHeader(d.Headers, "x-death", "0", "queue")
+				if queue != "jobs" || d.RoutingKey != "dlq" {
+					t.Errorf("dead letter from %s routed to %s", queue, d.RoutingKey)
+				}
+				dead = append(dead, death)
+			}
+			if !reflect.DeepEqual(dead, c.dead) {
+				t.Errorf("dead lettered for %v, want %v", dead, c.dead)
+			}
+		})
+	}
+}
+
+func TestBrokerUnknownDeliveryTag(t *testing.T) {
+	b := NewBroker()
+	b.Declare("jobs", QueueOptions{})
+	b.Publish("", "jobs", false, amqp.Publishing{})
+	m, _ := b.Get("jobs")
+	if err := m.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Ack(false); err == nil {
+		t.Error("second ack of the same delivery succeeded")
+	}
+}
+
+//TestQueueWorkers consumes with several workers until every message is handled, then stops them with Close
+func TestQueueWorkers(t *testing.T) {
+	b := NewBroker()
+	q := b.Declare("jobs", QueueOptions{})
+	handled := make(chan string, 10)
+	if err := q.SpawnWorkers("test", 3, func(m *amqphelper.Message) {
+		handled <- string(m.Body)
+		m.Ack(false)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
+	for _, body := range want {
+		if err := q.PublishWithContext(context.Background(), []byte(body), nil, true, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for range want {
+		select {
+		case body := <-handled:
+			got = append(got, body)
+		case <-time.After(time.Second):
+			t.Fatalf("handled %v of %v", got, want)
+		}
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("handled %v, want %v", got, want)
+	}
+
+	q.Close()
+	done := make(chan struct{})
+	go func() {
+		q.KeepRunning()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("workers didn't stop after Close")
+	}
+	if err := q.PublishWithContext(context.Background(), []byte("late"), nil, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(b.Ready("jobs")); n != 1 {
+		t.Errorf("%d messages ready after Close, want the late one", n)
+	}
+}
@@ -0,0 +1,116 @@
+package amqphelpertest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Record is a message captured by a Recorder
+type Record struct {
+	Exchange   string
+	RoutingKey string
+	Publishing amqp.Publishing
+	Mandatory  bool
+	Immediate  bool
+	Time       time.Time
+	//Err is what the decorated publisher returned
+	Err error
+}
+
+//Recorder captures published messages for assertions. Used as a Publisher it publishes to Exchange and RoutingKey through Next, or nowhere when Next is nil; Middleware captures what a real Queue publishes instead
+type Recorder struct {
+	Next       amqphelper.Publisher
+	Exchange   string
+	RoutingKey string
+
+	mu      sync.Mutex
+	records []Record
+}
+
+var _ amqphelper.Publisher = (*Recorder)(nil)
+
+//NewRecorder returns a Recorder decorating next, which may be nil
+func NewRecorder(next amqphelper.Publisher, exchange, routingKey string) *Recorder {
+	return &Recorder{Next: next, Exchange: exchange, RoutingKey: routingKey}
+}
+
+func (r *Recorder) record(rec Record) {
+	rec.Time = time.Now()
+	rec.Publishing.Body = append([]byte(nil), rec.Publishing.Body...)
+	r.mu.Lock()
+	r.records = append(r.records, rec)
+	r.mu.Unlock()
+}
+
+//Publish records and forwards the message to Exchange and RoutingKey
+func (r *Recorder) Publish(message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
+	return r.PublishWithContext(context.Background(), message, headers, mandatory, immediate)
+}
+
+//PublishWithContext records and forwards the message to Exchange and RoutingKey
+func (r *Recorder) PublishWithContext(ctx context.Context, message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
+	return r.PublishTo(ctx, r.Exchange, r.RoutingKey, amqp.Publishing{Headers: headers, Body: message}, mandatory, immediate)
+}
+
+//PublishTo records and forwards msg
+func (r *Recorder) PublishTo(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+	var err error
+	if r.Next != nil {
+		err = r.Next.PublishTo(ctx, exchange, routingKey, msg, mandatory, immediate)
+	}
+	r.record(Record{Exchange: exchange, RoutingKey: routingKey, Publishing: msg, Mandatory: mandatory, Immediate: immediate, Err: err})
+	return err
+}
+
+//Middleware returns a PublishMiddleware recording every message a Queue publishes as it is sent, after stamping and before encryption
+func (r *Recorder) Middleware() amqphelper.PublishMiddleware {
+	return func(next amqphelper.PublishFunc) amqphelper.PublishFunc {
+		return func(ctx context.Context, exchange, routingKey string, msg *amqp.Publishing) error {
+			rec := Record{Exchange: exchange, RoutingKey: routingKey, Publishing: *msg}
+			rec.Err = next(ctx, exchange, routingKey, msg)
+			r.record(rec)
+			return rec.Err
+		}
+	}
+}
+
+//Records returns every captured message in publishing order
+func (r *Recorder) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Record(nil), r.records...)
+}
+
+//Count returns how many messages were captured
+func (r *Recorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.records)
+}
+
+//Find returns the messages published with routingKey
+func (r *Recorder) Find(routingKey string) []Record {
+	return r.FindFunc(func(rec Record) bool { return rec.RoutingKey == routingKey })
+}
+
+//FindFunc returns the messages match accepts
+func (r *Recorder) FindFunc(match func(rec Record) bool) []Record {
+	var found []Record
+	for _, rec := range r.Records() {
+		if match(rec) {
+			found = append(found, rec)
+		}
+	}
+	return found
+}
+
+//Reset forgets every captured message
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.records = nil
+	r.mu.Unlock()
+}
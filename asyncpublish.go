@@ -0,0 +1,220 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//DefaultAsyncPublishBuffer is the number of publishes AsyncPublish buffers when Configuration.AsyncPublishBuffer is 0
+const DefaultAsyncPublishBuffer = 4096
+
+//asyncPublisher buffers AsyncPublish calls for a publisher goroutine, which runs while the buffer isn't empty
+type asyncPublisher struct {
+	once    sync.Once
+	queue   chan *asyncPublish
+	mu      sync.Mutex
+	running bool
+	pending sync.WaitGroup
+	//waiting is only used by the publisher goroutine, holding the publish lock
+	waiting *confirmRing
+}
+
+type asyncPublish struct {
+	ctx        context.Context
+	exchange   string
+	routingKey string
+	msg        amqp.Publishing
+	mandatory  bool
+	immediate  bool
+	result     chan error
+}
+
+//asyncBufferSize is also the size of the confirmation buffer: the client library's reader blocks on a full one, stalling the whole connection, so a batch's confirmations must fit in it while the batch is being sent
+func (q *Queue) asyncBufferSize() int {
+	cfg := q.config()
+	if cfg.AsyncPublishBuffer > 0 {
+		return cfg.AsyncPublishBuffer
+	}
+	return DefaultAsyncPublishBuffer
+}
+
+//AsyncPublish enqueues a publish to the configured exchange and routing key and returns at once with a channel receiving its outcome, blocking only while the buffer is full or until ctx is done. A publisher goroutine sends the buffered messages in batches through the same stamping and middleware as Publish and, in confirm mode, waits for the whole batch's confirmations at once instead of one at a time, so the outcome is only known once the broker confirmed the message
+func (q *Queue) AsyncPublish(ctx context.Context, message []byte, headers map[string]interface{}, mandatory, immediate bool) <-chan error {
+	cfg := q.config()
+	return q.AsyncPublishTo(ctx, cfg.Exchange, cfg.RoutingKey, amqp.Publishing{ContentType: cfg.ContentType, ContentEncoding: cfg.ContentEncoding, Body: message, Headers: headers}, mandatory, immediate)
+}
+
+//AsyncPublishTo enqueues msg for exchange and routing key like AsyncPublish
+func (q *Queue) AsyncPublishTo(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) <-chan error {
+	a := &q.async
+	a.once.Do(func() {
+		a.queue = make(chan *asyncPublish, q.asyncBufferSize())
+		a.waiting = newConfirmRing(q.asyncBufferSize())
+	})
+	p := &asyncPublish{ctx: ctx, exchange: exchange, routingKey: routingKey, msg: msg, mandatory: mandatory, immediate: immediate, result: make(chan error, 1)}
+
+	a.pending.Add(1)
+	select {
+	case a.queue <- p:
+	case <-ctx.Done():
+		a.pending.Done()
+		p.result <- ctx.Err()
+		return p.result
+	}
+	a.mu.Lock()
+	if !a.running {
+		a.running = true
+		go q.runAsyncPublisher()
+	}
+	a.mu.Unlock()
+	return p.result
+}
+
+//Flush waits until every publish enqueued by AsyncPublish has its outcome, or until ctx is done
+func (q *Queue) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		q.async.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//runAsyncPublisher publishes batches of what is buffered and returns once the buffer is empty. With Configuration.AsyncBatchWindow a batch waits up to the window after its first message for more to arrive, unless it fills up first
+func (q *Queue) runAsyncPublisher() {
+	a := &q.async
+	batch := make([]*asyncPublish, 0, cap(a.queue))
+	for {
+		select {
+		case p := <-a.queue:
+			batch = append(batch[:0], p)
+			var window <-chan time.Time
+			if w := q.config().AsyncBatchWindow; w > 0 {
+				window = q.Clock().After(w)
+			}
+		drain:
+			for len(batch) < cap(batch) {
+				select {
+				case p := <-a.queue:
+					batch = append(batch, p)
+					continue
+				default:
+				}
+				if window == nil {
+					break
+				}
+				select {
+				case p := <-a.queue:
+					batch = append(batch, p)
+				case <-window:
+					break drain
+				}
+			}
+			q.publishBatch(batch)
+		default:
+			a.mu.Lock()
+			if len(a.queue) == 0 {
+				a.running = false
+				a.mu.Unlock()
+				return
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+//publishBatch sends batch holding the publish lock, so synchronous publishes don't take its confirmations, and reconciles the confirmations by delivery tag in the ring
+func (q *Queue) publishBatch(batch []*asyncPublish) {
+	cfg := q.config()
+	q.publishMu.Lock()
+	defer q.publishMu.Unlock()
+
+	waiting := q.async.waiting
+	ch := q.channel
+	//a recovery while publishing opens a new channel and starts its delivery tags over, the messages sent on the old one are never confirmed
+	fail := func(err error) {
+		waiting.drain(func(result chan error) { q.resolveAsync(result, err) })
+	}
+	//deliver records whether the message was sent and with which delivery tag, on ch, so a retry after a recovery is tracked by the tag it got
+	var sent bool
+	var tag uint64
+	deliver := func(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+		if q.channel != ch || q.publishSeq < tag {
+			fail(fmt.Errorf("%w: the channel was recovered before the confirmation", ErrChannelClosed))
+			ch = q.channel
+		}
+		if err := q.channel.PublishWithContext(ctx, exchange, routingKey, mandatory, immediate, msg); err != nil {
+			return wrapError(err)
+		}
+		sent = true
+		if cfg.ConfirmPublishes {
+			q.publishSeq++
+			tag = q.publishSeq
+		}
+		return nil
+	}
+
+	for _, p := range batch {
+		sent = false
+		err := q.publishVia(p.ctx, deliver, p.exchange, p.routingKey, &p.msg, p.mandatory, p.immediate)
+		//messages published on PublishAll's transaction don't go through deliver and have no tag
+		if err != nil || !cfg.ConfirmPublishes || !sent {
+			q.resolveAsync(p.result, err)
+			continue
+		}
+		//a batch is at most the buffer's size, which the ring holds while the tags are consecutive
+		if !waiting.add(tag, p.result) {
+			q.resolveAsync(p.result, fmt.Errorf("Could not track the confirmation of delivery tag %d, the message may still have been routed", tag))
+		}
+	}
+	if waiting.len() == 0 {
+		return
+	}
+	if q.channel != ch {
+		fail(fmt.Errorf("%w: the channel was recovered before the confirmation", ErrChannelClosed))
+		return
+	}
+
+	var timeout <-chan time.Time
+	if cfg.ConfirmTimeout > 0 {
+		timeout = q.Clock().After(cfg.ConfirmTimeout)
+	}
+	for waiting.len() > 0 {
+		var c amqp.Confirmation
+		var ok bool
+		select {
+		case c, ok = <-q.confirms:
+		case <-timeout:
+			fail(ErrConfirmTimeout)
+			return
+		}
+		if !ok {
+			fail(fmt.Errorf("%w: %w", ErrChannelClosed, amqp.ErrClosed))
+			return
+		}
+		q.metrics().Confirmed(c.Ack)
+		q.debug("Confirm received", F("delivery_tag", c.DeliveryTag), F("ack", c.Ack))
+		//tags that aren't waiting are late confirmations of timed out publishes
+		if result, ok := waiting.resolve(c.DeliveryTag); ok {
+			var err error
+			if !c.Ack {
+				err = ErrPublishNacked
+			}
+			q.resolveAsync(result, err)
+		}
+	}
+}
+
+func (q *Queue) resolveAsync(result chan error, err error) {
+	result <- err
+	q.async.pending.Done()
+}
@@ -0,0 +1,107 @@
+package amqphelper
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//AuditRecord describes the outcome of a single publish
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Exchange   string    `json:"exchange"`
+	RoutingKey string    `json:"routing_key"`
+	MessageID  string    `json:"message_id,omitempty"`
+	Size       int       `json:"size"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+}
+
+const (
+	//AuditPublished is the outcome of a publish handed to the broker without confirms
+	AuditPublished = "published"
+	//AuditConfirmed is the outcome of a publish acknowledged by the broker in confirm mode
+	AuditConfirmed = "confirmed"
+	//AuditNacked is the outcome of a publish negatively acknowledged by the broker
+	AuditNacked = "nacked"
+	//AuditFailed is the outcome of a publish that couldn't be sent
+	AuditFailed = "failed"
+)
+
+func (q *Queue) audit(exchange, routingKey string, msg *amqp.Publishing, err error) {
+	cfg := q.config()
+	r := AuditRecord{Time: q.Clock().Now().UTC(), Exchange: exchange, RoutingKey: routingKey, MessageID: msg.MessageId, Size: len(msg.Body)}
+	switch {
+	case errors.Is(err, ErrPublishNacked):
+		r.Outcome = AuditNacked
+	case err != nil:
+		r.Outcome = AuditFailed
+	case cfg.ConfirmPublishes:
+		r.Outcome = AuditConfirmed
+	default:
+		r.Outcome = AuditPublished
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	cfg.Auditor(r)
+}
+
+//JSONLAuditWriter writes audit records as JSON lines, set its Audit method as Configuration.Auditor
+type JSONLAuditWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	w   io.Writer
+	err error
+}
+
+//NewJSONLAuditWriter returns a writer appending records to w
+func NewJSONLAuditWriter(w io.Writer) *JSONLAuditWriter {
+	return &JSONLAuditWriter{enc: json.NewEncoder(w), w: w}
+}
+
+//OpenJSONLAuditFile opens or creates path for appending audit records
+func OpenJSONLAuditFile(path string) (*JSONLAuditWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLAuditWriter(f), nil
+}
+
+//Audit writes a record, the first write error is kept and returned by Err
+func (a *JSONLAuditWriter) Audit(r AuditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(r); err != nil && a.err == nil {
+		a.err = err
+	}
+}
+
+//Err returns the first error encountered while writing
+func (a *JSONLAuditWriter) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+//Close syncs and closes the underlying writer when it supports it
+func (a *JSONLAuditWriter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if f, ok := a.w.(*os.File); ok {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if c, ok := a.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+//BackendAMQP091 names the built in backend, RabbitMQ's AMQP 0-9-1 implemented by Queue. It is used when Configuration.Backend is empty
+const BackendAMQP091 = "amqp091"
+
+//BackendFunc opens a QueueClient for config
+type BackendFunc func(ctx context.Context, config *Configuration) (QueueClient, error)
+
+var backends = struct {
+	sync.RWMutex
+	m map[string]BackendFunc
+}{m: map[string]BackendFunc{}}
+
+//RegisterBackend makes a backend selectable by Configuration.Backend under name, packages implementing one call it from init so importing them is enough. It panics when name is taken
+func RegisterBackend(name string, open BackendFunc) {
+	backends.Lock()
+	defer backends.Unlock()
+	if _, ok := backends.m[name]; ok || name == BackendAMQP091 {
+		panic(fmt.Sprintf("amqphelper: backend %q registered twice", name))
+	}
+	backends.m[name] = open
+}
+
+//Open returns a QueueClient for config from the backend named by Configuration.Backend, a Queue when it is empty or BackendAMQP091
+func Open(ctx context.Context, config *Configuration) (QueueClient, error) {
+	if config.Backend == "" || config.Backend == BackendAMQP091 {
+		//a nil *Queue would make a non nil QueueClient
+		q, err := GetQueueContext(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return q, nil
+	}
+	backends.RLock()
+	open, ok := backends.m[config.Backend]
+	backends.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown backend %q, import the package implementing it", config.Backend)
+	}
+	return open(ctx, config)
+}
@@ -0,0 +1,141 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//BackpressurePolicy is what a consumer does when handlers fall behind and its Configuration.DeliveryBuffer is full
+type BackpressurePolicy int
+
+const (
+	//BackpressureBlock stops reading deliveries until the buffer has room, the client library keeps receiving up to the prefetch count
+	BackpressureBlock BackpressurePolicy = iota
+	//BackpressurePause also cancels the consumer so the broker stops delivering to it, even with AutoAcknowledgeMessages where the prefetch count doesn't apply, and consumes again with the same tag once the buffer is half empty. Deliveries sent before the cancellation are still buffered and handled
+	BackpressurePause
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureBlock:
+		return "block"
+	case BackpressurePause:
+		return "pause"
+	}
+	return fmt.Sprintf("BackpressurePolicy(%d)", int(p))
+}
+
+//ParseBackpressurePolicy returns the policy named by s, block or pause
+func ParseBackpressurePolicy(s string) (BackpressurePolicy, error) {
+	switch s {
+	case "block":
+		return BackpressureBlock, nil
+	case "pause":
+		return BackpressurePause, nil
+	}
+	return 0, fmt.Errorf("Unknown backpressure policy %q", s)
+}
+
+//consumerControl cancels and starts consumers, the queue's own channel outside tests
+type consumerControl interface {
+	CancelConsumer(tag string) error
+	GetConsumer(tag string) (<-chan amqp.Delivery, error)
+}
+
+//buffer copies the deliveries of the consumer tag into a channel of Configuration.DeliveryBuffer deliveries, applying the backpressure policy when it is full. received must be called after every delivery read from the channel, it lets a paused consumer resume. Without a DeliveryBuffer msgs is returned as is
+func (q *Queue) buffer(ctx context.Context, tag string, msgs <-chan amqp.Delivery) (buf <-chan amqp.Delivery, received func()) {
+	return q.bufferWith(ctx, q, tag, msgs)
+}
+
+func (q *Queue) bufferWith(ctx context.Context, cc consumerControl, tag string, msgs <-chan amqp.Delivery) (buf <-chan amqp.Delivery, received func()) {
+	cfg := q.config()
+	size := cfg.DeliveryBuffer
+	if size <= 0 {
+		return msgs, func() {}
+	}
+	c := make(chan amqp.Delivery, size)
+	//drained gets a token once the buffer of a paused consumer is half empty, deliveries read while it isn't paused don't signal it
+	drained := make(chan struct{}, 1)
+	var pausing atomic.Bool
+	received = func() {
+		if pausing.Load() && len(c) <= size/2 {
+			select {
+			case drained <- struct{}{}:
+			default:
+			}
+		}
+	}
+	go func() {
+		defer close(c)
+		full := false
+		for {
+			paused := false
+			for d := range msgs {
+				select {
+				case c <- d:
+					if full {
+						full = false
+						q.observeBuffer(tag, false)
+					}
+					continue
+				default:
+				}
+				full = true
+				q.observeBuffer(tag, true)
+				q.logger().Warn("Delivery buffer full, handlers are falling behind", F("queue", cfg.RoutingKey), F("consumer", tag), F("buffer", size), F("policy", cfg.Backpressure))
+				q.record(Event{Type: EventBackpressure, Reason: cfg.Backpressure.String(), Consumer: tag})
+				if cfg.Backpressure == BackpressurePause && !paused {
+					select {
+					case <-drained:
+					default:
+					}
+					pausing.Store(true)
+					//the delivery channel closes once the cancellation is confirmed
+					if err := cc.CancelConsumer(tag); err != nil {
+						pausing.Store(false)
+						q.logger().Warn("Could not pause consumer", F("queue", cfg.RoutingKey), F("consumer", tag), F("error", err))
+					} else {
+						paused = true
+					}
+				}
+				c <- d
+			}
+			if !paused {
+				return
+			}
+			msgs = q.resumeConsumer(ctx, cc, tag, drained)
+			pausing.Store(false)
+			if msgs == nil {
+				return
+			}
+		}
+	}()
+	return c, received
+}
+
+//resumeConsumer waits for the paused consumer's buffer to be half empty and consumes again, it returns nil when the consumer is being stopped meanwhile or can't consume
+func (q *Queue) resumeConsumer(ctx context.Context, cc consumerControl, tag string, drained chan struct{}) <-chan amqp.Delivery {
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return nil
+	}
+	if q.lifecycle.stopping() || ctx.Err() != nil {
+		return nil
+	}
+	msgs, err := cc.GetConsumer(tag)
+	if err != nil {
+		q.logger().Warn("Could not resume consumer", F("queue", q.config().RoutingKey), F("consumer", tag), F("error", err))
+		q.reportError(ErrorScopeConsume, err)
+		return nil
+	}
+	//Shutdown may have cancelled the consumers while it was paused
+	if q.lifecycle.stopping() || ctx.Err() != nil {
+		cc.CancelConsumer(tag)
+	}
+	q.record(Event{Type: EventBackpressureResumed, Consumer: tag})
+	return msgs
+}
@@ -0,0 +1,82 @@
+package amqphelper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//fakeConsumers closes the deliveries of a cancelled consumer and hands out a new channel when it consumes again, like the broker
+type fakeConsumers struct {
+	mu        sync.Mutex
+	msgs      chan amqp.Delivery
+	cancelled bool
+	consumes  int
+}
+
+func (f *fakeConsumers) CancelConsumer(tag string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelled = true
+	close(f.msgs)
+	return nil
+}
+
+func (f *fakeConsumers) GetConsumer(tag string) (<-chan amqp.Delivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelled = false
+	f.consumes++
+	f.msgs = make(chan amqp.Delivery)
+	return f.msgs, nil
+}
+
+func (f *fakeConsumers) state() (cancelled bool, consumes int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cancelled, f.consumes
+}
+
+//TestPauseWaitsForHalfEmptyBuffer fills the buffer of a pausing consumer after deliveries were read from a half empty one, which must not let it resume before the buffer is drained to half again
+func TestPauseWaitsForHalfEmptyBuffer(t *testing.T) {
+	const size = 4
+	q := newQueue(&Configuration{DeliveryBuffer: size, Backpressure: BackpressurePause})
+	f := &fakeConsumers{msgs: make(chan amqp.Delivery)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	buf, received := q.bufferWith(ctx, f, "test", f.msgs)
+
+	f.msgs <- amqp.Delivery{DeliveryTag: 1}
+	<-buf
+	received()
+
+	for tag := uint64(2); tag <= size+2; tag++ {
+		f.msgs <- amqp.Delivery{DeliveryTag: tag}
+	}
+	//the delivery that found the buffer full is held until one is read
+	within(t, func() bool { cancelled, _ := f.state(); return cancelled }, "consumer wasn't cancelled once the buffer was full")
+
+	for len(buf) > size/2 {
+		<-buf
+		received()
+		time.Sleep(20 * time.Millisecond)
+		if cancelled, consumes := f.state(); len(buf) > size/2 && (!cancelled || consumes > 0) {
+			t.Fatalf("consumer resumed with %d of %d deliveries buffered", len(buf), size)
+		}
+	}
+
+	within(t, func() bool { cancelled, consumes := f.state(); return !cancelled && consumes == 1 }, "consumer didn't resume once the buffer was half empty")
+}
+
+//within fails the test when ok isn't true after a second
+func within(t *testing.T, ok func() bool, failure string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !ok(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal(failure)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//ErrCircuitOpen is returned by publishes rejected by an open CircuitBreaker
+var ErrCircuitOpen = fmt.Errorf("Circuit breaker is open")
+
+//BreakerState is the state of a CircuitBreaker
+type BreakerState string
+
+const (
+	//BreakerClosed lets every publish through
+	BreakerClosed BreakerState = "closed"
+	//BreakerOpen fails publishes fast
+	BreakerOpen BreakerState = "open"
+	//BreakerHalfOpen lets a limited number of probes through to find out whether the broker recovered
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+//CircuitBreaker fails publishes fast with ErrCircuitOpen after FailureThreshold consecutive failures. Once OpenTimeout passed it lets up to Probes publishes through at a time, closing again after Probes of them succeed and reopening on the first failure. Register it with Queue.UsePublish(b.Middleware())
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	//Probes defaults to 1
+	Probes int
+	//OnStateChange is called on every transition, outside the breaker's lock
+	OnStateChange func(from, to BreakerState)
+	//Clock defaults to SystemClock
+	Clock Clock
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	successes int
+	inFlight  int
+	openedAt  time.Time
+}
+
+func (b *CircuitBreaker) clock() Clock {
+	if b.Clock != nil {
+		return b.Clock
+	}
+	return SystemClock
+}
+
+func (b *CircuitBreaker) probes() int {
+	if b.Probes < 1 {
+		return 1
+	}
+	return b.Probes
+}
+
+//State returns the breaker's current state
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == "" {
+		return BreakerClosed
+	}
+	return b.state
+}
+
+//transition must be called with the lock held, it returns the callback to run once it is released
+func (b *CircuitBreaker) transition(to BreakerState) func() {
+	from := b.state
+	if from == "" {
+		from = BreakerClosed
+	}
+	b.state, b.failures, b.successes = to, 0, 0
+	if to == BreakerOpen {
+		b.openedAt = b.clock().Now()
+	}
+	if b.OnStateChange == nil || from == to {
+		return func() {}
+	}
+	return func() { b.OnStateChange(from, to) }
+}
+
+//allow reports whether a publish may go ahead and whether it is a probe
+func (b *CircuitBreaker) allow() (ok, probe bool, notify func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	notify = func() {}
+	if b.state == BreakerOpen {
+		if b.clock().Now().Sub(b.openedAt) < b.OpenTimeout {
+			return false, false, notify
+		}
+		notify = b.transition(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.inFlight >= b.probes() {
+			return false, false, notify
+		}
+		b.inFlight++
+		return true, true, notify
+	}
+	return true, false, notify
+}
+
+func (b *CircuitBreaker) done(probe bool, err error) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.inFlight--
+	}
+	if b.state == BreakerOpen {
+		return func() {}
+	}
+	if b.state == BreakerHalfOpen {
+		if !probe {
+			return func() {}
+		}
+		if err != nil {
+			return b.transition(BreakerOpen)
+		}
+		b.successes++
+		if b.successes >= b.probes() {
+			return b.transition(BreakerClosed)
+		}
+		return func() {}
+	}
+	if err == nil {
+		b.failures = 0
+		return func() {}
+	}
+	b.failures++
+	if b.FailureThreshold > 0 && b.failures >= b.FailureThreshold {
+		return b.transition(BreakerOpen)
+	}
+	return func() {}
+}
+
+//Middleware returns the PublishMiddleware enforcing the breaker
+func (b *CircuitBreaker) Middleware() PublishMiddleware {
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, exchange, routingKey string, msg *amqp.Publishing) error {
+			ok, probe, notify := b.allow()
+			notify()
+			if !ok {
+				return ErrCircuitOpen
+			}
+			err := next(ctx, exchange, routingKey, msg)
+			b.done(probe, err)()
+			return err
+		}
+	}
+}
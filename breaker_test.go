@@ -0,0 +1,123 @@
+package amqphelper
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var errPublish = errors.New("publish failed")
+
+//breakerStep publishes through the breaker, ok or fail being what the broker does with it, or moves the clock: wait by the OpenTimeout, short by half of it. during publishes again while a succeeding probe is in flight, err is then what that publish returned. state is the breaker's afterwards
+type breakerStep struct {
+	op    string
+	err   error
+	state BreakerState
+}
+
+//TestCircuitBreaker runs a breaker opening after 2 consecutive failures for 10 seconds, changes are the transitions OnStateChange saw
+func TestCircuitBreaker(t *testing.T) {
+	opened := []breakerStep{{"fail", errPublish, BreakerClosed}, {"fail", errPublish, BreakerOpen}}
+	for _, c := range []struct {
+		name      string
+		threshold int
+		probes    int
+		steps     []breakerStep
+		changes   []string
+	}{
+		{"below the threshold", 2, 1, []breakerStep{
+			{"fail", errPublish, BreakerClosed},
+			{"ok", nil, BreakerClosed},
+			{"fail", errPublish, BreakerClosed},
+		}, nil},
+		{"opens", 2, 1, append(opened,
+			breakerStep{"ok", ErrCircuitOpen, BreakerOpen},
+		), []string{"closed>open"}},
+		{"before the timeout", 2, 1, append(opened,
+			breakerStep{"short", nil, BreakerOpen},
+			breakerStep{"ok", ErrCircuitOpen, BreakerOpen},
+		), []string{"closed>open"}},
+		{"probe succeeds", 2, 1, append(opened,
+			breakerStep{"wait", nil, BreakerOpen},
+			breakerStep{"ok", nil, BreakerClosed},
+			breakerStep{"fail", errPublish, BreakerClosed},
+		), []string{"closed>open", "open>half_open", "half_open>closed"}},
+		{"probe fails", 2, 1, append(opened,
+			breakerStep{"wait", nil, BreakerOpen},
+			breakerStep{"fail", errPublish, BreakerOpen},
+			breakerStep{"ok", ErrCircuitOpen, BreakerOpen},
+			breakerStep{"wait", nil, BreakerOpen},
+			breakerStep{"ok", nil, BreakerClosed},
+		), []string{"closed>open", "open>half_open", "half_open>open", "open>half_open", "half_open>closed"}},
+		{"several probes", 2, 2, append(opened,
+			breakerStep{"wait", nil, BreakerOpen},
+			breakerStep{"ok", nil, BreakerHalfOpen},
+			breakerStep{"ok", nil, BreakerClosed},
+		), []string{"closed>open", "open>half_open", "half_open>closed"}},
+		{"probe in flight", 2, 1, append(opened,
+			breakerStep{"wait", nil, BreakerOpen},
+			breakerStep{"during", ErrCircuitOpen, BreakerClosed},
+		), []string{"closed>open", "open>half_open", "half_open>closed"}},
+		{"second probe in flight", 2, 2, append(opened,
+			breakerStep{"wait", nil, BreakerOpen},
+			breakerStep{"during", nil, BreakerClosed},
+		), []string{"closed>open", "open>half_open", "half_open>closed"}},
+		{"no threshold", 0, 1, []breakerStep{
+			{"fail", errPublish, BreakerClosed},
+			{"fail", errPublish, BreakerClosed},
+			{"fail", errPublish, BreakerClosed},
+		}, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			clock := &fixedClock{eventTime}
+			var changes []string
+			b := &CircuitBreaker{
+				FailureThreshold: c.threshold,
+				OpenTimeout:      10 * time.Second,
+				Probes:           c.probes,
+				Clock:            clock,
+				OnStateChange:    func(from, to BreakerState) { changes = append(changes, string(from)+">"+string(to)) },
+			}
+			var publish PublishFunc
+			var inner error
+			publish = b.Middleware()(func(ctx context.Context, exchange, routingKey string, msg *amqp.Publishing) error {
+				switch string(msg.Body) {
+				case "fail":
+					return errPublish
+				case "during":
+					inner = publish(ctx, exchange, routingKey, &amqp.Publishing{Body: []byte("ok")})
+				}
+				return nil
+			})
+			for i, s := range c.steps {
+				var err error
+				switch s.op {
+				case "wait":
+					clock.now = clock.now.Add(b.OpenTimeout)
+				case "short":
+					clock.now = clock.now.Add(b.OpenTimeout / 2)
+				case "during":
+					if err = publish(context.Background(), "", "", &amqp.Publishing{Body: []byte(s.op)}); err != nil {
+						t.Fatalf("step %d: probe returned %v", i, err)
+					}
+					err = inner
+				default:
+					err = publish(context.Background(), "", "", &amqp.Publishing{Body: []byte(s.op)})
+				}
+				if !errors.Is(err, s.err) {
+					t.Errorf("step %d %s returned %v, want %v", i, s.op, err, s.err)
+				}
+				if state := b.State(); state != s.state {
+					t.Errorf("step %d %s left the breaker %s, want %s", i, s.op, state, s.state)
+				}
+			}
+			if !reflect.DeepEqual(changes, c.changes) {
+				t.Errorf("transitions %v, want %v", changes, c.changes)
+			}
+		})
+	}
+}
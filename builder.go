@@ -0,0 +1,142 @@
+package amqphelper
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+//QueueBuilder assembles a Configuration fluently and connects once it validates:
+//
+//	q, err := NewQueueBuilder().Host("amqp://localhost").Queue("jobs").Durable().DeadLetterTo("dlx", "jobs.dead").Prefetch(50).Build()
+type QueueBuilder struct {
+	config Configuration
+}
+
+//NewQueueBuilder returns a builder over a zero Configuration
+func NewQueueBuilder() *QueueBuilder {
+	return &QueueBuilder{}
+}
+
+//With applies opts, for settings without a builder method of their own
+func (b *QueueBuilder) With(opts ...Option) *QueueBuilder {
+	for _, opt := range opts {
+		opt(&b.config)
+	}
+	return b
+}
+
+//Host sets the broker URI
+func (b *QueueBuilder) Host(uri string) *QueueBuilder {
+	b.config.Host = uri
+	return b
+}
+
+//Queue names the queue, see WithQueue
+func (b *QueueBuilder) Queue(name string) *QueueBuilder {
+	return b.With(WithQueue(name))
+}
+
+//Exchange sets the exchange, see WithExchange
+func (b *QueueBuilder) Exchange(exchange, kind string) *QueueBuilder {
+	return b.With(WithExchange(exchange, kind))
+}
+
+//BindingKeys sets the binding keys, see WithBindingKeys
+func (b *QueueBuilder) BindingKeys(keys ...string) *QueueBuilder {
+	return b.With(WithBindingKeys(keys...))
+}
+
+//Durable declares the queue durable
+func (b *QueueBuilder) Durable() *QueueBuilder {
+	return b.With(WithDurable())
+}
+
+//Exclusive declares the queue exclusive
+func (b *QueueBuilder) Exclusive() *QueueBuilder {
+	return b.With(WithExclusive())
+}
+
+//AutoDelete declares the queue auto deleted
+func (b *QueueBuilder) AutoDelete() *QueueBuilder {
+	return b.With(WithAutoDelete())
+}
+
+//AutoAck consumes without acknowledgements
+func (b *QueueBuilder) AutoAck() *QueueBuilder {
+	return b.With(WithAutoAck())
+}
+
+//PublishOnly skips declaring the queue
+func (b *QueueBuilder) PublishOnly() *QueueBuilder {
+	return b.With(WithPublishOnly())
+}
+
+//Prefetch sets the prefetch count
+func (b *QueueBuilder) Prefetch(count int) *QueueBuilder {
+	return b.With(WithPrefetch(count))
+}
+
+//ContentType sets the content type of published messages
+func (b *QueueBuilder) ContentType(contentType string) *QueueBuilder {
+	return b.With(WithContentType(contentType))
+}
+
+//Codec sets the codec
+func (b *QueueBuilder) Codec(codec Codec) *QueueBuilder {
+	return b.With(WithCodec(codec))
+}
+
+//Confirms waits for publish confirmations
+func (b *QueueBuilder) Confirms() *QueueBuilder {
+	return b.With(WithConfirms())
+}
+
+//Persistent publishes persistent messages
+func (b *QueueBuilder) Persistent() *QueueBuilder {
+	return b.With(WithPersistentMessages())
+}
+
+//DeadLetterTo dead letters rejected messages through exchange to queue, see WithDeadLetter
+func (b *QueueBuilder) DeadLetterTo(exchange, queue string) *QueueBuilder {
+	return b.With(WithDeadLetter(exchange, queue))
+}
+
+//TLS dials with cfg
+func (b *QueueBuilder) TLS(cfg *tls.Config) *QueueBuilder {
+	return b.With(WithTLS(cfg))
+}
+
+//Heartbeat sets the heartbeat interval
+func (b *QueueBuilder) Heartbeat(interval time.Duration) *QueueBuilder {
+	return b.With(WithHeartbeat(interval))
+}
+
+//Logger sets the logger
+func (b *QueueBuilder) Logger(l Logger) *QueueBuilder {
+	return b.With(WithLogger(l))
+}
+
+//Metrics sets the metrics collector
+func (b *QueueBuilder) Metrics(m Metrics) *QueueBuilder {
+	return b.With(WithMetrics(m))
+}
+
+//Clock replaces the system clock
+func (b *QueueBuilder) Clock(clock Clock) *QueueBuilder {
+	return b.With(WithClock(clock))
+}
+
+//Config returns a copy of the Configuration built so far
+func (b *QueueBuilder) Config() *Configuration {
+	c := b.config
+	return &c
+}
+
+//Build validates the Configuration and connects with a copy of it, the builder can be reused afterwards
+func (b *QueueBuilder) Build() (*Queue, error) {
+	c := b.Config()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return GetQueue(c)
+}
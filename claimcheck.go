@@ -0,0 +1,91 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//ClaimCheckHeader carries the BlobStore key of a payload published by reference
+const ClaimCheckHeader = "x-claim-check"
+
+//BlobStore keeps payloads too large to publish, implementations must be safe for concurrent use. Blobs are never deleted by the queue, rely on the store's lifecycle rules to expire them
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+//FileBlobStore keeps blobs as files in Dir, which consumers must share with publishers
+type FileBlobStore struct {
+	Dir string
+}
+
+func (s FileBlobStore) path(key string) (string, error) {
+	if key == "" || filepath.Base(key) != key {
+		return "", fmt.Errorf("Invalid blob key %q", key)
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+//Put writes data to a file named key, through a temporary file so readers never see a partial blob
+func (s FileBlobStore) Put(ctx context.Context, key string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+//Get reads the file named key
+func (s FileBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+//checkIn stores bodies larger than Configuration.ClaimCheckThreshold in the BlobStore, publishing an empty body and the blob's key instead. It runs after encryption and signing so the stored payload is exactly what would have been published
+func (q *Queue) checkIn(ctx context.Context, msg *amqp.Publishing) error {
+	cfg := q.config()
+	if len(msg.Body) <= cfg.ClaimCheckThreshold {
+		return nil
+	}
+	key := newUUID()
+	if err := cfg.BlobStore.Put(ctx, key, msg.Body); err != nil {
+		return err
+	}
+	h := cloneTable(msg.Headers)
+	h[ClaimCheckHeader] = key
+	msg.Headers = h
+	msg.Body = nil
+	return nil
+}
+
+//checkOut replaces the body of a message published by reference with the stored payload and drops ClaimCheckHeader, so middleware and handlers see the message as it would have been published
+func (q *Queue) checkOut(m *Message) error {
+	cfg := q.config()
+	key, ok := m.HeaderTable()[ClaimCheckHeader].(string)
+	if !ok {
+		return nil
+	}
+	if cfg.BlobStore == nil {
+		return fmt.Errorf("Message %s was published by reference but no BlobStore is configured", m.MessageID())
+	}
+	body, err := cfg.BlobStore.Get(m.Context(), key)
+	if err != nil {
+		return err
+	}
+	h := cloneTable(m.HeaderTable())
+	delete(h, ClaimCheckHeader)
+	m.Delivery.Headers = h
+	m.Body = body
+	return nil
+}
@@ -0,0 +1,46 @@
+package amqphelper
+
+import "time"
+
+//Clock is the source of time for timestamps, tickers, timeouts, rate windows, backoff and the scheduling done by pollers, redrivers and breakers. Set Configuration.Clock to a fake one, like amqphelpertest.FakeClock, to drive them in tests without sleeping
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+//Ticker delivers ticks on C like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+//SystemClock is the Clock backed by the time package, used when none is configured
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) NewTicker(d time.Duration) Ticker       { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
+
+//Clock returns Configuration.Clock, or SystemClock when it is not set
+func (q *Queue) Clock() Clock {
+	if c := q.config(); c != nil && c.Clock != nil {
+		return c.Clock
+	}
+	return SystemClock
+}
+
+//Clock returns the Clock of the queue the message was consumed from, SystemClock for messages of no queue
+func (m *Message) Clock() Clock {
+	if m == nil || m.queue == nil {
+		return SystemClock
+	}
+	return m.queue.Clock()
+}
@@ -0,0 +1,267 @@
+package amqphelper
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//CloudEventMode selects how a CloudEvent is mapped onto an AMQP message
+type CloudEventMode int
+
+const (
+	//CloudEventBinary carries attributes in AMQP headers and the data as the message body
+	CloudEventBinary CloudEventMode = iota
+	//CloudEventStructured carries the whole event as an application/cloudevents+json body
+	CloudEventStructured
+)
+
+const (
+	cloudEventsSpecVersion  = "1.0"
+	cloudEventsContentType  = "application/cloudevents+json"
+	cloudEventsHeaderPrefix = "cloudEvents:"
+)
+
+//CloudEvent is a CloudEvents 1.0 event
+type CloudEvent struct {
+	ID              string
+	Source          string
+	SpecVersion     string
+	Type            string
+	DataContentType string
+	DataSchema      string
+	Subject         string
+	Time            time.Time
+	Extensions      map[string]interface{}
+	Data            []byte
+}
+
+func isJSONContentType(ct string) bool {
+	if ct == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")
+}
+
+//PublishCloudEvent publishes the event in binary or structured mode, filling SpecVersion, ID and Time when empty
+func (q *Queue) PublishCloudEvent(e CloudEvent, mode CloudEventMode, mandatory, immediate bool) error {
+	msg, err := cloudEventPublishing(e, mode, q.Clock())
+	if err != nil {
+		return err
+	}
+	return q.publish(context.Background(), msg, mandatory, immediate)
+}
+
+//cloudEventPublishing maps the event onto the message PublishCloudEvent sends, with clock for an empty Time
+func cloudEventPublishing(e CloudEvent, mode CloudEventMode, clock Clock) (amqp.Publishing, error) {
+	if e.SpecVersion == "" {
+		e.SpecVersion = cloudEventsSpecVersion
+	}
+	if e.ID == "" {
+		e.ID = newUUID()
+	}
+	if e.Time.IsZero() {
+		e.Time = clock.Now().UTC()
+	}
+	if e.Source == "" || e.Type == "" {
+		return amqp.Publishing{}, fmt.Errorf("CloudEvent source and type are required")
+	}
+
+	msg := amqp.Publishing{MessageId: e.ID, Type: e.Type}
+
+	if mode == CloudEventStructured {
+		body, err := e.MarshalJSON()
+		if err != nil {
+			return amqp.Publishing{}, err
+		}
+		msg.ContentType = cloudEventsContentType
+		msg.Body = body
+		return msg, nil
+	}
+
+	h := amqp.Table{
+		cloudEventsHeaderPrefix + "specversion": e.SpecVersion,
+		cloudEventsHeaderPrefix + "id":          e.ID,
+		cloudEventsHeaderPrefix + "source":      e.Source,
+		cloudEventsHeaderPrefix + "type":        e.Type,
+		cloudEventsHeaderPrefix + "time":        e.Time,
+	}
+	if e.DataSchema != "" {
+		h[cloudEventsHeaderPrefix+"dataschema"] = e.DataSchema
+	}
+	if e.Subject != "" {
+		h[cloudEventsHeaderPrefix+"subject"] = e.Subject
+	}
+	for k, v := range e.Extensions {
+		h[cloudEventsHeaderPrefix+k] = v
+	}
+	msg.Headers = h
+	msg.ContentType = e.DataContentType
+	msg.Body = e.Data
+	return msg, nil
+}
+
+//MarshalJSON encodes the event in the CloudEvents JSON format, using data_base64 for non JSON payloads
+func (e CloudEvent) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{}
+	for k, v := range e.Extensions {
+		m[k] = v
+	}
+	m["specversion"] = e.SpecVersion
+	m["id"] = e.ID
+	m["source"] = e.Source
+	m["type"] = e.Type
+	if !e.Time.IsZero() {
+		m["time"] = e.Time.Format(time.RFC3339Nano)
+	}
+	if e.DataContentType != "" {
+		m["datacontenttype"] = e.DataContentType
+	}
+	if e.DataSchema != "" {
+		m["dataschema"] = e.DataSchema
+	}
+	if e.Subject != "" {
+		m["subject"] = e.Subject
+	}
+	if e.Data != nil {
+		if isJSONContentType(e.DataContentType) && json.Valid(e.Data) {
+			m["data"] = json.RawMessage(e.Data)
+		} else {
+			m["data_base64"] = base64.StdEncoding.EncodeToString(e.Data)
+		}
+	}
+	return json.Marshal(m)
+}
+
+//UnmarshalJSON decodes an event in the CloudEvents JSON format
+func (e *CloudEvent) UnmarshalJSON(b []byte) error {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*e = CloudEvent{}
+	str := func(k string) (string, error) {
+		v, ok := raw[k]
+		if !ok {
+			return "", nil
+		}
+		delete(raw, k)
+		var s string
+		err := json.Unmarshal(v, &s)
+		return s, err
+	}
+	var err error
+	var t string
+	for k, dst := range map[string]*string{"specversion": &e.SpecVersion, "id": &e.ID, "source": &e.Source, "type": &e.Type, "datacontenttype": &e.DataContentType, "dataschema": &e.DataSchema, "subject": &e.Subject, "time": &t} {
+		if *dst, err = str(k); err != nil {
+			return fmt.Errorf("CloudEvent attribute %s: %v", k, err)
+		}
+	}
+	if t != "" {
+		if e.Time, err = time.Parse(time.RFC3339Nano, t); err != nil {
+			return err
+		}
+	}
+	if d, ok := raw["data_base64"]; ok {
+		delete(raw, "data_base64")
+		var s string
+		if err = json.Unmarshal(d, &s); err != nil {
+			return err
+		}
+		if e.Data, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return err
+		}
+	} else if d, ok := raw["data"]; ok {
+		delete(raw, "data")
+		e.Data = []byte(d)
+	}
+	for k, v := range raw {
+		var x interface{}
+		if err = json.Unmarshal(v, &x); err != nil {
+			return err
+		}
+		if e.Extensions == nil {
+			e.Extensions = map[string]interface{}{}
+		}
+		e.Extensions[k] = x
+	}
+	return nil
+}
+
+func cloudEventHeader(h amqp.Table, name string) (interface{}, bool) {
+	if v, ok := h[cloudEventsHeaderPrefix+name]; ok {
+		return v, true
+	}
+	v, ok := h["cloudEvents_"+name]
+	return v, ok
+}
+
+//AsCloudEvent reads the delivery as a CloudEvent in either structured or binary mode
+func (m *Message) AsCloudEvent() (*CloudEvent, error) {
+	if mt, _, err := mime.ParseMediaType(m.ContentType); err == nil && mt == cloudEventsContentType {
+		e := CloudEvent{}
+		if err := json.Unmarshal(m.Body, &e); err != nil {
+			return nil, err
+		}
+		return &e, nil
+	}
+
+	if _, ok := cloudEventHeader(m.HeaderTable(), "specversion"); !ok {
+		return nil, fmt.Errorf("Message is not a CloudEvent")
+	}
+
+	e := CloudEvent{DataContentType: m.ContentType, Data: m.Body}
+	for k, v := range m.HeaderTable() {
+		var name string
+		switch {
+		case strings.HasPrefix(k, cloudEventsHeaderPrefix):
+			name = k[len(cloudEventsHeaderPrefix):]
+		case strings.HasPrefix(k, "cloudEvents_"):
+			name = k[len("cloudEvents_"):]
+		default:
+			continue
+		}
+		s, _ := v.(string)
+		switch name {
+		case "specversion":
+			e.SpecVersion = s
+		case "id":
+			e.ID = s
+		case "source":
+			e.Source = s
+		case "type":
+			e.Type = s
+		case "dataschema":
+			e.DataSchema = s
+		case "subject":
+			e.Subject = s
+		case "time":
+			switch t := v.(type) {
+			case time.Time:
+				e.Time = t
+			case string:
+				pt, err := time.Parse(time.RFC3339Nano, t)
+				if err != nil {
+					return nil, err
+				}
+				e.Time = pt
+			}
+		default:
+			if e.Extensions == nil {
+				e.Extensions = map[string]interface{}{}
+			}
+			e.Extensions[name] = v
+		}
+	}
+	return &e, nil
+}
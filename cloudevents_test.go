@@ -0,0 +1,210 @@
+package amqphelper
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//fixedClock is a Clock stopped at one instant, for what stamps the time of a message
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time                         { return c.now }
+func (c fixedClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (c fixedClock) NewTicker(d time.Duration) Ticker       { return SystemClock.NewTicker(d) }
+
+var eventTime = time.Date(2024, 5, 1, 12, 30, 0, 500, time.UTC)
+
+func orderEvent() CloudEvent {
+	return CloudEvent{
+		ID:              "1",
+		Source:          "/orders",
+		SpecVersion:     "1.0",
+		Type:            "order.created",
+		DataContentType: "application/json",
+		DataSchema:      "https://example.com/order.json",
+		Subject:         "order-1",
+		Time:            eventTime,
+		Extensions:      map[string]interface{}{"tenant": "acme"},
+		Data:            []byte(`{"id":1}`),
+	}
+}
+
+//TestCloudEventPublishing maps events onto messages in both modes, body is the data the message carries, the event JSON for structured mode
+func TestCloudEventPublishing(t *testing.T) {
+	minimal := CloudEvent{ID: "2", Source: "/orders", Type: "order.created"}
+	binaryData := orderEvent()
+	binaryData.DataContentType, binaryData.Data = "application/octet-stream", []byte{0xff, 0x00}
+	invalidJSON := orderEvent()
+	invalidJSON.Data = []byte("{")
+	for _, c := range []struct {
+		name    string
+		event   CloudEvent
+		mode    CloudEventMode
+		headers amqp.Table
+		ct      string
+		body    map[string]interface{}
+		ok      bool
+	}{
+		{"binary", orderEvent(), CloudEventBinary, amqp.Table{
+			"cloudEvents:specversion": "1.0",
+			"cloudEvents:id":          "1",
+			"cloudEvents:source":      "/orders",
+			"cloudEvents:type":        "order.created",
+			"cloudEvents:time":        eventTime,
+			"cloudEvents:dataschema":  "https://example.com/order.json",
+			"cloudEvents:subject":     "order-1",
+			"cloudEvents:tenant":      "acme",
+		}, "application/json", nil, true},
+		{"binary defaults", minimal, CloudEventBinary, amqp.Table{
+			"cloudEvents:specversion": "1.0",
+			"cloudEvents:id":          "2",
+			"cloudEvents:source":      "/orders",
+			"cloudEvents:type":        "order.created",
+			"cloudEvents:time":        eventTime,
+		}, "", nil, true},
+		{"structured", orderEvent(), CloudEventStructured, nil, cloudEventsContentType, map[string]interface{}{
+			"specversion":     "1.0",
+			"id":              "1",
+			"source":          "/orders",
+			"type":            "order.created",
+			"time":            eventTime.Format(time.RFC3339Nano),
+			"datacontenttype": "application/json",
+			"dataschema":      "https://example.com/order.json",
+			"subject":         "order-1",
+			"tenant":          "acme",
+			"data":            map[string]interface{}{"id": float64(1)},
+		}, true},
+		{"structured binary data", binaryData, CloudEventStructured, nil, cloudEventsContentType, map[string]interface{}{
+			"specversion":     "1.0",
+			"id":              "1",
+			"source":          "/orders",
+			"type":            "order.created",
+			"time":            eventTime.Format(time.RFC3339Nano),
+			"datacontenttype": "application/octet-stream",
+			"dataschema":      "https://example.com/order.json",
+			"subject":         "order-1",
+			"tenant":          "acme",
+			"data_base64":     base64.StdEncoding.EncodeToString([]byte{0xff, 0x00}),
+		}, true},
+		{"structured invalid JSON", invalidJSON, CloudEventStructured, nil, cloudEventsContentType, map[string]interface{}{
+			"specversion":     "1.0",
+			"id":              "1",
+			"source":          "/orders",
+			"type":            "order.created",
+			"time":            eventTime.Format(time.RFC3339Nano),
+			"datacontenttype": "application/json",
+			"dataschema":      "https://example.com/order.json",
+			"subject":         "order-1",
+			"tenant":          "acme",
+			"data_base64":     base64.StdEncoding.EncodeToString([]byte("{")),
+		}, true},
+		{"no source", CloudEvent{Type: "order.created"}, CloudEventBinary, nil, "", nil, false},
+		{"no type", CloudEvent{Source: "/orders"}, CloudEventStructured, nil, "", nil, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			msg, err := cloudEventPublishing(c.event, c.mode, fixedClock{eventTime})
+			if (err == nil) != c.ok {
+				t.Fatalf("cloudEventPublishing returned %v, want success %v", err, c.ok)
+			}
+			if !c.ok {
+				return
+			}
+			if msg.MessageId != c.event.ID || msg.Type != c.event.Type || msg.ContentType != c.ct {
+				t.Errorf("message id %q, type %q, content type %q", msg.MessageId, msg.Type, msg.ContentType)
+			}
+			if !reflect.DeepEqual(msg.Headers, c.headers) {
+				t.Errorf("headers %v, want %v", msg.Headers, c.headers)
+			}
+			if c.body == nil {
+				if string(msg.Body) != string(c.event.Data) {
+					t.Errorf("body %q, want the data %q", msg.Body, c.event.Data)
+				}
+				return
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(msg.Body, &body); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(body, c.body) {
+				t.Errorf("body %v, want %v", body, c.body)
+			}
+		})
+	}
+}
+
+func TestCloudEventGeneratedID(t *testing.T) {
+	msg, err := cloudEventPublishing(CloudEvent{Source: "/orders", Type: "order.created"}, CloudEventBinary, fixedClock{eventTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := msg.Headers["cloudEvents:id"].(string)
+	if id == "" || id != msg.MessageId {
+		t.Errorf("generated id %q, message id %q", id, msg.MessageId)
+	}
+}
+
+//TestAsCloudEvent reads what cloudEventPublishing maps back into the event, and events published by other libraries in their header spellings
+func TestAsCloudEvent(t *testing.T) {
+	binaryData := orderEvent()
+	binaryData.DataContentType, binaryData.Data = "application/octet-stream", []byte{0xff, 0x00}
+	q := newQueue(&Configuration{})
+	for _, c := range []struct {
+		name  string
+		event CloudEvent
+		mode  CloudEventMode
+	}{
+		{"binary", orderEvent(), CloudEventBinary},
+		{"structured", orderEvent(), CloudEventStructured},
+		{"structured binary data", binaryData, CloudEventStructured},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			msg, err := cloudEventPublishing(c.event, c.mode, fixedClock{eventTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := q.newMessage(context.Background(), amqp.Delivery{Headers: msg.Headers, ContentType: msg.ContentType, Body: msg.Body})
+			got, err := m.AsCloudEvent()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, c.event) {
+				t.Errorf("read %+v, want %+v", *got, c.event)
+			}
+		})
+	}
+
+	for _, c := range []struct {
+		name    string
+		headers amqp.Table
+		want    *CloudEvent
+	}{
+		{"underscore headers", amqp.Table{
+			"cloudEvents_specversion": "1.0",
+			"cloudEvents_id":          "3",
+			"cloudEvents_source":      "/orders",
+			"cloudEvents_type":        "order.created",
+			"cloudEvents_time":        eventTime.Format(time.RFC3339Nano),
+		}, &CloudEvent{ID: "3", Source: "/orders", SpecVersion: "1.0", Type: "order.created", Time: eventTime, Data: []byte("data")}},
+		{"not an event", amqp.Table{"x-trace": "1"}, nil},
+		{"bad time", amqp.Table{"cloudEvents:specversion": "1.0", "cloudEvents:time": "yesterday"}, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			m := q.newMessage(context.Background(), amqp.Delivery{Headers: c.headers, Body: []byte("data")})
+			got, err := m.AsCloudEvent()
+			if (err == nil) != (c.want != nil) {
+				t.Fatalf("AsCloudEvent returned %v, want an event %v", err, c.want != nil)
+			}
+			if c.want != nil && !reflect.DeepEqual(got, c.want) {
+				t.Errorf("read %+v, want %+v", *got, *c.want)
+			}
+		})
+	}
+}
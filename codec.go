@@ -0,0 +1,125 @@
+package amqphelper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Codec marshals and unmarshals message bodies for a single content type
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+//JSONCodec encodes message bodies as application/json
+type JSONCodec struct{}
+
+//ContentType returns the content type set on messages marshaled by the codec
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+//Marshal encodes v as JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+//Unmarshal decodes JSON data into v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type codecRegistry struct {
+	sync.RWMutex
+	m map[string]Codec
+}
+
+func (r *codecRegistry) get(mediaType string) (Codec, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	c, ok := r.m[mediaType]
+	return c, ok
+}
+
+func (r *codecRegistry) set(contentType string, c Codec) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	r.Lock()
+	defer r.Unlock()
+	if r.m == nil {
+		r.m = map[string]Codec{}
+	}
+	r.m[mt] = c
+}
+
+var codecs = &codecRegistry{m: map[string]Codec{
+	"application/json":    JSONCodec{},
+	"application/msgpack": MsgpackCodec{},
+}}
+
+//RegisterCodec makes c available to every queue for the content type, replacing any codec previously registered for it
+func RegisterCodec(contentType string, c Codec) {
+	codecs.set(contentType, c)
+}
+
+//RegisterCodec makes c available to this queue only for the content type, taking precedence over codecs registered with the package level RegisterCodec
+func (q *Queue) RegisterCodec(contentType string, c Codec) {
+	q.codecs.set(contentType, c)
+}
+
+//codecFor looks up the codec for a content type in the queue's registry and then the package registry, a nil queue only uses the latter
+func (q *Queue) codecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		return JSONCodec{}, nil
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if q != nil {
+		if c, ok := q.codecs.get(mt); ok {
+			return c, nil
+		}
+	}
+	if c, ok := codecs.get(mt); ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("No codec registered for content type %s", mt)
+}
+
+//Codec returns the codec used for publishing objects: Configuration.Codec, else the one registered for Configuration.ContentType, else JSON
+func (q *Queue) Codec() Codec {
+	cfg := q.config()
+	if cfg.Codec != nil {
+		return cfg.Codec
+	}
+	if cfg.ContentType != "" {
+		if c, err := q.codecFor(cfg.ContentType); err == nil {
+			return c
+		}
+	}
+	return JSONCodec{}
+}
+
+//PublishObject marshals v with the configured Codec, or the one registered for the configured ContentType (JSON by default), and publishes it with the codec's content type
+func (q *Queue) PublishObject(v interface{}, headers map[string]interface{}, mandatory, immediate bool) error {
+	return q.publishObject(context.Background(), v, headers, mandatory, immediate)
+}
+
+func (q *Queue) publishObject(ctx context.Context, v interface{}, headers map[string]interface{}, mandatory, immediate bool) error {
+	c := q.Codec()
+	body, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return q.publish(ctx, amqp.Publishing{ContentType: c.ContentType(), ContentEncoding: q.config().ContentEncoding, Body: body, Headers: headers}, mandatory, immediate)
+}
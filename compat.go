@@ -0,0 +1,27 @@
+package amqphelper
+
+import amqp "github.com/rabbitmq/amqp091-go"
+
+//The package is built on github.com/rabbitmq/amqp091-go, the maintained fork of github.com/streadway/amqp. These aliases name the types of its API, so callers don't need to import the amqp library themselves and are shielded from another change of it
+
+//Publishing is a message as published, see PublishTo
+type Publishing = amqp.Publishing
+
+//Delivery is a message as received, embedded in Message
+type Delivery = amqp.Delivery
+
+//Table holds headers and arguments
+type Table = amqp.Table
+
+//Return is a message returned by the broker, carried by ReturnError
+type Return = amqp.Return
+
+//Confirmation is the broker's ack or nack of a confirmed publish
+type Confirmation = amqp.Confirmation
+
+const (
+	//Transient is the delivery mode of messages that don't survive a broker restart
+	Transient = amqp.Transient
+	//Persistent is the delivery mode of messages written to disk on durable queues
+	Persistent = amqp.Persistent
+)
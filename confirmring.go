@@ -0,0 +1,74 @@
+package amqphelper
+
+//confirmRing tracks the results waiting for a confirmation by delivery tag in a fixed size ring, so adding, resolving and failing them never allocates or searches. Tags are added in increasing order and fit as long as the oldest outstanding one is less than the ring's size behind the newest
+type confirmRing struct {
+	slots []confirmSlot
+	mask  uint64
+	//head is the oldest tag that may be outstanding and tail the one after the newest
+	head, tail uint64
+	count      int
+}
+
+type confirmSlot struct {
+	tag    uint64
+	result chan error
+}
+
+//newConfirmRing returns a ring of at least size slots, rounded up to a power of two
+func newConfirmRing(size int) *confirmRing {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return &confirmRing{slots: make([]confirmSlot, n), mask: uint64(n - 1)}
+}
+
+//add waits for tag's confirmation on result, reporting false when the ring is full
+func (r *confirmRing) add(tag uint64, result chan error) bool {
+	if r.count > 0 && tag-r.head >= uint64(len(r.slots)) {
+		return false
+	}
+	if r.count == 0 {
+		r.head = tag
+	}
+	r.slots[tag&r.mask] = confirmSlot{tag, result}
+	r.tail = tag + 1
+	r.count++
+	return true
+}
+
+//resolve removes and returns the result waiting for tag, false when there is none, for instance the late confirmation of a publish that timed out
+func (r *confirmRing) resolve(tag uint64) (chan error, bool) {
+	if r.count == 0 || tag < r.head || tag >= r.tail {
+		return nil, false
+	}
+	s := &r.slots[tag&r.mask]
+	if s.result == nil || s.tag != tag {
+		return nil, false
+	}
+	result := s.result
+	*s = confirmSlot{}
+	r.count--
+	for r.count > 0 && r.slots[r.head&r.mask].result == nil {
+		r.head++
+	}
+	return result, true
+}
+
+//drain removes every outstanding result, passing it to f in tag order
+func (r *confirmRing) drain(f func(result chan error)) {
+	for tag := r.head; r.count > 0 && tag < r.tail; tag++ {
+		s := &r.slots[tag&r.mask]
+		if s.result != nil && s.tag == tag {
+			f(s.result)
+			*s = confirmSlot{}
+			r.count--
+		}
+	}
+	r.head, r.count = r.tail, 0
+}
+
+//len returns the number of outstanding results
+func (r *confirmRing) len() int {
+	return r.count
+}
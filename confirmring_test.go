@@ -0,0 +1,92 @@
+package amqphelper
+
+import (
+	"errors"
+	"testing"
+)
+
+//ringOp is an add, ack or nack of tag, ok being what the ring should report, or a fail of every outstanding result
+type ringOp struct {
+	op  string
+	tag uint64
+	ok  bool
+}
+
+//TestConfirmRing drives a ring of 4 slots the way publishBatch does. The client library splits multiple confirmations into one per tag, in order. outcomes are those of the adds in order, pending for the ones still outstanding
+func TestConfirmRing(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		ops      []ringOp
+		outcomes []string
+	}{
+		{"in order", []ringOp{{"add", 1, true}, {"add", 2, true}, {"ack", 1, true}, {"ack", 2, true}}, []string{"ack", "ack"}},
+		{"out of order", []ringOp{{"add", 1, true}, {"add", 2, true}, {"add", 3, true}, {"ack", 3, true}, {"ack", 1, true}, {"ack", 2, true}}, []string{"ack", "ack", "ack"}},
+		{"multiple", []ringOp{{"add", 1, true}, {"add", 2, true}, {"add", 3, true}, {"ack", 1, true}, {"ack", 2, true}, {"nack", 3, true}}, []string{"ack", "ack", "nack"}},
+		{"nacked", []ringOp{{"add", 1, true}, {"add", 2, true}, {"nack", 2, true}, {"nack", 2, false}}, []string{"pending", "nack"}},
+		{"late confirmation", []ringOp{{"add", 5, true}, {"ack", 4, false}, {"ack", 6, false}, {"ack", 5, true}, {"ack", 5, false}}, []string{"ack"}},
+		{"overflow", []ringOp{{"add", 1, true}, {"add", 2, true}, {"add", 3, true}, {"add", 4, true}, {"add", 5, false}, {"ack", 1, true}, {"add", 5, true}, {"add", 6, false}}, []string{"ack", "pending", "pending", "pending", "pending"}},
+		{"overflow behind an outstanding tag", []ringOp{{"add", 1, true}, {"add", 2, true}, {"ack", 2, true}, {"add", 5, false}, {"ack", 1, true}, {"add", 5, true}}, []string{"ack", "ack", "pending"}},
+		{"fail", []ringOp{{"add", 1, true}, {"add", 2, true}, {"add", 3, true}, {"ack", 2, true}, {"fail", 0, true}, {"ack", 3, false}}, []string{"failed", "ack", "failed"}},
+		{"recovery sequence reset", []ringOp{{"add", 7, true}, {"add", 8, true}, {"ack", 7, true}, {"fail", 0, true}, {"add", 1, true}, {"add", 2, true}, {"ack", 8, false}, {"ack", 2, true}, {"ack", 1, true}}, []string{"ack", "failed", "ack", "ack"}},
+		{"tags behind a reset", []ringOp{{"add", 7, true}, {"add", 1, false}}, []string{"pending"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := newConfirmRing(4)
+			var added []chan error
+			for i, op := range c.ops {
+				switch op.op {
+				case "add":
+					result := make(chan error, 1)
+					if ok := r.add(op.tag, result); ok != op.ok {
+						t.Fatalf("op %d: add(%d) = %v, want %v", i, op.tag, ok, op.ok)
+					}
+					if op.ok {
+						added = append(added, result)
+					}
+				case "ack", "nack":
+					result, ok := r.resolve(op.tag)
+					if ok != op.ok {
+						t.Fatalf("op %d: resolve(%d) = %v, want %v", i, op.tag, ok, op.ok)
+					}
+					if !ok {
+						continue
+					}
+					if op.op == "ack" {
+						result <- nil
+					} else {
+						result <- ErrPublishNacked
+					}
+				case "fail":
+					r.drain(func(result chan error) { result <- ErrChannelClosed })
+				}
+			}
+
+			pending := 0
+			for i, result := range added {
+				got := "pending"
+				select {
+				case err := <-result:
+					switch {
+					case err == nil:
+						got = "ack"
+					case errors.Is(err, ErrPublishNacked):
+						got = "nack"
+					default:
+						got = "failed"
+					}
+				default:
+					pending++
+				}
+				if i >= len(c.outcomes) || got != c.outcomes[i] {
+					t.Errorf("add %d: got %s, want %v", i, got, c.outcomes)
+				}
+			}
+			if len(added) != len(c.outcomes) {
+				t.Errorf("%d adds succeeded, want %d", len(added), len(c.outcomes))
+			}
+			if r.len() != pending {
+				t.Errorf("len() = %d with %d results pending", r.len(), pending)
+			}
+		})
+	}
+}
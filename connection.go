@@ -0,0 +1,249 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Connection is an AMQP connection shared by the publishers and consumers opened on it, each on a channel of its own, so a service needs a single connection for all its queues. Once it closed, the first of them to recover dials it again
+type Connection struct {
+	config Configuration
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	//external connections are managed by the application, they are never dialed or closed
+	external bool
+}
+
+//Dial connects to host, of opts only the connection settings (TLS, heartbeat, logger and clock) apply to the connection itself
+func Dial(host string, opts ...Option) (*Connection, error) {
+	return DialContext(context.Background(), host, opts...)
+}
+
+//DialContext is Dial giving up when ctx is done
+func DialContext(ctx context.Context, host string, opts ...Option) (*Connection, error) {
+	c := &Connection{config: Configuration{Host: host}}
+	for _, opt := range opts {
+		opt(&c.config)
+	}
+	if _, err := c.get(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//get returns the live connection, dialing again when it was closed
+func (c *Connection) get(ctx context.Context) (*amqp.Connection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil && !c.conn.IsClosed() {
+		return c.conn, nil
+	}
+	if c.external {
+		return nil, fmt.Errorf("%w: the application's connection is closed", ErrChannelClosed)
+	}
+	conn, err := dial(ctx, &c.config)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+//Close closes the connection and with it every publisher and consumer opened on it
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil || c.external {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+//open returns a Queue on its own channel of the connection, config's connection settings are replaced by the connection's unless it is external
+func (c *Connection) open(config *Configuration) (*Queue, error) {
+	if config == nil {
+		return nil, fmt.Errorf("Configuration is nil")
+	}
+	cfg := *config
+	if !c.external {
+		cfg.Host, cfg.TLSConfig, cfg.Heartbeat = c.config.Host, c.config.TLSConfig, c.config.Heartbeat
+		if cfg.Logger == nil {
+			cfg.Logger = c.config.Logger
+		}
+		if cfg.Clock == nil {
+			cfg.Clock = c.config.Clock
+		}
+	}
+	if cfg.Strict {
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	q := newQueue(&cfg)
+	q.shared = c
+	if err := q.connect(context.Background()); err != nil {
+		if q.channel != nil {
+			q.channel.Close()
+		}
+		return nil, err
+	}
+	return q, nil
+}
+
+//GetQueueWithConnection returns a queue declared on a channel of conn, for applications managing their own connection with custom dialing, TLS or instrumentation. config's connection settings are not used, Close only closes the queue's channel and Recover opens a new channel on conn but never redials it, once conn is closed it fails with ErrChannelClosed
+func GetQueueWithConnection(conn *amqp.Connection, config *Configuration) (*Queue, error) {
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+	c := &Connection{conn: conn, external: true}
+	return c.open(config)
+}
+
+//Publisher opens a publisher on the connection for a copy of config made PublishOnly, so no queue is declared. ExchangeType still declares the exchange
+func (c *Connection) Publisher(config *Configuration) (*QueuePublisher, error) {
+	cfg := *config
+	cfg.PublishOnly = true
+	q, err := c.open(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &QueuePublisher{q}, nil
+}
+
+//Consumer opens a consumer on the connection, declaring and binding config's queue
+func (c *Connection) Consumer(config *Configuration) (*QueueConsumer, error) {
+	q, err := c.open(config)
+	if err != nil {
+		return nil, err
+	}
+	return &QueueConsumer{q}, nil
+}
+
+//QueuePublisher is the publishing half of a Queue, with its publish middleware, confirmations and recovery but no consumer state
+type QueuePublisher struct {
+	q *Queue
+}
+
+var _ Publisher = (*QueuePublisher)(nil)
+
+//Publish publishes to the configured exchange and routing key, see Queue.Publish
+func (p *QueuePublisher) Publish(message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
+	return p.q.Publish(message, headers, mandatory, immediate)
+}
+
+//PublishWithContext publishes like Publish propagating ctx's trace context, see Queue.PublishWithContext
+func (p *QueuePublisher) PublishWithContext(ctx context.Context, message []byte, headers map[string]interface{}, mandatory, immediate bool) error {
+	return p.q.PublishWithContext(ctx, message, headers, mandatory, immediate)
+}
+
+//PublishTo publishes msg to exchange and routing key, see Queue.PublishTo
+func (p *QueuePublisher) PublishTo(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+	return p.q.PublishTo(ctx, exchange, routingKey, msg, mandatory, immediate)
+}
+
+//AsyncPublish enqueues a publish to the configured exchange and routing key, see Queue.AsyncPublish
+func (p *QueuePublisher) AsyncPublish(ctx context.Context, message []byte, headers map[string]interface{}, mandatory, immediate bool) <-chan error {
+	return p.q.AsyncPublish(ctx, message, headers, mandatory, immediate)
+}
+
+//FanOut publishes body to many routing keys concurrently, see Queue.FanOut
+func (p *QueuePublisher) FanOut(ctx context.Context, routingKeys []string, body []byte, parallelism int) error {
+	return p.q.FanOut(ctx, routingKeys, body, parallelism)
+}
+
+//NewPublication returns a pooled Publication, see Queue.NewPublication
+func (p *QueuePublisher) NewPublication(body []byte) *Publication {
+	return p.q.NewPublication(body)
+}
+
+//PublishReuse publishes a Publication in place, see Queue.PublishReuse
+func (p *QueuePublisher) PublishReuse(ctx context.Context, pub *Publication) error {
+	return p.q.PublishReuse(ctx, pub)
+}
+
+//Flush waits for the enqueued publishes, see Queue.Flush
+func (p *QueuePublisher) Flush(ctx context.Context) error {
+	return p.q.Flush(ctx)
+}
+
+//UsePublish appends publish middleware, see Queue.UsePublish
+func (p *QueuePublisher) UsePublish(mw ...PublishMiddleware) {
+	p.q.UsePublish(mw...)
+}
+
+//Stats returns the publisher's counters
+func (p *QueuePublisher) Stats() QueueStats {
+	return p.q.Stats()
+}
+
+//Queue returns the Queue behind the publisher, for the helpers built on it
+func (p *QueuePublisher) Queue() *Queue {
+	return p.q
+}
+
+//Close closes the publisher's channel, the connection stays open
+func (p *QueuePublisher) Close() error {
+	return p.q.Close()
+}
+
+//QueueConsumer is the consuming half of a Queue, with its middleware, prefetch and consumer lifecycle
+type QueueConsumer struct {
+	q *Queue
+}
+
+var _ Consumer = (*QueueConsumer)(nil)
+
+//SpawnWorkers starts consumers running f, see Queue.SpawnWorkers
+func (c *QueueConsumer) SpawnWorkers(consumerPrefix string, consumers int, f func(m *Message)) error {
+	return c.q.SpawnWorkers(consumerPrefix, consumers, f)
+}
+
+//KeepRunning blocks until every consumer stopped
+//
+//Deprecated: use Run
+func (c *QueueConsumer) KeepRunning() {
+	c.q.KeepRunning()
+}
+
+//Run blocks while the consumers run, see Queue.Run
+func (c *QueueConsumer) Run(ctx context.Context) error {
+	return c.q.Run(ctx)
+}
+
+//Shutdown stops the consumers gracefully and closes the channel, see Queue.Shutdown
+func (c *QueueConsumer) Shutdown(ctx context.Context) error {
+	return c.q.Shutdown(ctx)
+}
+
+//Use appends consumer middleware, see Queue.Use
+func (c *QueueConsumer) Use(mw ...Middleware) {
+	c.q.Use(mw...)
+}
+
+//CancelConsumer stops the consumer with the given tag
+func (c *QueueConsumer) CancelConsumer(tag string) error {
+	return c.q.CancelConsumer(tag)
+}
+
+//Name returns the name of the consumed queue
+func (c *QueueConsumer) Name() string {
+	return c.q.Name()
+}
+
+//Stats returns the consumer's counters
+func (c *QueueConsumer) Stats() QueueStats {
+	return c.q.Stats()
+}
+
+//Queue returns the Queue behind the consumer, for the helpers built on it
+func (c *QueueConsumer) Queue() *Queue {
+	return c.q
+}
+
+//Close closes the consumer's channel, which stops its consumers, the connection stays open
+func (c *QueueConsumer) Close() error {
+	return c.q.Close()
+}
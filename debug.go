@@ -0,0 +1,51 @@
+package amqphelper
+
+import (
+	"sync"
+	"time"
+)
+
+//DefaultDebugRateLimit is the number of debug entries logged per second when Configuration.DebugRateLimit is 0
+const DefaultDebugRateLimit = 100
+
+type debugLimiter struct {
+	sync.Mutex
+	window     time.Time
+	count      int
+	suppressed int
+}
+
+//allow reports whether another entry fits in the current one second window, and how many were suppressed in the previous one
+func (l *debugLimiter) allow(now time.Time, limit int) (bool, int) {
+	if limit <= 0 {
+		limit = DefaultDebugRateLimit
+	}
+	l.Lock()
+	defer l.Unlock()
+	dropped := 0
+	if now.Sub(l.window) >= time.Second {
+		dropped = l.suppressed
+		l.window, l.count, l.suppressed = now, 0, 0
+	}
+	if l.count >= limit {
+		l.suppressed++
+		return false, 0
+	}
+	l.count++
+	return true, dropped
+}
+
+//debug logs wire level details when Configuration.Debug is set, at most DebugRateLimit entries per second
+func (q *Queue) debug(msg string, fields ...Field) {
+	cfg := q.config()
+	if !cfg.Debug {
+		return
+	}
+	ok, dropped := q.debugLimiter.allow(q.Clock().Now(), cfg.DebugRateLimit)
+	if dropped > 0 {
+		q.logger().Debug("Debug entries suppressed", F("count", dropped))
+	}
+	if ok {
+		q.logger().Debug(msg, fields...)
+	}
+}
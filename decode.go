@@ -0,0 +1,126 @@
+package amqphelper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var decoders = map[string]func(r io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": func(r io.Reader) (io.ReadCloser, error) {
+		return flate.NewReader(r), nil
+	},
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+//DefaultMaxDecodedSize is how many bytes a compressed body may decompress to when Configuration.MaxDecodedSize is 0
+const DefaultMaxDecodedSize = 64 << 20
+
+//maxDecodedSize returns the configured limit, a negative one for none
+func (q *Queue) maxDecodedSize() int {
+	max := 0
+	if q != nil {
+		max = q.config().MaxDecodedSize
+	}
+	if max == 0 {
+		return DefaultMaxDecodedSize
+	}
+	return max
+}
+
+//decodeBody undoes contentEncoding, failing with ErrBodyTooLarge once the decoded body is over max bytes unless max is negative
+func decodeBody(body []byte, contentEncoding string, max int) ([]byte, error) {
+	enc := strings.ToLower(strings.TrimSpace(contentEncoding))
+	if enc == "" || enc == "identity" || enc == "utf-8" {
+		return body, nil
+	}
+	d, ok := decoders[enc]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported content encoding %s", enc)
+	}
+	r, err := d(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if max < 0 {
+		return io.ReadAll(r)
+	}
+	decoded, err := io.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > max {
+		return nil, fmt.Errorf("%w: %s body is over %d bytes", ErrBodyTooLarge, enc, max)
+	}
+	return decoded, nil
+}
+
+//Decode unmarshals the message body into v using the codec matching the delivery's ContentType, after decrypting it and undoing any ContentEncoding
+func (m *Message) Decode(v any) error {
+	c, err := m.queue.codecFor(m.ContentType)
+	if err != nil {
+		return err
+	}
+	body, err := m.payload()
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(body, v)
+}
+
+//Payload returns the body decrypted with the queue's KeyProvider and decompressed according to ContentEncoding
+func (m *Message) Payload() ([]byte, error) {
+	return m.payload()
+}
+
+func (m *Message) payload() ([]byte, error) {
+	body := m.Body
+	if _, ok := m.HeaderTable()[EncryptionHeader]; ok {
+		var kp KeyProvider
+		if m.queue != nil {
+			kp = m.queue.config().KeyProvider
+		}
+		var err error
+		if body, err = decrypt(kp, m.HeaderTable(), body); err != nil {
+			return nil, err
+		}
+	}
+	return decodeBody(body, m.ContentEncoding, m.queue.maxDecodedSize())
+}
+
+//Decompress returns a Middleware that replaces gzip, deflate or zstd encoded bodies with their decompressed form and clears ContentEncoding before the handler runs. Encrypted messages are left untouched since Decode handles them. Register it after VerifySignatures so signatures are checked against the body as published
+func Decompress() Middleware {
+	return func(next func(m *Message)) func(m *Message) {
+		return func(m *Message) {
+			if _, ok := decoders[strings.ToLower(strings.TrimSpace(m.ContentEncoding))]; ok {
+				if _, encrypted := m.HeaderTable()[EncryptionHeader]; !encrypted {
+					body, err := decodeBody(m.Body, m.ContentEncoding, m.queue.maxDecodedSize())
+					if err != nil {
+						m.logger().Warn("Could not decompress message", m.fields(F("error", err))...)
+						m.queue.reportError(ErrorScopeDecode, err)
+						m.reject()
+						return
+					}
+					m.Body = body
+					m.ContentEncoding = ""
+				}
+			}
+			next(m)
+		}
+	}
+}
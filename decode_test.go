@@ -0,0 +1,100 @@
+package amqphelper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var encoders = map[string]func(w io.Writer) (io.WriteCloser, error){
+	"gzip": func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	"deflate": func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.DefaultCompression)
+	},
+	"zstd": func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+}
+
+func encode(t *testing.T, body []byte, encoding string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := encoders[encoding](&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(body); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+//TestDecodeBody compresses a body and decodes it under limits around its size. The limit applies to the decoded body, which compresses to far less
+func TestDecodeBody(t *testing.T) {
+	body := bytes.Repeat([]byte("amqphelper "), 1000)
+	for _, c := range []struct {
+		name string
+		max  int
+		err  error
+	}{
+		{"within", len(body) + 1, nil},
+		{"at", len(body), nil},
+		{"over", len(body) - 1, ErrBodyTooLarge},
+		{"unlimited", -1, nil},
+	} {
+		for encoding := range encoders {
+			t.Run(c.name+"/"+encoding, func(t *testing.T) {
+				encoded := encode(t, body, encoding)
+				got, err := decodeBody(encoded, encoding, c.max)
+				if !errors.Is(err, c.err) {
+					t.Fatalf("decodeBody returned %v, want %v", err, c.err)
+				}
+				if err == nil && !bytes.Equal(got, body) {
+					t.Errorf("decoded %d bytes different from the %d encoded", len(got), len(body))
+				}
+			})
+		}
+	}
+}
+
+//TestPayloadLimit decodes through Payload with the queue's MaxDecodedSize, which leaves uncompressed bodies alone
+func TestPayloadLimit(t *testing.T) {
+	body := bytes.Repeat([]byte{0}, 1<<16)
+	for _, c := range []struct {
+		name string
+		max  int
+		err  error
+	}{
+		{"default", 0, nil},
+		{"configured", 1 << 10, ErrBodyTooLarge},
+		{"identity", 1 << 10, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			q := newQueue(&Configuration{MaxDecodedSize: c.max})
+			d := amqp.Delivery{Body: body}
+			if c.name != "identity" {
+				d.Body, d.ContentEncoding = encode(t, body, "gzip"), "gzip"
+			}
+			m := q.newMessage(context.Background(), d)
+			got, err := m.Payload()
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Payload returned %v, want %v", err, c.err)
+			}
+			if err == nil && !bytes.Equal(got, body) {
+				t.Errorf("Payload returned %d bytes, want %d", len(got), len(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package amqphelper
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+//Depth returns the number of ready messages and consumers the broker reports for the queue
+func (q *Queue) Depth() (messages, consumers int, err error) {
+	if q.connection == nil {
+		return 0, 0, ErrNotConnected
+	}
+	iq, err := q.inspect()
+	if err != nil {
+		return 0, 0, err
+	}
+	return iq.Messages, iq.Consumers, nil
+}
+
+//DepthCrossing describes the queue depth moving across a threshold between two polls
+type DepthCrossing struct {
+	Threshold int
+	Messages  int
+	Consumers int
+	Rising    bool
+}
+
+//PollDepth spawns a goroutine polling Depth every interval until ctx is done, calling f for every threshold the message count crossed since the previous poll. Polling errors are logged and the previous depth is kept
+func (q *Queue) PollDepth(ctx context.Context, interval time.Duration, thresholds []int, f func(c DepthCrossing)) {
+	ts := append([]int(nil), thresholds...)
+	sort.Ints(ts)
+	go func() {
+		t := q.Clock().NewTicker(interval)
+		defer t.Stop()
+		prev := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C():
+			}
+			messages, consumers, err := q.Depth()
+			if err != nil {
+				q.logger().Warn("Could not poll queue depth", F("queue", q.config().RoutingKey), F("error", err))
+				continue
+			}
+			for _, th := range ts {
+				switch {
+				case prev < th && messages >= th:
+					f(DepthCrossing{Threshold: th, Messages: messages, Consumers: consumers, Rising: true})
+				case prev >= th && messages < th:
+					f(DepthCrossing{Threshold: th, Messages: messages, Consumers: consumers, Rising: false})
+				}
+			}
+			prev = messages
+		}
+	}()
+}
@@ -0,0 +1,96 @@
+package amqphelper
+
+import "fmt"
+
+//Dispatcher routes deliveries to handlers registered per message type, read from the Type property, a header or the Envelope the body carries
+type Dispatcher struct {
+	//TypeHeader names the header carrying the message type, when empty the Type property is used
+	TypeHeader string
+	//Envelopes makes the dispatcher decode bodies as Envelopes, using their Type and passing their Data to handlers
+	Envelopes bool
+	//Fallback receives messages with a missing or unregistered type. When nil they are logged and rejected, so they reach the dead letter exchange if the queue has one
+	Fallback func(m *Message)
+
+	handlers map[string]func(m *Message, e *Envelope) error
+}
+
+//NewDispatcher returns an empty Dispatcher
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{handlers: map[string]func(m *Message, e *Envelope) error{}}
+}
+
+type decodeError struct {
+	error
+}
+
+//On registers f for messages of type messageType on the dispatcher, decoding them into T with the codec for their content type
+func On[T any](d *Dispatcher, messageType string, f func(v T, m *Message) error) {
+	d.handlers[messageType] = func(m *Message, e *Envelope) error {
+		var v T
+		var err error
+		if e != nil {
+			err = e.DecodeData(&v)
+		} else {
+			err = m.Decode(&v)
+		}
+		if err != nil {
+			return decodeError{err}
+		}
+		return f(v, m)
+	}
+}
+
+func (d *Dispatcher) messageType(m *Message) (string, *Envelope, error) {
+	if d.Envelopes {
+		e := Envelope{}
+		if err := m.Decode(&e); err != nil {
+			return "", nil, err
+		}
+		e.codec, _ = m.queue.codecFor(m.ContentType)
+		return e.Type, &e, nil
+	}
+	if d.TypeHeader != "" {
+		t, _ := GetStringHeader(m.HeaderTable(), d.TypeHeader)
+		return t, nil, nil
+	}
+	return m.Type, nil, nil
+}
+
+//Dispatch decodes the message and invokes the handler registered for its type, it can be passed directly to SpawnWorkers. Messages are acknowledged when the handler returns nil and rejected without requeue when it fails or they can't be decoded, so handlers must not acknowledge them themselves
+func (d *Dispatcher) Dispatch(m *Message) {
+	t, e, err := d.messageType(m)
+	if err != nil {
+		m.logger().Warn("Could not decode envelope", m.fields(F("error", err))...)
+		m.queue.reportError(ErrorScopeDecode, err)
+		m.reject()
+		return
+	}
+	h, ok := d.handlers[t]
+	if !ok {
+		if d.Fallback != nil {
+			d.Fallback(m)
+			return
+		}
+		m.logger().Warn("No handler registered for message type", m.fields(F("type", t))...)
+		m.queue.reportError(ErrorScopeValidation, fmt.Errorf("No handler registered for message type %q", t))
+		m.reject()
+		return
+	}
+
+	err = h(m, e)
+	if de, ok := err.(decodeError); ok {
+		m.logger().Warn("Could not decode message", m.fields(F("type", t), F("error", de.error))...)
+		m.queue.reportError(ErrorScopeDecode, de.error)
+		m.reject()
+		return
+	}
+	if err != nil {
+		m.logger().Error("Handler failed", m.fields(F("type", t), F("error", err))...)
+		m.queue.reportError(ErrorScopeConsume, err)
+		m.reject()
+		return
+	}
+	if m.queue == nil || !m.queue.config().AutoAcknowledgeMessages {
+		m.Ack(false)
+	}
+}
@@ -0,0 +1,119 @@
+package amqphelper
+
+import (
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//DefaultDeadLetterRateWindow is the window dead letter rates are averaged over when Configuration.DeadLetterRateWindow is 0
+const DefaultDeadLetterRateWindow = time.Minute
+
+func (q *Queue) deadLetterRoutingKey() string {
+	cfg := q.config()
+	if cfg.DeadLetterRoutingKey != "" {
+		return cfg.DeadLetterRoutingKey
+	}
+	return cfg.RoutingKey
+}
+
+func (q *Queue) deadLetterQueue() string {
+	cfg := q.config()
+	if cfg.DeadLetterQueue != "" {
+		return cfg.DeadLetterQueue
+	}
+	return cfg.RoutingKey + ".dead"
+}
+
+//queueArguments returns the arguments the queue is declared with, adding dead lettering when Configuration.DeadLetterExchange is set
+func (q *Queue) queueArguments() amqp.Table {
+	cfg := q.config()
+	if cfg.DeadLetterExchange == "" {
+		return cfg.arguments
+	}
+	args := cloneTable(cfg.arguments)
+	args["x-dead-letter-exchange"] = cfg.DeadLetterExchange
+	args["x-dead-letter-routing-key"] = q.deadLetterRoutingKey()
+	return args
+}
+
+//declareDeadLetter declares the dead letter exchange and a durable queue bound to it that receives the queue's rejected messages
+func (q *Queue) declareDeadLetter() error {
+	cfg := q.config()
+	err := q.channel.ExchangeDeclare(cfg.DeadLetterExchange, amqp.ExchangeDirect, true, false, false, cfg.NoWait, nil)
+	if err != nil {
+		return err
+	}
+	_, err = q.channel.QueueDeclare(q.deadLetterQueue(), true, false, false, cfg.NoWait, nil)
+	if err != nil {
+		return err
+	}
+	return q.channel.QueueBind(q.deadLetterQueue(), q.deadLetterRoutingKey(), cfg.DeadLetterExchange, cfg.NoWait, nil)
+}
+
+type rateCounter struct {
+	sync.Mutex
+	counts  []int64
+	seconds []int64
+	tripped bool
+}
+
+func (r *rateCounter) add(t time.Time, window time.Duration) float64 {
+	n := int(window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	now := t.Unix()
+	if len(r.counts) != n {
+		r.counts = make([]int64, n)
+		r.seconds = make([]int64, n)
+	}
+	i := int(now % int64(n))
+	if r.seconds[i] != now {
+		r.seconds[i] = now
+		r.counts[i] = 0
+	}
+	r.counts[i]++
+	var total int64
+	for j := range r.counts {
+		if now-r.seconds[j] < int64(n) {
+			total += r.counts[j]
+		}
+	}
+	return float64(total) / float64(n)
+}
+
+//OnDeadLetterThreshold registers f to be called when the rate of messages dead lettered by this client, in messages per second averaged over Configuration.DeadLetterRateWindow, rises above Configuration.DeadLetterRateLimit. It is called once per excursion and rearmed when a later dead letter finds the rate back under the limit
+func (q *Queue) OnDeadLetterThreshold(f func(rate float64)) {
+	q.deadLetters.Lock()
+	q.onDeadLetterThreshold = f
+	q.deadLetters.Unlock()
+}
+
+//deadLettered counts a message rejected without requeue on a queue with a dead letter exchange
+func (q *Queue) deadLettered() {
+	cfg := q.config()
+	if cfg.DeadLetterExchange == "" || cfg.DeadLetterRateLimit <= 0 {
+		return
+	}
+	window := cfg.DeadLetterRateWindow
+	if window == 0 {
+		window = DefaultDeadLetterRateWindow
+	}
+	q.deadLetters.Lock()
+	rate := q.deadLetters.add(q.Clock().Now(), window)
+	var f func(rate float64)
+	if rate > cfg.DeadLetterRateLimit {
+		if !q.deadLetters.tripped {
+			q.deadLetters.tripped = true
+			f = q.onDeadLetterThreshold
+		}
+	} else {
+		q.deadLetters.tripped = false
+	}
+	q.deadLetters.Unlock()
+	if f != nil {
+		f(rate)
+	}
+}
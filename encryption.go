@@ -0,0 +1,97 @@
+package amqphelper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	//EncryptionHeader marks an encrypted body and names the algorithm used
+	EncryptionHeader = "x-encryption"
+	//EncryptionKeyHeader carries the id of the key the body was encrypted with
+	EncryptionKeyHeader = "x-encryption-key-id"
+
+	encryptionAlgorithm = "aes-gcm"
+)
+
+//KeyProvider supplies AES keys (16, 24 or 32 bytes) for payload encryption. CurrentKey is used on publish and Key looks up the key a message was encrypted with
+type KeyProvider interface {
+	CurrentKey() (id string, key []byte, err error)
+	Key(id string) ([]byte, error)
+}
+
+//StaticKeyProvider is a KeyProvider over a fixed key set, Current names the key used for publishing
+type StaticKeyProvider struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+//CurrentKey returns the key used for publishing
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	k, err := p.Key(p.Current)
+	return p.Current, k, err
+}
+
+//Key returns the key with the given id
+func (p *StaticKeyProvider) Key(id string) ([]byte, error) {
+	k, ok := p.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("Unknown encryption key %q", id)
+	}
+	return k, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+func (q *Queue) encrypt(msg *amqp.Publishing) error {
+	id, key, err := q.config().KeyProvider.CurrentKey()
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(msg.Body)+gcm.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	h := cloneTable(msg.Headers)
+	h[EncryptionHeader] = encryptionAlgorithm
+	h[EncryptionKeyHeader] = id
+	msg.Headers = h
+	msg.Body = gcm.Seal(nonce, nonce, msg.Body, []byte(id))
+	return nil
+}
+
+func decrypt(kp KeyProvider, headers amqp.Table, body []byte) ([]byte, error) {
+	if alg, _ := headers[EncryptionHeader].(string); alg != encryptionAlgorithm {
+		return nil, fmt.Errorf("Unsupported encryption %q", alg)
+	}
+	if kp == nil {
+		return nil, fmt.Errorf("Message is encrypted but no KeyProvider is configured")
+	}
+	id, _ := headers[EncryptionKeyHeader].(string)
+	key, err := kp.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < gcm.NonceSize() {
+		return nil, fmt.Errorf("Encrypted body is too short")
+	}
+	return gcm.Open(nil, body[:gcm.NonceSize()], body[gcm.NonceSize():], []byte(id))
+}
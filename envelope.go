@@ -0,0 +1,93 @@
+package amqphelper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Envelope is a standard wrapper carrying event metadata alongside the payload
+type Envelope struct {
+	ID      string      `json:"id" msgpack:"id"`
+	Type    string      `json:"type" msgpack:"type"`
+	Source  string      `json:"source,omitempty" msgpack:"source,omitempty"`
+	Time    time.Time   `json:"time" msgpack:"time"`
+	TraceID string      `json:"traceId,omitempty" msgpack:"traceId,omitempty"`
+	Data    interface{} `json:"data" msgpack:"data"`
+	codec   Codec
+}
+
+//DecodeData unmarshals the envelope payload into v
+func (e *Envelope) DecodeData(v interface{}) error {
+	c := e.codec
+	if c == nil {
+		c = JSONCodec{}
+	}
+	b, err := c.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(b, v)
+}
+
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	hex.Encode(s[9:13], b[4:6])
+	hex.Encode(s[14:18], b[6:8])
+	hex.Encode(s[19:23], b[8:10])
+	hex.Encode(s[24:], b[10:])
+	s[8], s[13], s[18], s[23] = '-', '-', '-', '-'
+	return string(s[:])
+}
+
+//PublishEvent wraps the event in an Envelope, filling ID and Time when empty, and publishes it with the configured Codec
+func (q *Queue) PublishEvent(e Envelope, headers map[string]interface{}, mandatory, immediate bool) error {
+	return q.PublishEventContext(context.Background(), e, headers, mandatory, immediate)
+}
+
+//PublishEventContext is PublishEvent with a context, which also fills an empty TraceID from the trace context ctx carries and is injected into the message headers
+func (q *Queue) PublishEventContext(ctx context.Context, e Envelope, headers map[string]interface{}, mandatory, immediate bool) error {
+	if e.TraceID == "" {
+		if tc, ok := TraceContextFromContext(ctx); ok {
+			e.TraceID = tc.TraceID()
+		}
+	}
+	if e.ID == "" {
+		e.ID = newUUID()
+	}
+	if e.Time.IsZero() {
+		e.Time = q.Clock().Now().UTC()
+	}
+	c := q.Codec()
+	body, err := c.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return q.publish(ctx, amqp.Publishing{ContentType: c.ContentType(), ContentEncoding: q.config().ContentEncoding, Body: body, Headers: headers, MessageId: e.ID, Type: e.Type}, mandatory, immediate)
+}
+
+//ConsumeEvent spawns consumers like SpawnWorkers and passes each decoded Envelope to the argument function. Messages that can't be decoded are logged and rejected
+func (q *Queue) ConsumeEvent(consumerPrefix string, consumers int, f func(e *Envelope, m *Message)) error {
+	return q.SpawnWorkers(consumerPrefix, consumers, func(m *Message) {
+		e := Envelope{}
+		err := m.Decode(&e)
+		if err != nil {
+			m.logger().Warn("Could not decode envelope", m.fields(F("error", err))...)
+			q.reportError(ErrorScopeDecode, err)
+			m.reject()
+			return
+		}
+		e.codec, _ = q.codecFor(m.ContentType)
+		f(&e, m)
+	})
+}
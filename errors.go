@@ -0,0 +1,90 @@
+package amqphelper
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//ErrorScope tells which part of the queue an error passed to OnError callbacks comes from
+type ErrorScope string
+
+const (
+	//ErrorScopePublish covers publishes that failed or were nacked
+	ErrorScopePublish ErrorScope = "publish"
+	//ErrorScopeReturn covers messages returned by the broker, the error is a *ReturnError
+	ErrorScopeReturn ErrorScope = "return"
+	//ErrorScopeConsume covers consumers that couldn't start, were cancelled by the broker or whose handler failed
+	ErrorScopeConsume ErrorScope = "consume"
+	//ErrorScopeDecode covers messages that couldn't be decrypted, decompressed or unmarshaled
+	ErrorScopeDecode ErrorScope = "decode"
+	//ErrorScopeValidation covers messages rejected by signature, schema or content type checks
+	ErrorScopeValidation ErrorScope = "validation"
+	//ErrorScopeRecover covers failed connection recoveries
+	ErrorScopeRecover ErrorScope = "recover"
+)
+
+var (
+	//ErrNotConnected is returned by operations on a queue without a connection or channel, and wraps dial failures
+	ErrNotConnected = fmt.Errorf("Queue has not been initialized")
+	//ErrChannelClosed wraps errors from publishing or consuming on a channel or connection that was closed
+	ErrChannelClosed = fmt.Errorf("Channel is closed")
+	//ErrPublishNacked is returned by confirmed publishes the broker nacked
+	ErrPublishNacked = fmt.Errorf("Message was nacked by the broker")
+	//ErrConfirmTimeout is returned by confirmed publishes whose confirmation didn't arrive within Configuration.ConfirmTimeout. The message may still have been routed
+	ErrConfirmTimeout = fmt.Errorf("Timed out waiting for the broker's confirmation")
+	//ErrQueueMismatch wraps the broker refusing to declare a queue or exchange that exists with different arguments
+	ErrQueueMismatch = fmt.Errorf("Queue exists with different arguments")
+	//ErrBodyTooLarge is returned when a compressed body decompresses to more than Configuration.MaxDecodedSize
+	ErrBodyTooLarge = fmt.Errorf("Decoded body is too large")
+)
+
+//wrapError marks amqp errors with the sentinel matching their reply code, so callers can use errors.Is. Other errors are returned as is
+func wrapError(err error) error {
+	var ae *amqp.Error
+	if !errors.As(err, &ae) {
+		return err
+	}
+	switch ae.Code {
+	case amqp.ChannelError, amqp.ConnectionForced:
+		return fmt.Errorf("%w: %w", ErrChannelClosed, err)
+	case amqp.PreconditionFailed:
+		return fmt.Errorf("%w: %w", ErrQueueMismatch, err)
+	}
+	return err
+}
+
+//ReturnError wraps a message returned by the broker as unroutable or undeliverable
+type ReturnError struct {
+	Return amqp.Return
+}
+
+func (e *ReturnError) Error() string {
+	return fmt.Sprintf("Message %s returned by the broker: %d %s", e.Return.MessageId, e.Return.ReplyCode, e.Return.ReplyText)
+}
+
+type errorCallbacks struct {
+	sync.RWMutex
+	fs []func(scope ErrorScope, err error)
+}
+
+//OnError registers f to be called for every error the queue handles internally, callbacks run synchronously on the goroutine that hit the error so they should return quickly
+func (q *Queue) OnError(f func(scope ErrorScope, err error)) {
+	q.errorCallbacks.Lock()
+	q.errorCallbacks.fs = append(q.errorCallbacks.fs, f)
+	q.errorCallbacks.Unlock()
+}
+
+func (q *Queue) reportError(scope ErrorScope, err error) {
+	if q == nil || err == nil {
+		return
+	}
+	q.errorCallbacks.RLock()
+	fs := q.errorCallbacks.fs
+	q.errorCallbacks.RUnlock()
+	for _, f := range fs {
+		f(scope, err)
+	}
+}
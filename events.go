@@ -0,0 +1,157 @@
+package amqphelper
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//EventType identifies a connection or channel lifecycle event
+type EventType string
+
+const (
+	//EventConnected is recorded when a connection and channel are established
+	EventConnected EventType = "connected"
+	//EventConnectionClosed is recorded when the connection closes, Code and Reason carry the amqp.Error if any
+	EventConnectionClosed EventType = "connection_closed"
+	//EventChannelClosed is recorded when the channel closes, Code and Reason carry the amqp.Error if any
+	EventChannelClosed EventType = "channel_closed"
+	//EventReconnectAttempt is recorded when Recover starts, Attempt counts recoveries since the queue was created
+	EventReconnectAttempt EventType = "reconnect_attempt"
+	//EventReconnectFailed is recorded when a recovery fails, Reason carries the error
+	EventReconnectFailed EventType = "reconnect_failed"
+	//EventConsumerCancelled is recorded when the broker cancels a consumer, for instance because its queue was deleted
+	EventConsumerCancelled EventType = "consumer_cancelled"
+	//EventSlowConsumer is recorded when handlers exceed Configuration.SlowHandlerThreshold, or deliveries find the DeliveryBuffer full, for a whole window. Reason carries the last duration or "delivery buffer full"
+	EventSlowConsumer EventType = "slow_consumer"
+	//EventSlowConsumerRecovered is recorded after EventSlowConsumer once handlers run under the threshold and deliveries fit in the buffer again
+	EventSlowConsumerRecovered EventType = "slow_consumer_recovered"
+	//EventHeartbeatMissed is recorded when the connection closes because the broker stopped answering heartbeats
+	EventHeartbeatMissed EventType = "heartbeat_missed"
+	//EventLatencyAnomaly is recorded when a MonitorLatency probe exceeds its threshold, Reason carries the round trip time
+	EventLatencyAnomaly EventType = "latency_anomaly"
+	//EventConfigApplied is recorded when a Configuration passed to UpdateConfig is swapped in before connecting
+	EventConfigApplied EventType = "config_applied"
+	//EventPrefetchAdjusted is recorded when TunePrefetch changes the prefetch count, Reason carries the old and new counts
+	EventPrefetchAdjusted EventType = "prefetch_adjusted"
+	//EventBackpressure is recorded when a consumer's Configuration.DeliveryBuffer is full, Reason carries the policy applied
+	EventBackpressure EventType = "backpressure"
+	//EventBackpressureResumed is recorded when a consumer paused by BackpressurePause consumes again
+	EventBackpressureResumed EventType = "backpressure_resumed"
+)
+
+//DefaultEventJournalSize is the number of events kept when Configuration.EventJournalSize is 0
+const DefaultEventJournalSize = 100
+
+//Event is an entry of the queue's lifecycle journal
+type Event struct {
+	Time     time.Time
+	Type     EventType
+	Code     int
+	Reason   string
+	Attempt  int64
+	Consumer string
+}
+
+type journal struct {
+	sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+func (j *journal) add(size int, e Event) {
+	if size <= 0 {
+		size = DefaultEventJournalSize
+	}
+	j.Lock()
+	defer j.Unlock()
+	if len(j.events) != size {
+		j.events = make([]Event, size)
+		j.next, j.full = 0, false
+	}
+	j.events[j.next] = e
+	j.next = (j.next + 1) % size
+	if j.next == 0 {
+		j.full = true
+	}
+}
+
+func (j *journal) snapshot() []Event {
+	j.Lock()
+	defer j.Unlock()
+	if !j.full {
+		return append([]Event(nil), j.events[:j.next]...)
+	}
+	return append(append([]Event(nil), j.events[j.next:]...), j.events[:j.next]...)
+}
+
+func (q *Queue) record(e Event) {
+	e.Time = q.Clock().Now()
+	q.journal.add(q.config().EventJournalSize, e)
+}
+
+//Events returns the most recent lifecycle events, oldest first
+func (q *Queue) Events() []Event {
+	return q.journal.snapshot()
+}
+
+func closeEvent(t EventType, err *amqp.Error) Event {
+	e := Event{Type: t}
+	if err != nil {
+		e.Code = err.Code
+		e.Reason = err.Reason
+	}
+	return e
+}
+
+//watch records close and cancel notifications for a freshly opened connection and channel
+func (q *Queue) watch(conn *amqp.Connection, ch *amqp.Channel) {
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	cancelled := ch.NotifyCancel(make(chan string, 1))
+	go func() {
+		for connClosed != nil || chClosed != nil || cancelled != nil {
+			select {
+			case err, ok := <-connClosed:
+				if !ok {
+					connClosed = nil
+					continue
+				}
+				q.record(closeEvent(EventConnectionClosed, err))
+				q.stats.disconnected(q.Clock().Now(), false, err)
+				if isHeartbeatTimeout(err) {
+					q.heartbeatMissed()
+				}
+			case err, ok := <-chClosed:
+				if !ok {
+					chClosed = nil
+					continue
+				}
+				q.record(closeEvent(EventChannelClosed, err))
+				q.stats.disconnected(q.Clock().Now(), true, err)
+			case tag, ok := <-cancelled:
+				if !ok {
+					cancelled = nil
+					continue
+				}
+				q.logger().Warn("Consumer cancelled by the broker", F("queue", q.config().RoutingKey), F("consumer", tag))
+				q.reportError(ErrorScopeConsume, fmt.Errorf("Consumer %s cancelled by the broker", tag))
+				q.record(Event{Type: EventConsumerCancelled, Consumer: tag})
+			}
+		}
+	}()
+}
+
+func (q *Queue) recordReconnect() int64 {
+	n := atomic.AddInt64(&q.reconnects, 1)
+	q.record(Event{Type: EventReconnectAttempt, Attempt: n})
+	return n
+}
+
+func (q *Queue) reconnectCount() int64 {
+	return atomic.LoadInt64(&q.reconnects)
+}
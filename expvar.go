@@ -0,0 +1,112 @@
+package amqphelper
+
+import (
+	"expvar"
+	"time"
+)
+
+//ExpvarMetrics implements Metrics with counters published through expvar as the amqphelper.<queue> map, visible on /debug/vars
+type ExpvarMetrics struct {
+	vars *expvar.Map
+}
+
+//NewExpvarMetrics publishes the counters for the named queue, calling it again with the same name reuses the existing map
+func NewExpvarMetrics(queue string) *ExpvarMetrics {
+	name := "amqphelper." + queue
+	if m, ok := expvar.Get(name).(*expvar.Map); ok {
+		return &ExpvarMetrics{m}
+	}
+	return &ExpvarMetrics{expvar.NewMap(name)}
+}
+
+//Published counts a publish attempt
+func (e *ExpvarMetrics) Published(err error) {
+	if err != nil {
+		e.vars.Add("publish_errors", 1)
+		return
+	}
+	e.vars.Add("published", 1)
+}
+
+//Confirmed counts a publisher confirm
+func (e *ExpvarMetrics) Confirmed(ack bool) {
+	if ack {
+		e.vars.Add("confirmed", 1)
+		return
+	}
+	e.vars.Add("confirm_nacks", 1)
+}
+
+//Returned counts a returned message
+func (e *ExpvarMetrics) Returned() {
+	e.vars.Add("returned", 1)
+}
+
+//Consumed counts a delivery
+func (e *ExpvarMetrics) Consumed() {
+	e.vars.Add("consumed", 1)
+}
+
+//Acked counts an acknowledgement
+func (e *ExpvarMetrics) Acked() {
+	e.vars.Add("acked", 1)
+}
+
+//Nacked counts a nack or reject
+func (e *ExpvarMetrics) Nacked(requeue bool) {
+	e.vars.Add("nacked", 1)
+	if requeue {
+		e.vars.Add("requeued", 1)
+	}
+}
+
+//HandlerDuration adds the handler time to a running total in microseconds
+func (e *ExpvarMetrics) HandlerDuration(d time.Duration) {
+	e.vars.Add("handler_microseconds", d.Microseconds())
+}
+
+//Reconnected counts a recovery attempt
+func (e *ExpvarMetrics) Reconnected() {
+	e.vars.Add("reconnects", 1)
+}
+
+//BrokerLatency sets broker_latency_microseconds to the last round trip
+func (e *ExpvarMetrics) BrokerLatency(d time.Duration) {
+	v := new(expvar.Int)
+	v.Set(d.Microseconds())
+	e.vars.Set("broker_latency_microseconds", v)
+}
+
+//HeartbeatMissed counts a heartbeat timeout
+func (e *ExpvarMetrics) HeartbeatMissed() {
+	e.vars.Add("heartbeat_timeouts", 1)
+}
+
+//Lag sets depth, consume_rate and time_to_drain_seconds, -1 while the queue isn't draining
+func (e *ExpvarMetrics) Lag(depth int, consumeRate float64, timeToDrain time.Duration) {
+	d, r, t := new(expvar.Int), new(expvar.Float), new(expvar.Float)
+	d.Set(int64(depth))
+	r.Set(consumeRate)
+	t.Set(DrainSeconds(timeToDrain))
+	e.vars.Set("depth", d)
+	e.vars.Set("consume_rate", r)
+	e.vars.Set("time_to_drain_seconds", t)
+}
+
+//SlowConsumer sets slow_consumer to 1 or 0
+func (e *ExpvarMetrics) SlowConsumer(slow bool) {
+	v := new(expvar.Int)
+	if slow {
+		v.Set(1)
+	}
+	e.vars.Set("slow_consumer", v)
+}
+
+//ConnectionState sets connected to 1 or 0
+func (e *ExpvarMetrics) ConnectionState(connected bool) {
+	v := new(expvar.Int)
+	if connected {
+		v.Set(1)
+	}
+	e.vars.Set("connected", v)
+}
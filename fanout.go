@@ -0,0 +1,87 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//FanOutError reports the routing keys FanOut couldn't publish to, with the error of each
+type FanOutError struct {
+	Errors map[string]error
+	Total  int
+}
+
+//fanOutErrorKeys is the number of failed keys Error lists before summarizing the rest
+const fanOutErrorKeys = 5
+
+func (e *FanOutError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for k := range e.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	problems := make([]string, 0, fanOutErrorKeys+1)
+	for i, k := range keys {
+		if i == fanOutErrorKeys {
+			problems = append(problems, fmt.Sprintf("and %d more", len(keys)-i))
+			break
+		}
+		problems = append(problems, fmt.Sprintf("%s: %v", k, e.Errors[k]))
+	}
+	return fmt.Sprintf("Could not publish to %d of %d routing keys: %s", len(e.Errors), e.Total, strings.Join(problems, "; "))
+}
+
+//Unwrap returns the errors of every failed key, so errors.Is finds ErrPublishNacked or ErrConfirmTimeout among them
+func (e *FanOutError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+//FanOut publishes body to the configured exchange once per routing key, up to parallelism at once, for notification blasts to many per user keys. Each message goes through the same stamping, middleware and confirmation as Publish, spread over the channels of Configuration.PublisherChannels when there are any, and parallelism defaults to their number. Every key is attempted unless ctx is done, the failures are returned together as a *FanOutError
+func (q *Queue) FanOut(ctx context.Context, routingKeys []string, body []byte, parallelism int) error {
+	cfg := q.config()
+	if parallelism <= 0 {
+		parallelism = cfg.PublisherChannels
+	}
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	var mu sync.Mutex
+	failed := map[string]error{}
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for _, key := range routingKeys {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			failed[key] = ctx.Err()
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			msg := amqp.Publishing{ContentType: cfg.ContentType, ContentEncoding: cfg.ContentEncoding, Body: body}
+			if err := q.publishTo(ctx, cfg.Exchange, key, msg, false, false); err != nil {
+				mu.Lock()
+				failed[key] = err
+				mu.Unlock()
+			}
+		}(key)
+	}
+	wg.Wait()
+	if len(failed) == 0 {
+		return nil
+	}
+	return &FanOutError{Errors: failed, Total: len(routingKeys)}
+}
@@ -0,0 +1,41 @@
+//Package gcsblob implements amqphelper.BlobStore over Google Cloud Storage. It is a module of its own, so only its importers depend on the Cloud Storage client
+package gcsblob
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+//Store keeps blobs as objects in Bucket, under Prefix
+type Store struct {
+	Client *storage.Client
+	Bucket string
+	Prefix string
+}
+
+//New returns a Store for bucket
+func New(client *storage.Client, bucket, prefix string) *Store {
+	return &Store{Client: client, Bucket: bucket, Prefix: prefix}
+}
+
+//Put uploads data as the object Prefix+key
+func (s *Store) Put(ctx context.Context, key string, data []byte) error {
+	w := s.Client.Bucket(s.Bucket).Object(s.Prefix + key).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+//Get downloads the object Prefix+key
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	r, err := s.Client.Bucket(s.Bucket).Object(s.Prefix + key).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -1,3 +1,16 @@
 module github.com/ermyuriel/amqphelper
 
-go 1.12
+go 1.23
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/rabbitmq/amqp091-go v1.10.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/protobuf v1.36.12
+)
+
+require (
+	github.com/stretchr/testify v1.10.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+)
@@ -0,0 +1,86 @@
+package amqphelper
+
+import (
+	"context"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//handlerSlots bounds the handlers running at once across a queue's consumers to Configuration.MaxConcurrentHandlers, read on every acquisition so a reloaded limit applies to the next handlers. Running handlers over a lowered limit finish, consumers with concurrent handlers keep at least one
+type handlerSlots struct {
+	once    sync.Once
+	mu      sync.Mutex
+	freed   sync.Cond
+	running int
+}
+
+func (s *handlerSlots) init() {
+	s.once.Do(func() { s.freed.L = &s.mu })
+}
+
+func (q *Queue) acquireHandlerSlot() {
+	s := &q.handlerSlots
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.running >= max(q.config().MaxConcurrentHandlers, 1) {
+		s.freed.Wait()
+	}
+	s.running++
+}
+
+func (q *Queue) releaseHandlerSlot() {
+	s := &q.handlerSlots
+	s.mu.Lock()
+	s.running--
+	s.mu.Unlock()
+	s.freed.Broadcast()
+}
+
+//resized wakes the consumers waiting for a slot to check a reloaded limit
+func (s *handlerSlots) resized() {
+	s.init()
+	//taking the lock orders the broadcast after any check against the old limit
+	s.mu.Lock()
+	s.mu.Unlock()
+	s.freed.Broadcast()
+}
+
+//track registers d with the ack batcher, when acknowledgments are batched
+func (q *Queue) track(d *amqp.Delivery) {
+	if q.batchingAcks() {
+		q.acks.delivered(d, ackUnsettled)
+	}
+}
+
+//consume runs f on every delivery of msgs until it is closed, through the DeliveryBuffer if any and recycling the messages with ReuseMessages. Without MaxConcurrentHandlers deliveries are handled one at a time, with it each one is handled on a goroutine of its own once a slot is free, so a consumer stops reading deliveries while the queue's handlers are all busy and the prefetch count flow controls the broker. It returns once the handlers it started returned
+func (q *Queue) consume(ctx context.Context, tag string, msgs <-chan amqp.Delivery, f func(m *Message)) {
+	msgs, received := q.buffer(ctx, tag, msgs)
+	if q.config().MaxConcurrentHandlers <= 0 {
+		for msg := range msgs {
+			received()
+			q.track(&msg)
+			m := q.reusableMessage(ctx, msg)
+			q.handle(f, m)
+			m.recycle()
+		}
+		return
+	}
+	var running sync.WaitGroup
+	for msg := range msgs {
+		received()
+		//tracked before the handler goroutine starts, so deliveries are tracked in the order they are read
+		q.track(&msg)
+		m := q.reusableMessage(ctx, msg)
+		q.acquireHandlerSlot()
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			defer q.releaseHandlerSlot()
+			q.handle(f, m)
+			m.recycle()
+		}()
+	}
+	running.Wait()
+}
@@ -0,0 +1,121 @@
+package amqphelper
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//TestConcurrentHandlersSeeTheirOwnDelivery holds every handler until all of them run, so a delivery shared with the dispatch loop or another handler would be overwritten by the time it is checked. Run it with -race
+func TestConcurrentHandlersSeeTheirOwnDelivery(t *testing.T) {
+	const n = 32
+	for _, c := range []struct {
+		name string
+		cfg  Configuration
+	}{
+		{"copy", Configuration{MaxConcurrentHandlers: n}},
+		{"reuse", Configuration{MaxConcurrentHandlers: n, ReuseMessages: true}},
+		{"buffered", Configuration{MaxConcurrentHandlers: n, DeliveryBuffer: n}},
+		{"bodies", Configuration{MaxConcurrentHandlers: n, CopyBodies: true}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := c.cfg
+			q := newQueue(&cfg)
+			msgs := make(chan amqp.Delivery)
+			bodies := make([][]byte, n)
+			var started sync.WaitGroup
+			started.Add(n)
+			var mu sync.Mutex
+			kept := map[uint64][]byte{}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				q.consume(context.Background(), "test", msgs, func(m *Message) {
+					tag, body := m.Delivery.DeliveryTag, m.Body
+					started.Done()
+					started.Wait()
+					if m.Delivery.DeliveryTag != tag || string(m.Body) != strconv.FormatUint(tag, 10) || string(body) != string(m.Body) {
+						t.Errorf("handler for delivery %d saw delivery %d with body %q", tag, m.Delivery.DeliveryTag, m.Body)
+					}
+					if cfg.CopyBodies {
+						mu.Lock()
+						kept[tag] = m.Body
+						mu.Unlock()
+					}
+				})
+			}()
+			for i := range bodies {
+				tag := uint64(i + 1)
+				bodies[i] = []byte(strconv.FormatUint(tag, 10))
+				msgs <- amqp.Delivery{DeliveryTag: tag, Body: bodies[i]}
+			}
+			close(msgs)
+			<-done
+
+			if !cfg.CopyBodies {
+				return
+			}
+			for _, b := range bodies {
+				for i := range b {
+					b[i] = 'x'
+				}
+			}
+			for tag, b := range kept {
+				if string(b) != strconv.FormatUint(tag, 10) {
+					t.Errorf("body kept for delivery %d changed with the received one: %q", tag, b)
+				}
+			}
+			if len(kept) != n {
+				t.Errorf("kept %d bodies, want %d", len(kept), n)
+			}
+		})
+	}
+}
+
+//TestHandlerSlotsFollowReload raises and lowers MaxConcurrentHandlers while handlers hold every slot
+func TestHandlerSlotsFollowReload(t *testing.T) {
+	q := newQueue(&Configuration{MaxConcurrentHandlers: 1})
+	reload := func(n int) {
+		q.pendingConfig = &Configuration{MaxConcurrentHandlers: n}
+		q.applyPendingConfig()
+	}
+	acquired := make(chan struct{}, 3)
+	acquire := func() {
+		go func() {
+			q.acquireHandlerSlot()
+			acquired <- struct{}{}
+		}()
+	}
+	expect := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case <-acquired:
+			case <-time.After(time.Second):
+				t.Fatalf("slot %d of %d wasn't acquired", i+1, n)
+			}
+		}
+		select {
+		case <-acquired:
+			t.Fatalf("more than %d slots were acquired", n)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	acquire()
+	acquire()
+	expect(1)
+	reload(2)
+	expect(1)
+
+	reload(1)
+	acquire()
+	q.releaseHandlerSlot()
+	expect(0)
+	q.releaseHandlerSlot()
+	expect(1)
+}
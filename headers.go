@@ -0,0 +1,254 @@
+package amqphelper
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//GetHeader looks up a header value by path, descending into nested tables by key and into arrays by index, so GetHeader(h, "retries", "0", "reason") reads h["retries"][0]["reason"]
+func GetHeader(t amqp.Table, path ...string) (interface{}, bool) {
+	var cur interface{} = t
+	for _, p := range path {
+		switch c := cur.(type) {
+		case amqp.Table:
+			v, ok := c[p]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case map[string]interface{}:
+			v, ok := c[p]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			cur = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+//GetStringHeader returns a string header, byte slice values are converted
+func GetStringHeader(t amqp.Table, path ...string) (string, bool) {
+	v, ok := GetHeader(t, path...)
+	if !ok {
+		return "", false
+	}
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case []byte:
+		return string(s), true
+	}
+	return "", false
+}
+
+//GetIntHeader returns an integer header of any AMQP integer width
+func GetIntHeader(t amqp.Table, path ...string) (int64, bool) {
+	v, ok := GetHeader(t, path...)
+	if !ok {
+		return 0, false
+	}
+	switch i := v.(type) {
+	case int:
+		return int64(i), true
+	case int8:
+		return int64(i), true
+	case int16:
+		return int64(i), true
+	case int32:
+		return int64(i), true
+	case int64:
+		return i, true
+	case uint8:
+		return int64(i), true
+	case uint16:
+		return int64(i), true
+	case uint32:
+		return int64(i), true
+	case uint64:
+		if i > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(i), true
+	}
+	return 0, false
+}
+
+//GetFloatHeader returns a floating point header, integer values are converted
+func GetFloatHeader(t amqp.Table, path ...string) (float64, bool) {
+	v, ok := GetHeader(t, path...)
+	if !ok {
+		return 0, false
+	}
+	switch f := v.(type) {
+	case float32:
+		return float64(f), true
+	case float64:
+		return f, true
+	}
+	i, ok := GetIntHeader(t, path...)
+	return float64(i), ok
+}
+
+//GetBoolHeader returns a boolean header
+func GetBoolHeader(t amqp.Table, path ...string) (bool, bool) {
+	v, ok := GetHeader(t, path...)
+	if !ok {
+		return false, false
+	}
+	b, ok := v.(bool)
+	return b, ok
+}
+
+//GetTimeHeader returns a timestamp header
+func GetTimeHeader(t amqp.Table, path ...string) (time.Time, bool) {
+	v, ok := GetHeader(t, path...)
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, ok := v.(time.Time)
+	return ts, ok
+}
+
+//GetTableHeader returns a nested table header
+func GetTableHeader(t amqp.Table, path ...string) (amqp.Table, bool) {
+	v, ok := GetHeader(t, path...)
+	if !ok {
+		return nil, false
+	}
+	switch n := v.(type) {
+	case amqp.Table:
+		return n, true
+	case map[string]interface{}:
+		return amqp.Table(n), true
+	}
+	return nil, false
+}
+
+//GetArrayHeader returns an array header
+func GetArrayHeader(t amqp.Table, path ...string) ([]interface{}, bool) {
+	v, ok := GetHeader(t, path...)
+	if !ok {
+		return nil, false
+	}
+	a, ok := v.([]interface{})
+	return a, ok
+}
+
+//SetHeader stores value at path, the same path GetHeader reads: it descends into nested tables by key, creating the missing ones, and into arrays by index, which must exist. Values are converted to types the AMQP encoder accepts (maps to tables, typed slices to arrays, unsigned and narrow integers to a wider signed type) and an error is returned for values that can't be encoded, or when the path goes through a value that is neither a table nor an array. t must not be nil, a nil table can't be written to
+func SetHeader(t amqp.Table, value interface{}, path ...string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("Header path is empty")
+	}
+	if t == nil {
+		return fmt.Errorf("Header %v: the table is nil", path)
+	}
+	v, err := headerValue(value)
+	if err != nil {
+		return fmt.Errorf("Header %v: %v", path, err)
+	}
+	var cur interface{} = t
+	for i, p := range path {
+		last := i == len(path)-1
+		switch c := cur.(type) {
+		case amqp.Table:
+			cur = setTableHeader(c, p, v, last)
+		case map[string]interface{}:
+			cur = setTableHeader(c, p, v, last)
+		case []interface{}:
+			n, aerr := strconv.Atoi(p)
+			if aerr != nil || n < 0 || n >= len(c) {
+				return fmt.Errorf("Header %v: %q is not an index of the %d element array at %v", path, p, len(c), path[:i])
+			}
+			if last {
+				c[n] = v
+			}
+			cur = c[n]
+		default:
+			return fmt.Errorf("Header %v: the %T at %v is not a table or an array", path, cur, path[:i])
+		}
+	}
+	return nil
+}
+
+//setTableHeader stores v at key when it is the last of the path, otherwise it returns the value there, a new table when there is none
+func setTableHeader(t map[string]interface{}, key string, v interface{}, last bool) interface{} {
+	if last {
+		t[key] = v
+		return v
+	}
+	next, ok := t[key]
+	if !ok {
+		next = amqp.Table{}
+		t[key] = next
+	}
+	return next
+}
+
+func headerValue(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case nil, bool, byte, int, int16, int32, int64, float32, float64, string, []byte, amqp.Decimal, time.Time:
+		return v, nil
+	case int8:
+		return int16(x), nil
+	case uint16:
+		return int32(x), nil
+	case uint32:
+		return int64(x), nil
+	case uint:
+		if uint64(x) > math.MaxInt64 {
+			return nil, fmt.Errorf("value %d overflows int64", x)
+		}
+		return int64(x), nil
+	case uint64:
+		if x > math.MaxInt64 {
+			return nil, fmt.Errorf("value %d overflows int64", x)
+		}
+		return int64(x), nil
+	case []string:
+		a := make([]interface{}, len(x))
+		for i, s := range x {
+			a[i] = s
+		}
+		return a, nil
+	case []interface{}:
+		a := make([]interface{}, len(x))
+		for i, e := range x {
+			ev, err := headerValue(e)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = ev
+		}
+		return a, nil
+	case amqp.Table:
+		return tableValue(x)
+	case map[string]interface{}:
+		return tableValue(x)
+	}
+	return nil, fmt.Errorf("value %T not supported", v)
+}
+
+func tableValue(m map[string]interface{}) (amqp.Table, error) {
+	t := make(amqp.Table, len(m))
+	for k, e := range m {
+		ev, err := headerValue(e)
+		if err != nil {
+			return nil, err
+		}
+		t[k] = ev
+	}
+	return t, nil
+}
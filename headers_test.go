@@ -0,0 +1,90 @@
+package amqphelper
+
+import (
+	"reflect"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//headers is a table like the x-death header RabbitMQ adds, with arrays of tables
+func headers() amqp.Table {
+	return amqp.Table{
+		"count": int32(2),
+		"x-death": []interface{}{
+			amqp.Table{"queue": "jobs", "routing-keys": []interface{}{"jobs.a", "jobs.b"}},
+			map[string]interface{}{"queue": "retries"},
+		},
+		"nested": amqp.Table{"inner": amqp.Table{"leaf": "value"}},
+	}
+}
+
+func TestGetHeader(t *testing.T) {
+	for _, c := range []struct {
+		path []string
+		want interface{}
+		ok   bool
+	}{
+		{[]string{"count"}, int32(2), true},
+		{[]string{"nested", "inner", "leaf"}, "value", true},
+		{[]string{"x-death", "0", "queue"}, "jobs", true},
+		{[]string{"x-death", "0", "routing-keys", "1"}, "jobs.b", true},
+		{[]string{"x-death", "1", "queue"}, "retries", true},
+		{[]string{"x-death", "2", "queue"}, nil, false},
+		{[]string{"x-death", "-1"}, nil, false},
+		{[]string{"x-death", "first"}, nil, false},
+		{[]string{"count", "inner"}, nil, false},
+		{[]string{"missing"}, nil, false},
+	} {
+		got, ok := GetHeader(headers(), c.path...)
+		if ok != c.ok || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("GetHeader(%v) = %v, %v, want %v, %v", c.path, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+//TestSetHeader sets a value and reads it back through GetHeader with the same path, failures must leave the table as it was
+func TestSetHeader(t *testing.T) {
+	for _, c := range []struct {
+		path  []string
+		value interface{}
+		want  interface{}
+		ok    bool
+	}{
+		{[]string{"count"}, 3, 3, true},
+		{[]string{"nested", "inner", "leaf"}, "changed", "changed", true},
+		{[]string{"nested", "other", "leaf"}, uint32(7), int64(7), true},
+		{[]string{"x-death", "0", "queue"}, "moved", "moved", true},
+		{[]string{"x-death", "0", "routing-keys", "1"}, "jobs.c", "jobs.c", true},
+		{[]string{"x-death", "1", "reason"}, "expired", "expired", true},
+		{[]string{"x-death", "1"}, map[string]interface{}{"queue": "other"}, amqp.Table{"queue": "other"}, true},
+		{[]string{"x-death", "2", "queue"}, "jobs", nil, false},
+		{[]string{"x-death", "first"}, "jobs", nil, false},
+		{[]string{"count", "inner"}, "value", nil, false},
+		{[]string{"nested", "inner", "leaf", "deeper"}, "value", nil, false},
+		{[]string{"new"}, struct{}{}, nil, false},
+		{nil, "value", nil, false},
+	} {
+		h := headers()
+		err := SetHeader(h, c.value, c.path...)
+		if (err == nil) != c.ok {
+			t.Errorf("SetHeader(%v) returned %v, want success %v", c.path, err, c.ok)
+			continue
+		}
+		if !c.ok {
+			if !reflect.DeepEqual(h, headers()) {
+				t.Errorf("failed SetHeader(%v) changed the table to %v", c.path, h)
+			}
+			continue
+		}
+		if got, ok := GetHeader(h, c.path...); !ok || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("GetHeader(%v) after SetHeader = %v, %v, want %v", c.path, got, ok, c.want)
+		}
+	}
+}
+
+func TestSetHeaderOnNilTable(t *testing.T) {
+	if err := SetHeader(nil, "value", "key"); err == nil {
+		t.Error("SetHeader on a nil table succeeded")
+	}
+}
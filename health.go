@@ -0,0 +1,76 @@
+package amqphelper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Health is the JSON body written by HealthHandler
+type Health struct {
+	Status            string      `json:"status"`
+	Broker            string      `json:"broker"`
+	Queue             string      `json:"queue"`
+	Workers           int32       `json:"workers"`
+	Consumers         *int        `json:"consumers,omitempty"`
+	Messages          *int        `json:"messages,omitempty"`
+	Reconnects        int64       `json:"reconnects"`
+	ReconnectFailures int64       `json:"reconnect_failures"`
+	SinceConnected    float64     `json:"since_connected_seconds,omitempty"`
+	LastDisconnect    *Disconnect `json:"last_disconnect,omitempty"`
+	Error             string      `json:"error,omitempty"`
+}
+
+func brokerAddress(host string) string {
+	u, err := url.Parse(host)
+	if err != nil {
+		return ""
+	}
+	return u.Host + u.Path
+}
+
+//inspect passively declares the queue on a short lived channel, so a missing queue doesn't close the channel used for publishing and consuming
+func (q *Queue) inspect() (amqp.Queue, error) {
+	cfg := q.config()
+	ch, err := q.connection.Channel()
+	if err != nil {
+		return amqp.Queue{}, wrapError(err)
+	}
+	defer ch.Close()
+	iq, err := ch.QueueDeclarePassive(q.Name(), cfg.Durable, cfg.DeleteIfUnused, cfg.Exclusive, false, q.queueArguments())
+	return iq, wrapError(err)
+}
+
+//HealthHandler returns a handler answering 200 while the queue is connected and 503 otherwise, with a JSON Health body. With Configuration.HealthCheckDeclare the queue is also passively declared on every request, reporting broker side consumer and message counts. Reconnect counts and the last disconnect are always included
+func (q *Queue) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := q.config()
+		h := Health{Status: "ok", Broker: brokerAddress(cfg.Host), Queue: cfg.RoutingKey, Workers: atomic.LoadInt32(q.workers)}
+		s := q.Stats()
+		h.Reconnects, h.ReconnectFailures, h.LastDisconnect = s.Reconnects, s.ReconnectFailures, s.LastDisconnect
+		h.SinceConnected = s.SinceConnected.Seconds()
+		code := http.StatusOK
+
+		if !q.Connected || q.connection == nil || q.connection.IsClosed() {
+			h.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		} else if cfg.HealthCheckDeclare {
+			iq, err := q.inspect()
+			if err != nil {
+				h.Status = "unavailable"
+				h.Error = err.Error()
+				code = http.StatusServiceUnavailable
+			} else {
+				h.Consumers = &iq.Consumers
+				h.Messages = &iq.Messages
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(h)
+	})
+}
@@ -0,0 +1,121 @@
+//Package inbox makes consumption effectively exactly once by recording processed message ids in the same database transaction as the handler's work
+package inbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ermyuriel/amqphelper"
+	"github.com/ermyuriel/amqphelper/outbox"
+)
+
+//DefaultTable is the table SQLStore uses when its Table is empty
+const DefaultTable = "amqp_inbox"
+
+//Store records processed messages inside the handler's transaction
+type Store interface {
+	//Record marks the message id as processed by consumer in tx, returning false when it already was
+	Record(ctx context.Context, tx *sql.Tx, consumer, messageID string) (bool, error)
+}
+
+//SQLStore records message ids in a table with consumer and message_id text columns forming its primary key and a processed_at timestamp column
+type SQLStore struct {
+	Table       string
+	Placeholder outbox.Placeholder
+}
+
+//Record looks the id up and inserts it when missing, processed at the time on the clock of the queue the message was consumed from. A concurrent redelivery committing first makes the insert, and so the handler's transaction, fail on the primary key; the message is then requeued and skipped as a duplicate
+func (s SQLStore) Record(ctx context.Context, tx *sql.Tx, consumer, messageID string) (bool, error) {
+	table, p := s.Table, s.Placeholder
+	if table == "" {
+		table = DefaultTable
+	}
+	if p == nil {
+		p = outbox.Question
+	}
+	var n int
+	err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE consumer = %s AND message_id = %s", table, p(1), p(2)), consumer, messageID).Scan(&n)
+	if err != nil || n > 0 {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (consumer, message_id, processed_at) VALUES (%s, %s, %s)", table, p(1), p(2), p(3)), consumer, messageID, clockFrom(ctx).Now().UTC())
+	return err == nil, err
+}
+
+//clockKey carries the Clock of the message's queue from handle to the store
+type clockKey struct{}
+
+func clockFrom(ctx context.Context) amqphelper.Clock {
+	if c, ok := ctx.Value(clockKey{}).(amqphelper.Clock); ok {
+		return c
+	}
+	return amqphelper.SystemClock
+}
+
+//Inbox runs handlers in a database transaction that also records the message, so redeliveries of processed messages are acked without running the handler again
+type Inbox struct {
+	DB *sql.DB
+	//Store defaults to an SQLStore on DefaultTable with ? placeholders
+	Store Store
+	//Consumer names the handler, so different handlers of the same message are deduplicated separately
+	Consumer string
+}
+
+//New returns an Inbox recording messages processed by consumer with store
+func New(db *sql.DB, store Store, consumer string) *Inbox {
+	return &Inbox{DB: db, Store: store, Consumer: consumer}
+}
+
+func (i *Inbox) store() Store {
+	if i.Store == nil {
+		return SQLStore{}
+	}
+	return i.Store
+}
+
+//Handle returns a consumer function, to pass to SpawnWorkers, running f in a transaction that records the message id. The transaction is committed and the message acked when f returns nil, both are undone and the message requeued when it fails. Duplicates are acked and skipped, messages without a MessageId can't be deduplicated and are always handled
+func (i *Inbox) Handle(f func(ctx context.Context, tx *sql.Tx, m *amqphelper.Message) error) func(m *amqphelper.Message) {
+	return func(m *amqphelper.Message) {
+		ctx := m.Context()
+		err := i.handle(ctx, f, m)
+		if err == errDuplicate {
+			m.Logger().Debug("Skipping message already processed", amqphelper.F("consumer", i.Consumer))
+			m.Ack(false)
+			return
+		}
+		if err != nil {
+			m.Logger().Error("Inbox handler failed", amqphelper.F("consumer", i.Consumer), amqphelper.F("error", err))
+			m.Nack(false, true)
+			return
+		}
+		m.Ack(false)
+	}
+}
+
+var errDuplicate = fmt.Errorf("Message was already processed")
+
+func (i *Inbox) handle(ctx context.Context, f func(ctx context.Context, tx *sql.Tx, m *amqphelper.Message) error, m *amqphelper.Message) error {
+	ctx = context.WithValue(ctx, clockKey{}, m.Clock())
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	//rolls back unless committed, also when f panics
+	defer tx.Rollback()
+	if id := m.MessageID(); id != "" {
+		fresh, err := i.store().Record(ctx, tx, i.Consumer, id)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return errDuplicate
+		}
+	} else {
+		m.Logger().Warn("Message without id can't be deduplicated", amqphelper.F("consumer", i.Consumer))
+	}
+	if err = f(ctx, tx, m); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,30 @@
+package amqphelper
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Publisher publishes messages, Queue implements it. Depend on it rather than Queue to swap in a mock or the amqphelpertest fake in unit tests
+type Publisher interface {
+	Publish(message []byte, headers map[string]interface{}, mandatory, immediate bool) error
+	PublishWithContext(ctx context.Context, message []byte, headers map[string]interface{}, mandatory, immediate bool) error
+	PublishTo(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error
+}
+
+//Consumer runs handlers on delivered messages, Queue implements it
+type Consumer interface {
+	SpawnWorkers(consumerPrefix string, consumers int, f func(m *Message)) error
+	KeepRunning()
+}
+
+//QueueClient is everything a service usually needs from a Queue
+type QueueClient interface {
+	Publisher
+	Consumer
+	Name() string
+	Close() error
+}
+
+var _ QueueClient = (*Queue)(nil)
@@ -0,0 +1,73 @@
+package amqphelper
+
+import (
+	"context"
+	"time"
+)
+
+//LagMetrics is implemented by Metrics that also want the lag estimates produced by MonitorLag
+type LagMetrics interface {
+	Lag(depth int, consumeRate float64, timeToDrain time.Duration)
+}
+
+const lagSmoothing = 0.3
+
+//NotDraining is the time to drain of a queue with messages waiting while nothing is being consumed
+const NotDraining time.Duration = -1
+
+//DrainSeconds returns a time to drain in seconds, -1 for NotDraining, the way exporters report it
+func DrainSeconds(d time.Duration) float64 {
+	if d < 0 {
+		return -1
+	}
+	return d.Seconds()
+}
+
+//MonitorLag spawns a goroutine that polls Depth every interval until ctx is done and combines it with this queue's smoothed consumption rate into a time to drain estimate, exposed through Stats and LagMetrics. The estimate assumes no new arrivals and is NotDraining while nothing is being consumed with messages waiting
+func (q *Queue) MonitorLag(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := q.Clock().NewTicker(interval)
+		defer t.Stop()
+		last := q.Stats().Consumed
+		lastTime := q.Clock().Now()
+		rate := -1.0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C():
+			}
+			messages, _, err := q.Depth()
+			if err != nil {
+				q.logger().Warn("Could not poll queue depth", F("queue", q.config().RoutingKey), F("error", err))
+				continue
+			}
+			now := q.Clock().Now()
+			consumed := q.Stats().Consumed
+			sample := float64(consumed-last) / now.Sub(lastTime).Seconds()
+			last, lastTime = consumed, now
+			if rate < 0 {
+				rate = sample
+			} else {
+				rate = lagSmoothing*sample + (1-lagSmoothing)*rate
+			}
+
+			var drain time.Duration
+			switch {
+			case messages == 0:
+				drain = 0
+			case rate <= 0:
+				drain = NotDraining
+			default:
+				drain = time.Duration(float64(messages) / rate * float64(time.Second))
+			}
+
+			q.stats.Lock()
+			q.stats.depth, q.stats.consumeRate, q.stats.timeToDrain = int64(messages), rate, drain
+			q.stats.Unlock()
+			if lm, ok := q.metrics().(LagMetrics); ok {
+				lm.Lag(messages, rate, drain)
+			}
+		}
+	}()
+}
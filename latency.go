@@ -0,0 +1,142 @@
+package amqphelper
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//LatencyBuckets are the upper bounds of the handler latency histograms, in increasing order. Each histogram copies them when it is created, so changing them only affects the routing key and type pairs observed afterwards
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+//DefaultMaxLatencyKeys is how many routing key and message type pairs get a histogram of their own when Configuration.MaxLatencyKeys is 0
+const DefaultMaxLatencyKeys = 100
+
+//OtherLatencyKey is the RoutingKey and MessageType of the histogram gathering the pairs past MaxLatencyKeys
+const OtherLatencyKey = "_other"
+
+type latencyKey struct {
+	routingKey  string
+	messageType string
+}
+
+type latencyHistogram struct {
+	count   int64
+	sum     int64
+	max     int64
+	bounds  []time.Duration
+	buckets []int64
+}
+
+//newLatencyHistogram returns a histogram over a copy of LatencyBuckets
+func newLatencyHistogram() *latencyHistogram {
+	bounds := append([]time.Duration(nil), LatencyBuckets...)
+	return &latencyHistogram{bounds: bounds, buckets: make([]int64, len(bounds)+1)}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+	for {
+		m := atomic.LoadInt64(&h.max)
+		if int64(d) <= m || atomic.CompareAndSwapInt64(&h.max, m, int64(d)) {
+			break
+		}
+	}
+	i := sort.Search(len(h.bounds), func(i int) bool { return d <= h.bounds[i] })
+	atomic.AddInt64(&h.buckets[i], 1)
+}
+
+//HandlerLatency is a snapshot of the handler durations observed for a routing key and message type. Buckets[i] counts durations up to Bounds[i], the last entry counts those above every bound
+type HandlerLatency struct {
+	RoutingKey  string
+	MessageType string
+	Count       int64
+	Total       time.Duration
+	Max         time.Duration
+	Bounds      []time.Duration
+	Buckets     []int64
+}
+
+//Mean returns the average handler duration
+func (l HandlerLatency) Mean() time.Duration {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Total / time.Duration(l.Count)
+}
+
+func messageType(m *Message) string {
+	if m.Type != "" {
+		return m.Type
+	}
+	t, _ := GetStringHeader(m.HeaderTable(), ProtoTypeHeader)
+	return t
+}
+
+//observeLatency records d in the histogram of the message's routing key and type. Routing keys and types may be unbounded, once MaxLatencyKeys pairs have one new pairs are recorded under OtherLatencyKey
+func (q *Queue) observeLatency(m *Message, d time.Duration) {
+	k := latencyKey{m.RoutingKey, messageType(m)}
+	h, ok := q.latencies.Load(k)
+	if !ok {
+		max := int64(q.config().MaxLatencyKeys)
+		if max == 0 {
+			max = DefaultMaxLatencyKeys
+		}
+		other := latencyKey{OtherLatencyKey, OtherLatencyKey}
+		if q.latencyKeys.Add(1) > max {
+			q.latencyKeys.Add(-1)
+			k = other
+		}
+		var loaded bool
+		h, loaded = q.latencies.LoadOrStore(k, newLatencyHistogram())
+		//another handler added the pair first
+		if loaded && k != other {
+			q.latencyKeys.Add(-1)
+		}
+	}
+	h.(*latencyHistogram).observe(d)
+}
+
+//ConsumerStats returns handler latency snapshots per routing key and message type, recorded when Configuration.TrackHandlerLatency is set. Message types come from the Type property or the x-proto-type header, pairs past Configuration.MaxLatencyKeys are gathered under OtherLatencyKey
+func (q *Queue) ConsumerStats() []HandlerLatency {
+	var out []HandlerLatency
+	q.latencies.Range(func(key, value interface{}) bool {
+		k := key.(latencyKey)
+		h := value.(*latencyHistogram)
+		l := HandlerLatency{
+			RoutingKey:  k.routingKey,
+			MessageType: k.messageType,
+			Count:       atomic.LoadInt64(&h.count),
+			Total:       time.Duration(atomic.LoadInt64(&h.sum)),
+			Max:         time.Duration(atomic.LoadInt64(&h.max)),
+			Bounds:      append([]time.Duration(nil), h.bounds...),
+			Buckets:     make([]int64, len(h.buckets)),
+		}
+		for i := range h.buckets {
+			l.Buckets[i] = atomic.LoadInt64(&h.buckets[i])
+		}
+		out = append(out, l)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].RoutingKey != out[j].RoutingKey {
+			return out[i].RoutingKey < out[j].RoutingKey
+		}
+		return out[i].MessageType < out[j].MessageType
+	})
+	return out
+}
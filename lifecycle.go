@@ -0,0 +1,101 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//DefaultShutdownTimeout bounds the graceful shutdown Run starts when its context is done
+const DefaultShutdownTimeout = 30 * time.Second
+
+//ErrConsumersStopped is returned by Run when every consumer stopped without Shutdown being called, typically because the connection was lost
+var ErrConsumersStopped = fmt.Errorf("All consumers stopped")
+
+//lifecycle tracks the consumers spawned by SpawnWorkers for Run and Shutdown
+type lifecycle struct {
+	sync.Mutex
+	running  sync.WaitGroup
+	tags     map[string]struct{}
+	shutdown bool
+}
+
+func (l *lifecycle) started(tag string) {
+	l.Lock()
+	if l.tags == nil {
+		l.tags = map[string]struct{}{}
+	}
+	l.tags[tag] = struct{}{}
+	l.running.Add(1)
+	l.Unlock()
+}
+
+func (l *lifecycle) stopped(tag string) {
+	l.Lock()
+	delete(l.tags, tag)
+	l.Unlock()
+	l.running.Done()
+}
+
+func (l *lifecycle) stopping() bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.shutdown
+}
+
+//Run blocks while the queue's consumers run. When ctx is done it shuts them down gracefully within DefaultShutdownTimeout and returns Shutdown's result, when they all stop on their own, or none were spawned, it returns ErrConsumersStopped, or nil if Shutdown was called elsewhere
+func (q *Queue) Run(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		q.lifecycle.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		if q.lifecycle.stopping() {
+			return nil
+		}
+		return ErrConsumersStopped
+	case <-ctx.Done():
+		sctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+		defer cancel()
+		return q.Shutdown(sctx)
+	}
+}
+
+//Shutdown cancels every consumer spawned by SpawnWorkers, waits for the handlers still running to return so their messages get settled and then closes the queue. If ctx is done first the queue is closed anyway, unsettled messages are redelivered by the broker, and ctx's error is returned
+func (q *Queue) Shutdown(ctx context.Context) error {
+	cfg := q.config()
+	l := &q.lifecycle
+	l.Lock()
+	l.shutdown = true
+	tags := make([]string, 0, len(l.tags))
+	for tag := range l.tags {
+		tags = append(tags, tag)
+	}
+	l.Unlock()
+
+	q.logger().Info("Shutting down", F("queue", cfg.RoutingKey), F("consumers", len(tags)))
+	for _, tag := range tags {
+		if err := q.CancelConsumer(tag); err != nil {
+			q.logger().Warn("Could not cancel consumer", F("queue", cfg.RoutingKey), F("consumer", tag), F("error", err))
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		l.running.Wait()
+		close(stopped)
+	}()
+	var err error
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if cerr := q.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
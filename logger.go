@@ -0,0 +1,108 @@
+package amqphelper
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Field is a key value pair attached to a log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+//F returns a Field
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+//Logger receives the package's log output, set it as Configuration.Logger. Nothing is logged by default
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...Field) {}
+func (nopLogger) Info(msg string, fields ...Field)  {}
+func (nopLogger) Warn(msg string, fields ...Field)  {}
+func (nopLogger) Error(msg string, fields ...Field) {}
+
+type fieldLogger struct {
+	Logger
+	fields []Field
+}
+
+func (l fieldLogger) with(fields []Field) []Field {
+	return append(append([]Field(nil), fields...), l.fields...)
+}
+
+func (l fieldLogger) Debug(msg string, fields ...Field) { l.Logger.Debug(msg, l.with(fields)...) }
+func (l fieldLogger) Info(msg string, fields ...Field)  { l.Logger.Info(msg, l.with(fields)...) }
+func (l fieldLogger) Warn(msg string, fields ...Field)  { l.Logger.Warn(msg, l.with(fields)...) }
+func (l fieldLogger) Error(msg string, fields ...Field) { l.Logger.Error(msg, l.with(fields)...) }
+
+//WithFields returns a Logger adding fields to every entry written to l
+func WithFields(l Logger, fields ...Field) Logger {
+	if len(fields) == 0 {
+		return l
+	}
+	return fieldLogger{l, fields}
+}
+
+type loggerKey struct{}
+
+//ContextWithLogger returns a copy of ctx carrying l
+func ContextWithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+//LoggerFromContext returns the Logger carried by ctx, or one discarding everything. Message contexts carry the queue's logger tagged with the message and correlation ids, so code called from a handler can log against the message it is processing
+func LoggerFromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	return nopLogger{}
+}
+
+func correlationFields(d *amqp.Delivery) []Field {
+	fields := []Field{F("message_id", d.MessageId)}
+	if d.CorrelationId != "" {
+		fields = append(fields, F("correlation_id", d.CorrelationId))
+	}
+	return fields
+}
+
+func (q *Queue) logger() Logger {
+	if c := q.config(); c != nil && c.Logger != nil {
+		return c.Logger
+	}
+	return nopLogger{}
+}
+
+//Logger returns the queue's logger tagged with the message and correlation ids of the message
+func (m *Message) Logger() Logger {
+	if m == nil || m.Delivery == nil {
+		return nopLogger{}
+	}
+	if l, ok := m.Context().Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	return WithFields(m.queue.logger(), correlationFields(m.Delivery)...)
+}
+
+func (m *Message) logger() Logger {
+	if m == nil {
+		return nopLogger{}
+	}
+	return m.queue.logger()
+}
+
+func (m *Message) fields(fields ...Field) []Field {
+	fields = append(fields, F("routing_key", m.RoutingKey), F("delivery_tag", m.Tag()))
+	return append(fields, correlationFields(m.Delivery)...)
+}
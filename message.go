@@ -0,0 +1,155 @@
+package amqphelper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//newMessage wraps a copy of the delivery so handlers never share it with the dispatch loop or each other, with Configuration.CopyBodies the body is copied too so it can be retained after the handler returns. With a Logger configured the context carries it tagged with the message's ids
+func (q *Queue) newMessage(ctx context.Context, d amqp.Delivery) *Message {
+	if q.config().CopyBodies && d.Body != nil {
+		d.Body = append([]byte(nil), d.Body...)
+	}
+	return &Message{Delivery: &d, queue: q, ctx: q.messageContext(ctx, &d)}
+}
+
+func (q *Queue) messageContext(ctx context.Context, d *amqp.Delivery) context.Context {
+	cfg := q.config()
+	ctx = extractTraceContext(ctx, d.Headers)
+	if cfg.Logger != nil {
+		ctx = ContextWithLogger(ctx, WithFields(cfg.Logger, correlationFields(d)...))
+	}
+	return ctx
+}
+
+//pooledMessage keeps a Message and the delivery it points to in a single allocation
+type pooledMessage struct {
+	Message
+	delivery amqp.Delivery
+}
+
+var messagePool = sync.Pool{New: func() interface{} {
+	pm := &pooledMessage{}
+	pm.Message.Delivery = &pm.delivery
+	pm.Message.pooled = pm
+	return pm
+}}
+
+//reusableMessage is newMessage taking the Message from the pool when Configuration.ReuseMessages is set, unless CopyBodies asks for bodies that outlive the handler. recycle gives it back
+func (q *Queue) reusableMessage(ctx context.Context, d amqp.Delivery) *Message {
+	cfg := q.config()
+	if !cfg.ReuseMessages || cfg.CopyBodies {
+		return q.newMessage(ctx, d)
+	}
+	pm := messagePool.Get().(*pooledMessage)
+	pm.delivery = d
+	pm.Message.queue, pm.Message.ctx = q, q.messageContext(ctx, &pm.delivery)
+	return &pm.Message
+}
+
+//recycle clears m and puts it back in the pool if it came from there
+func (m *Message) recycle() {
+	pm := m.pooled
+	if pm == nil {
+		return
+	}
+	pm.delivery = amqp.Delivery{}
+	pm.Message.queue, pm.Message.ctx = nil, nil
+	messagePool.Put(pm)
+}
+
+//republishing copies the delivery's properties and body, as received, into a publishing, to send a consumed message on again
+func (m *Message) republishing() amqp.Publishing {
+	d := m.Delivery
+	return amqp.Publishing{
+		Headers:         cloneTable(d.Headers),
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
+
+//HeaderTable returns the delivery's headers, nil when the message is nil
+func (m *Message) HeaderTable() amqp.Table {
+	if m == nil || m.Delivery == nil {
+		return nil
+	}
+	return m.Delivery.Headers
+}
+
+//CorrelationID returns the delivery's correlation id
+func (m *Message) CorrelationID() string {
+	if m == nil || m.Delivery == nil {
+		return ""
+	}
+	return m.CorrelationId
+}
+
+//ReplyQueue returns the queue the sender expects replies on, the ReplyTo property
+func (m *Message) ReplyQueue() string {
+	if m == nil || m.Delivery == nil {
+		return ""
+	}
+	return m.Delivery.ReplyTo
+}
+
+//MessageID returns the delivery's message id
+func (m *Message) MessageID() string {
+	if m == nil || m.Delivery == nil {
+		return ""
+	}
+	return m.MessageId
+}
+
+//AppID returns the id of the application that published the message
+func (m *Message) AppID() string {
+	if m == nil || m.Delivery == nil {
+		return ""
+	}
+	return m.AppId
+}
+
+//SentAt returns the time the message was published, the Timestamp property, zero when unset
+func (m *Message) SentAt() time.Time {
+	if m == nil || m.Delivery == nil {
+		return time.Time{}
+	}
+	return m.Delivery.Timestamp
+}
+
+//IsRedelivered reports whether the broker delivered the message before
+func (m *Message) IsRedelivered() bool {
+	if m == nil || m.Delivery == nil {
+		return false
+	}
+	return m.Delivery.Redelivered
+}
+
+//Tag returns the channel scoped delivery tag used to acknowledge the message
+func (m *Message) Tag() uint64 {
+	if m == nil || m.Delivery == nil {
+		return 0
+	}
+	return m.Delivery.DeliveryTag
+}
+
+//PriorityLevel returns the message priority, 0 to 9
+func (m *Message) PriorityLevel() uint8 {
+	if m == nil || m.Delivery == nil {
+		return 0
+	}
+	return m.Delivery.Priority
+}
@@ -0,0 +1,134 @@
+package amqphelper
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//MessageIDGenerator returns the MessageId stamped on a publishing that doesn't already have one
+type MessageIDGenerator func(msg *amqp.Publishing) string
+
+//UUIDv4 generates random version 4 UUIDs
+func UUIDv4(msg *amqp.Publishing) string {
+	return newUUID()
+}
+
+//idTime is the time time ordered ids are generated for, the publishing's Timestamp, which publishes set from the queue's Clock before stamping, or the system clock's when it has none
+func idTime(msg *amqp.Publishing) time.Time {
+	if msg != nil && !msg.Timestamp.IsZero() {
+		return msg.Timestamp
+	}
+	return SystemClock.Now()
+}
+
+var uuidv7State struct {
+	sync.Mutex
+	ms  int64
+	seq uint16
+}
+
+//UUIDv7 generates time ordered version 7 UUIDs for the publishing's Timestamp, so with the queue's Clock, ids generated within the same millisecond use a counter so they stay unique and sortable
+func UUIDv7(msg *amqp.Publishing) string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	uuidv7State.Lock()
+	ms := idTime(msg).UnixNano() / int64(time.Millisecond)
+	if ms <= uuidv7State.ms {
+		uuidv7State.seq++
+		if uuidv7State.seq > 0x0fff {
+			uuidv7State.ms++
+			uuidv7State.seq = 0
+		}
+		ms = uuidv7State.ms
+	} else {
+		uuidv7State.ms = ms
+		uuidv7State.seq = binary.BigEndian.Uint16(b[6:8]) & 0x07ff
+	}
+	seq := uuidv7State.seq
+	uuidv7State.Unlock()
+
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = 0x70 | byte(seq>>8)
+	b[7] = byte(seq)
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var ulidState struct {
+	sync.Mutex
+	ms      int64
+	entropy [10]byte
+}
+
+//ULID generates monotonic ULIDs for the publishing's Timestamp, so with the queue's Clock, ids generated within the same millisecond increment the random part so they stay unique and sortable
+func ULID(msg *amqp.Publishing) string {
+	ulidState.Lock()
+	ms := idTime(msg).UnixNano() / int64(time.Millisecond)
+	if ms <= ulidState.ms {
+		ms = ulidState.ms
+		i := len(ulidState.entropy) - 1
+		for ; i >= 0; i-- {
+			ulidState.entropy[i]++
+			if ulidState.entropy[i] != 0 {
+				break
+			}
+		}
+		if i < 0 {
+			ulidState.ms++
+			ms = ulidState.ms
+		}
+	} else {
+		ulidState.ms = ms
+		if _, err := rand.Read(ulidState.entropy[:]); err != nil {
+			ulidState.Unlock()
+			panic(err)
+		}
+	}
+	var b [16]byte
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	copy(b[6:], ulidState.entropy[:])
+	ulidState.Unlock()
+
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+//ContentHash derives the id from the SHA-256 of the content type, content encoding and body, so republishing identical content yields the same id for broker or consumer side deduplication
+func ContentHash(msg *amqp.Publishing) string {
+	h := sha256.New()
+	h.Write([]byte(msg.ContentType))
+	h.Write([]byte{0})
+	h.Write([]byte(msg.ContentEncoding))
+	h.Write([]byte{0})
+	h.Write(msg.Body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,142 @@
+package amqphelper
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	uuidv7Format = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidFormat   = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+)
+
+func uuidv7Millis(id string) int64 {
+	b, _ := hex.DecodeString(strings.Replace(id[:13], "-", "", 1))
+	var ms int64
+	for _, x := range b {
+		ms = ms<<8 | int64(x)
+	}
+	return ms
+}
+
+func ulidMillis(id string) int64 {
+	var ms int64
+	for _, c := range id[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(crockford, c))
+	}
+	return ms
+}
+
+//resetIDState forgets the last millisecond the generators used, so each case starts as the first id of a process
+func resetIDState() {
+	uuidv7State.Lock()
+	uuidv7State.ms, uuidv7State.seq = 0, 0
+	uuidv7State.Unlock()
+	ulidState.Lock()
+	ulidState.ms, ulidState.entropy = 0, [10]byte{}
+	ulidState.Unlock()
+}
+
+//TestTimeOrderedIDs generates an id for each of times, a zero one publishing without a Timestamp, and reads back the millisecond each carries. -1 in want is the system clock's. Every id must sort after the previous one
+func TestTimeOrderedIDs(t *testing.T) {
+	ms := func(d time.Duration) time.Time { return eventTime.Add(d * time.Millisecond) }
+	base := eventTime.UnixNano() / int64(time.Millisecond)
+	for _, g := range []struct {
+		name   string
+		gen    MessageIDGenerator
+		format *regexp.Regexp
+		millis func(string) int64
+	}{
+		{"UUIDv7", UUIDv7, uuidv7Format, uuidv7Millis},
+		{"ULID", ULID, ulidFormat, ulidMillis},
+	} {
+		for _, c := range []struct {
+			name  string
+			times []time.Time
+			want  []int64
+		}{
+			{"timestamp", []time.Time{ms(0)}, []int64{base}},
+			{"later milliseconds", []time.Time{ms(0), ms(1), ms(10)}, []int64{base, base + 1, base + 10}},
+			{"same millisecond", []time.Time{ms(0), ms(0), ms(0)}, []int64{base, base, base}},
+			{"clock going back", []time.Time{ms(5), ms(0), ms(6)}, []int64{base + 5, base + 5, base + 6}},
+			{"no timestamp", []time.Time{{}}, []int64{-1}},
+		} {
+			t.Run(g.name+"/"+c.name, func(t *testing.T) {
+				resetIDState()
+				var prev string
+				for i, at := range c.times {
+					msg := &amqp.Publishing{Timestamp: at}
+					before := time.Now().UnixNano() / int64(time.Millisecond)
+					id := g.gen(msg)
+					after := time.Now().UnixNano() / int64(time.Millisecond)
+					if !g.format.MatchString(id) {
+						t.Fatalf("%s isn't a %s", id, g.name)
+					}
+					got, want := g.millis(id), c.want[i]
+					if want == -1 && (got < before || got > after) {
+						t.Errorf("%s carries %d, want the system clock's between %d and %d", id, got, before, after)
+					}
+					if want != -1 && got != want {
+						t.Errorf("%s carries %d, want %d", id, got, want)
+					}
+					if id <= prev {
+						t.Errorf("%s doesn't sort after %s", id, prev)
+					}
+					prev = id
+				}
+			})
+		}
+	}
+}
+
+//TestIDCounterOverflow fills the part that keeps ids of the same millisecond apart, the next id moves on to the following millisecond
+func TestIDCounterOverflow(t *testing.T) {
+	at := &amqp.Publishing{Timestamp: eventTime}
+	base := eventTime.UnixNano() / int64(time.Millisecond)
+	for _, c := range []struct {
+		name   string
+		gen    MessageIDGenerator
+		fill   func()
+		millis func(string) int64
+	}{
+		{"UUIDv7", UUIDv7, func() {
+			uuidv7State.ms, uuidv7State.seq = base, 0x0fff
+		}, uuidv7Millis},
+		{"ULID", ULID, func() {
+			ulidState.ms = base
+			for i := range ulidState.entropy {
+				ulidState.entropy[i] = 0xff
+			}
+		}, ulidMillis},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			resetIDState()
+			first := c.gen(at)
+			c.fill()
+			next := c.gen(at)
+			if got := c.millis(next); got != base+1 {
+				t.Errorf("%s after the counter is full carries %d, want %d", next, got, base+1)
+			}
+			if next <= first {
+				t.Errorf("%s doesn't sort after %s", next, first)
+			}
+		})
+	}
+}
+
+func TestUUIDv4(t *testing.T) {
+	format := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id := UUIDv4(nil)
+		if !format.MatchString(id) || seen[id] {
+			t.Fatalf("%s isn't a new version 4 UUID", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,197 @@
+package amqphelper
+
+import "time"
+
+//Metrics receives instrumentation events from a queue, implementations must be safe for concurrent use
+type Metrics interface {
+	Published(err error)
+	Confirmed(ack bool)
+	Returned()
+	Consumed()
+	Acked()
+	Nacked(requeue bool)
+	HandlerDuration(d time.Duration)
+	Reconnected()
+	ConnectionState(connected bool)
+}
+
+//metrics returns the queue's instrumentation sink, it keeps the counters behind Stats and forwards events to Configuration.Metrics
+func (q *Queue) metrics() Metrics {
+	return queueMetrics{q}
+}
+
+//handle runs f on the message, recording it as consumed along with the handler duration
+func (q *Queue) handle(f func(m *Message), m *Message) {
+	cfg := q.config()
+	mt := q.metrics()
+	mt.Consumed()
+	if err := q.checkOut(m); err != nil {
+		m.logger().Error("Could not fetch claim checked payload", m.fields(F("error", err))...)
+		q.reportError(ErrorScopeDecode, err)
+		m.reject()
+		return
+	}
+	q.stats.inFlight.Add(1)
+	defer q.stats.inFlight.Add(-1)
+	if cfg.Debug {
+		q.debug("Delivered", m.fields(F("exchange", m.Exchange), F("size", len(m.Body)), F("content_type", m.ContentType), F("redelivered", m.IsRedelivered()), F("consumer", m.ConsumerTag))...)
+	}
+	start := q.Clock().Now()
+	f(m)
+	d := q.Clock().Now().Sub(start)
+	mt.HandlerDuration(d)
+	q.stats.handled.Add(1)
+	q.stats.handlerNanos.Add(int64(d))
+	if cfg.TrackHandlerLatency {
+		q.observeLatency(m, d)
+	}
+	if cfg.SlowHandlerThreshold > 0 {
+		q.observeSlow(d)
+	}
+}
+
+//Ack acknowledges the delivery and records it in the queue's metrics. With Configuration.AckBatchSize or AckBatchInterval a single acknowledgment is held back to be sent with others, a multiple one is sent at once
+func (m *Message) Ack(multiple bool) error {
+	var err error
+	batched := false
+	if m.queue != nil && m.queue.batchingAcks() {
+		if multiple {
+			m.queue.settleAck(m.Delivery, true)
+		} else {
+			batched, err = m.queue.batchAck(m.Delivery)
+		}
+	}
+	if !batched {
+		err = m.Delivery.Ack(multiple)
+	}
+	if err == nil && m.queue != nil {
+		m.queue.metrics().Acked()
+		m.queue.debug("Acked", m.fields(F("multiple", multiple), F("batched", batched))...)
+	}
+	return err
+}
+
+//Nack negatively acknowledges the delivery and records it in the queue's metrics
+func (m *Message) Nack(multiple, requeue bool) error {
+	if m.queue != nil && m.queue.batchingAcks() {
+		m.queue.settleAck(m.Delivery, multiple)
+	}
+	err := m.Delivery.Nack(multiple, requeue)
+	if err == nil && m.queue != nil {
+		m.queue.metrics().Nacked(requeue)
+		if !requeue {
+			m.queue.deadLettered()
+		}
+		m.queue.debug("Nacked", m.fields(F("multiple", multiple), F("requeue", requeue))...)
+	}
+	return err
+}
+
+//Reject rejects the delivery and records it in the queue's metrics as a nack
+func (m *Message) Reject(requeue bool) error {
+	if m.queue != nil && m.queue.batchingAcks() {
+		m.queue.settleAck(m.Delivery, false)
+	}
+	err := m.Delivery.Reject(requeue)
+	if err == nil && m.queue != nil {
+		m.queue.metrics().Nacked(requeue)
+		if !requeue {
+			m.queue.deadLettered()
+		}
+		m.queue.debug("Rejected", m.fields(F("requeue", requeue))...)
+	}
+	return err
+}
+
+type multiMetrics []Metrics
+
+//MultiMetrics returns a Metrics forwarding every event to each of ms, for instance to feed Prometheus and StatsD at once
+func MultiMetrics(ms ...Metrics) Metrics {
+	return multiMetrics(ms)
+}
+
+func (mm multiMetrics) Published(err error) {
+	for _, m := range mm {
+		m.Published(err)
+	}
+}
+
+func (mm multiMetrics) Confirmed(ack bool) {
+	for _, m := range mm {
+		m.Confirmed(ack)
+	}
+}
+
+func (mm multiMetrics) Returned() {
+	for _, m := range mm {
+		m.Returned()
+	}
+}
+
+func (mm multiMetrics) Consumed() {
+	for _, m := range mm {
+		m.Consumed()
+	}
+}
+
+func (mm multiMetrics) Acked() {
+	for _, m := range mm {
+		m.Acked()
+	}
+}
+
+func (mm multiMetrics) Nacked(requeue bool) {
+	for _, m := range mm {
+		m.Nacked(requeue)
+	}
+}
+
+func (mm multiMetrics) HandlerDuration(d time.Duration) {
+	for _, m := range mm {
+		m.HandlerDuration(d)
+	}
+}
+
+func (mm multiMetrics) Reconnected() {
+	for _, m := range mm {
+		m.Reconnected()
+	}
+}
+
+func (mm multiMetrics) ConnectionState(connected bool) {
+	for _, m := range mm {
+		m.ConnectionState(connected)
+	}
+}
+
+func (mm multiMetrics) BrokerLatency(d time.Duration) {
+	for _, m := range mm {
+		if bm, ok := m.(BrokerMetrics); ok {
+			bm.BrokerLatency(d)
+		}
+	}
+}
+
+func (mm multiMetrics) HeartbeatMissed() {
+	for _, m := range mm {
+		if bm, ok := m.(BrokerMetrics); ok {
+			bm.HeartbeatMissed()
+		}
+	}
+}
+
+func (mm multiMetrics) Lag(depth int, consumeRate float64, timeToDrain time.Duration) {
+	for _, m := range mm {
+		if lm, ok := m.(LagMetrics); ok {
+			lm.Lag(depth, consumeRate, timeToDrain)
+		}
+	}
+}
+
+func (mm multiMetrics) SlowConsumer(slow bool) {
+	for _, m := range mm {
+		if sm, ok := m.(SlowConsumerMetrics); ok {
+			sm.SlowConsumer(slow)
+		}
+	}
+}
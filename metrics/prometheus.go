@@ -0,0 +1,171 @@
+//Package metrics exposes amqphelper queue instrumentation to Prometheus. It is a module of its own, so only its importers depend on the Prometheus client
+package metrics
+
+import (
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//Prometheus implements amqphelper.Metrics as a prometheus.Collector, every series carries a constant queue label
+type Prometheus struct {
+	published  *prometheus.CounterVec
+	confirms   *prometheus.CounterVec
+	returns    prometheus.Counter
+	consumed   prometheus.Counter
+	acked      prometheus.Counter
+	nacked     *prometheus.CounterVec
+	handler    prometheus.Histogram
+	reconnects prometheus.Counter
+	connected  prometheus.Gauge
+	slow       prometheus.Gauge
+	latency    prometheus.Histogram
+	heartbeats prometheus.Counter
+	depth      prometheus.Gauge
+	rate       prometheus.Gauge
+	drain      prometheus.Gauge
+	collectors []prometheus.Collector
+}
+
+var _ amqphelper.Metrics = (*Prometheus)(nil)
+
+//NewPrometheus returns a collector for the named queue, register it with a prometheus.Registerer and set it as Configuration.Metrics
+func NewPrometheus(queue string) *Prometheus {
+	labels := prometheus.Labels{"queue": queue}
+	opts := func(name, help string) prometheus.Opts {
+		return prometheus.Opts{Namespace: "amqphelper", Name: name, Help: help, ConstLabels: labels}
+	}
+	p := &Prometheus{
+		published:  prometheus.NewCounterVec(prometheus.CounterOpts(opts("published_total", "Messages published, by result.")), []string{"result"}),
+		confirms:   prometheus.NewCounterVec(prometheus.CounterOpts(opts("confirms_total", "Publisher confirms received, by result.")), []string{"result"}),
+		returns:    prometheus.NewCounter(prometheus.CounterOpts(opts("returns_total", "Messages returned by the broker."))),
+		consumed:   prometheus.NewCounter(prometheus.CounterOpts(opts("consumed_total", "Messages delivered to handlers."))),
+		acked:      prometheus.NewCounter(prometheus.CounterOpts(opts("acked_total", "Messages acknowledged."))),
+		nacked:     prometheus.NewCounterVec(prometheus.CounterOpts(opts("nacked_total", "Messages negatively acknowledged or rejected, by requeue.")), []string{"requeue"}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts(opts("reconnects_total", "Connection recoveries attempted."))),
+		connected:  prometheus.NewGauge(prometheus.GaugeOpts(opts("connected", "1 when the queue's connection is up."))),
+		slow:       prometheus.NewGauge(prometheus.GaugeOpts(opts("slow_consumer", "1 while handlers stay over the slow handler threshold."))),
+		depth:      prometheus.NewGauge(prometheus.GaugeOpts(opts("depth", "Ready messages reported by the broker."))),
+		rate:       prometheus.NewGauge(prometheus.GaugeOpts(opts("consume_rate", "Smoothed messages consumed per second."))),
+		drain:      prometheus.NewGauge(prometheus.GaugeOpts(opts("time_to_drain_seconds", "Estimated time to drain the queue, -1 when it isn't draining."))),
+		heartbeats: prometheus.NewCounter(prometheus.CounterOpts(opts("heartbeat_timeouts_total", "Connections lost to heartbeat timeouts."))),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   "amqphelper",
+			Name:        "broker_latency_seconds",
+			Help:        "Broker round trip time measured by latency probes.",
+			ConstLabels: labels,
+			Buckets:     []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}),
+		handler: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   "amqphelper",
+			Name:        "handler_duration_seconds",
+			Help:        "Time spent processing a delivery.",
+			ConstLabels: labels,
+			Buckets:     prometheus.DefBuckets,
+		}),
+	}
+	p.collectors = []prometheus.Collector{p.published, p.confirms, p.returns, p.consumed, p.acked, p.nacked, p.handler, p.reconnects, p.connected, p.slow, p.latency, p.heartbeats, p.depth, p.rate, p.drain}
+	return p
+}
+
+//Describe implements prometheus.Collector
+func (p *Prometheus) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range p.collectors {
+		c.Describe(ch)
+	}
+}
+
+//Collect implements prometheus.Collector
+func (p *Prometheus) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range p.collectors {
+		c.Collect(ch)
+	}
+}
+
+//Published counts a publish attempt
+func (p *Prometheus) Published(err error) {
+	if err != nil {
+		p.published.WithLabelValues("error").Inc()
+		return
+	}
+	p.published.WithLabelValues("ok").Inc()
+}
+
+//Confirmed counts a publisher confirm
+func (p *Prometheus) Confirmed(ack bool) {
+	if ack {
+		p.confirms.WithLabelValues("ack").Inc()
+		return
+	}
+	p.confirms.WithLabelValues("nack").Inc()
+}
+
+//Returned counts a returned message
+func (p *Prometheus) Returned() {
+	p.returns.Inc()
+}
+
+//Consumed counts a delivery
+func (p *Prometheus) Consumed() {
+	p.consumed.Inc()
+}
+
+//Acked counts an acknowledgement
+func (p *Prometheus) Acked() {
+	p.acked.Inc()
+}
+
+//Nacked counts a nack or reject
+func (p *Prometheus) Nacked(requeue bool) {
+	if requeue {
+		p.nacked.WithLabelValues("true").Inc()
+		return
+	}
+	p.nacked.WithLabelValues("false").Inc()
+}
+
+//HandlerDuration observes the time a handler took
+func (p *Prometheus) HandlerDuration(d time.Duration) {
+	p.handler.Observe(d.Seconds())
+}
+
+//Reconnected counts a recovery attempt
+func (p *Prometheus) Reconnected() {
+	p.reconnects.Inc()
+}
+
+//BrokerLatency observes a broker round trip
+func (p *Prometheus) BrokerLatency(d time.Duration) {
+	p.latency.Observe(d.Seconds())
+}
+
+//HeartbeatMissed counts a heartbeat timeout
+func (p *Prometheus) HeartbeatMissed() {
+	p.heartbeats.Inc()
+}
+
+//Lag records the lag estimates
+func (p *Prometheus) Lag(depth int, consumeRate float64, timeToDrain time.Duration) {
+	p.depth.Set(float64(depth))
+	p.rate.Set(consumeRate)
+	p.drain.Set(amqphelper.DrainSeconds(timeToDrain))
+}
+
+//SlowConsumer records whether the consumer is currently slow
+func (p *Prometheus) SlowConsumer(slow bool) {
+	if slow {
+		p.slow.Set(1)
+		return
+	}
+	p.slow.Set(0)
+}
+
+//ConnectionState records whether the connection is up
+func (p *Prometheus) ConnectionState(connected bool) {
+	if connected {
+		p.connected.Set(1)
+		return
+	}
+	p.connected.Set(0)
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+)
+
+//StatsD implements amqphelper.Metrics by sending counters, gauges and timings over UDP in the DogStatsD format, tags are omitted when none are configured so plain StatsD servers accept it too
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+}
+
+var _ amqphelper.Metrics = (*StatsD)(nil)
+
+//NewStatsD dials the agent at addr, metric names are prefixed with prefix and tags are given as key:value strings
+func NewStatsD(addr, prefix string, tags ...string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	s := &StatsD{conn: conn, prefix: prefix}
+	if len(tags) > 0 {
+		s.tags = "|#" + strings.Join(tags, ",")
+	}
+	return s, nil
+}
+
+//Close closes the UDP socket
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+//send writes a single metric, errors are ignored since metrics are best effort
+func (s *StatsD) send(name, value, kind string, tags ...string) {
+	t := s.tags
+	if len(tags) > 0 {
+		if t == "" {
+			t = "|#" + strings.Join(tags, ",")
+		} else {
+			t += "," + strings.Join(tags, ",")
+		}
+	}
+	fmt.Fprintf(s.conn, "%s%s:%s|%s%s", s.prefix, name, value, kind, t)
+}
+
+//Published counts a publish attempt
+func (s *StatsD) Published(err error) {
+	if err != nil {
+		s.send("published", "1", "c", "result:error")
+		return
+	}
+	s.send("published", "1", "c", "result:ok")
+}
+
+//Confirmed counts a publisher confirm
+func (s *StatsD) Confirmed(ack bool) {
+	if ack {
+		s.send("confirms", "1", "c", "result:ack")
+		return
+	}
+	s.send("confirms", "1", "c", "result:nack")
+}
+
+//Returned counts a returned message
+func (s *StatsD) Returned() {
+	s.send("returns", "1", "c")
+}
+
+//Consumed counts a delivery
+func (s *StatsD) Consumed() {
+	s.send("consumed", "1", "c")
+}
+
+//Acked counts an acknowledgement
+func (s *StatsD) Acked() {
+	s.send("acked", "1", "c")
+}
+
+//Nacked counts a nack or reject
+func (s *StatsD) Nacked(requeue bool) {
+	s.send("nacked", "1", "c", fmt.Sprintf("requeue:%v", requeue))
+}
+
+//HandlerDuration sends the handler time as a timing in milliseconds
+func (s *StatsD) HandlerDuration(d time.Duration) {
+	s.send("handler_duration", fmt.Sprintf("%g", float64(d)/float64(time.Millisecond)), "ms")
+}
+
+//Reconnected counts a recovery attempt
+func (s *StatsD) Reconnected() {
+	s.send("reconnects", "1", "c")
+}
+
+//BrokerLatency sends the broker round trip as a timing in milliseconds
+func (s *StatsD) BrokerLatency(d time.Duration) {
+	s.send("broker_latency", fmt.Sprintf("%g", float64(d)/float64(time.Millisecond)), "ms")
+}
+
+//HeartbeatMissed counts a heartbeat timeout
+func (s *StatsD) HeartbeatMissed() {
+	s.send("heartbeat_timeouts", "1", "c")
+}
+
+//Lag sends depth, consume_rate and time_to_drain gauges, time_to_drain is -1 while the queue isn't draining
+func (s *StatsD) Lag(depth int, consumeRate float64, timeToDrain time.Duration) {
+	s.send("depth", fmt.Sprint(depth), "g")
+	s.send("consume_rate", fmt.Sprintf("%g", consumeRate), "g")
+	s.send("time_to_drain", fmt.Sprintf("%g", amqphelper.DrainSeconds(timeToDrain)), "g")
+}
+
+//SlowConsumer sets the slow_consumer gauge to 1 or 0
+func (s *StatsD) SlowConsumer(slow bool) {
+	if slow {
+		s.send("slow_consumer", "1", "g")
+		return
+	}
+	s.send("slow_consumer", "0", "g")
+}
+
+//ConnectionState sets the connected gauge to 1 or 0
+func (s *StatsD) ConnectionState(connected bool) {
+	if connected {
+		s.send("connected", "1", "g")
+		return
+	}
+	s.send("connected", "0", "g")
+}
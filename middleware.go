@@ -0,0 +1,41 @@
+package amqphelper
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Middleware wraps the function processing messages, it can inspect, alter or reject a message before calling next
+type Middleware func(next func(m *Message)) func(m *Message)
+
+//Use appends middleware applied to consumers spawned afterwards, the first one registered is the outermost
+func (q *Queue) Use(mw ...Middleware) {
+	q.middleware = append(q.middleware, mw...)
+}
+
+//PublishFunc sends a message to an exchange with a routing key
+type PublishFunc func(ctx context.Context, exchange, routingKey string, msg *amqp.Publishing) error
+
+//PublishMiddleware wraps the publish path, it runs after the message is timestamped and stamped and before trace context injection, encryption and signing
+type PublishMiddleware func(next PublishFunc) PublishFunc
+
+//UsePublish appends publish middleware, the first one registered is the outermost
+func (q *Queue) UsePublish(mw ...PublishMiddleware) {
+	q.publishMiddleware = append(q.publishMiddleware, mw...)
+}
+
+func (q *Queue) wrap(f func(m *Message)) func(m *Message) {
+	for i := len(q.middleware) - 1; i >= 0; i-- {
+		f = q.middleware[i](f)
+	}
+	return f
+}
+
+//reject discards the message without requeueing, routing it to a dead letter exchange if the queue has one. It is a no-op for auto acknowledged deliveries
+func (m *Message) reject() error {
+	if m.queue != nil && m.queue.config().AutoAcknowledgeMessages {
+		return nil
+	}
+	return m.Reject(false)
+}
@@ -0,0 +1,21 @@
+package amqphelper
+
+import "github.com/vmihailenco/msgpack/v5"
+
+//MsgpackCodec encodes message bodies as application/msgpack, a more compact alternative to JSONCodec
+type MsgpackCodec struct{}
+
+//ContentType returns the content type set on messages marshaled by the codec
+func (MsgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+//Marshal encodes v as MessagePack
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+//Unmarshal decodes MessagePack data into v
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,50 @@
+package amqphelper
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+func acceptsContentType(accepted []string, contentType string) bool {
+	mt := "application/json"
+	if contentType != "" {
+		var err error
+		if mt, _, err = mime.ParseMediaType(contentType); err != nil {
+			return false
+		}
+	}
+	for _, a := range accepted {
+		switch {
+		case a == "*/*" || a == mt:
+			return true
+		case strings.HasSuffix(a, "/*") && strings.HasPrefix(mt, a[:len(a)-1]):
+			return true
+		}
+	}
+	return false
+}
+
+//AcceptContentTypes returns a Middleware that only lets through messages whose content type is in accepted (entries may use type/* wildcards, an empty content type is treated as application/json) and has a registered codec. Other messages go to unsupported, or are logged and rejected when it is nil
+func AcceptContentTypes(unsupported func(m *Message), accepted ...string) Middleware {
+	return func(next func(m *Message)) func(m *Message) {
+		return func(m *Message) {
+			ok := acceptsContentType(accepted, m.ContentType)
+			if ok {
+				_, err := m.queue.codecFor(m.ContentType)
+				ok = err == nil
+			}
+			if !ok {
+				if unsupported != nil {
+					unsupported(m)
+					return
+				}
+				m.logger().Warn("Unsupported content type", m.fields(F("content_type", m.ContentType))...)
+				m.queue.reportError(ErrorScopeValidation, fmt.Errorf("Unsupported content type %q", m.ContentType))
+				m.reject()
+				return
+			}
+			next(m)
+		}
+	}
+}
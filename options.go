@@ -0,0 +1,131 @@
+package amqphelper
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+)
+
+//Option sets a Configuration field for New
+type Option func(c *Configuration)
+
+//New returns a queue connected to host and configured by opts, applied in order over a zero Configuration
+//
+//	q, err := New("amqp://localhost", WithQueue("jobs"), WithDurable(), WithPrefetch(10))
+func New(host string, opts ...Option) (*Queue, error) {
+	return NewContext(context.Background(), host, opts...)
+}
+
+//NewContext is New giving up on connecting when ctx is done
+func NewContext(ctx context.Context, host string, opts ...Option) (*Queue, error) {
+	c := &Configuration{Host: host}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return GetQueueContext(ctx, c)
+}
+
+//WithQueue names the queue, it is also the routing key it is bound and published with
+func WithQueue(name string) Option {
+	return func(c *Configuration) { c.RoutingKey = name }
+}
+
+//WithExchange publishes to exchange and binds the queue to it, declaring it durable with kind unless kind is empty
+func WithExchange(exchange, kind string) Option {
+	return func(c *Configuration) { c.Exchange, c.ExchangeType = exchange, kind }
+}
+
+//WithBindingKeys binds the queue with each key instead of its name
+func WithBindingKeys(keys ...string) Option {
+	return func(c *Configuration) { c.BindingKeys = keys }
+}
+
+//WithDurable declares the queue durable
+func WithDurable() Option {
+	return func(c *Configuration) { c.Durable = true }
+}
+
+//WithExclusive declares the queue exclusive to the connection
+func WithExclusive() Option {
+	return func(c *Configuration) { c.Exclusive = true }
+}
+
+//WithAutoDelete declares the queue deleted once its last consumer is gone
+func WithAutoDelete() Option {
+	return func(c *Configuration) { c.DeleteIfUnused = true }
+}
+
+//WithAutoAck consumes without acknowledgements
+func WithAutoAck() Option {
+	return func(c *Configuration) { c.AutoAcknowledgeMessages = true }
+}
+
+//WithPublishOnly skips declaring and binding the queue
+func WithPublishOnly() Option {
+	return func(c *Configuration) { c.PublishOnly = true }
+}
+
+//WithPrefetch sets the number of unacknowledged deliveries the broker sends ahead
+func WithPrefetch(count int) Option {
+	return func(c *Configuration) { c.PrefetchCount = count }
+}
+
+//WithContentType sets the content type of published messages
+func WithContentType(contentType string) Option {
+	return func(c *Configuration) { c.ContentType = contentType }
+}
+
+//WithCodec sets the codec used by the typed publish and decode helpers
+func WithCodec(codec Codec) Option {
+	return func(c *Configuration) { c.Codec = codec }
+}
+
+//WithConfirms waits for the broker to confirm every publish
+func WithConfirms() Option {
+	return func(c *Configuration) { c.ConfirmPublishes = true }
+}
+
+//WithPersistentMessages publishes messages without a delivery mode as persistent
+func WithPersistentMessages() Option {
+	return func(c *Configuration) { c.PersistentMessages = true }
+}
+
+//WithDeadLetter dead letters rejected messages through exchange to queue, empty names fall back to the Configuration defaults
+func WithDeadLetter(exchange, queue string) Option {
+	return func(c *Configuration) { c.DeadLetterExchange, c.DeadLetterQueue = exchange, queue }
+}
+
+//WithTLS dials the host with cfg
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *Configuration) { c.TLSConfig = cfg }
+}
+
+//WithHeartbeat sets the heartbeat interval negotiated with the broker
+func WithHeartbeat(interval time.Duration) Option {
+	return func(c *Configuration) { c.Heartbeat = interval }
+}
+
+//WithLogger sets the logger
+func WithLogger(l Logger) Option {
+	return func(c *Configuration) { c.Logger = l }
+}
+
+//WithMetrics sets the metrics collector
+func WithMetrics(m Metrics) Option {
+	return func(c *Configuration) { c.Metrics = m }
+}
+
+//WithClock replaces the system clock
+func WithClock(clock Clock) Option {
+	return func(c *Configuration) { c.Clock = clock }
+}
+
+//WithSlowHandlerThreshold reports the consumer slow once handlers took longer than threshold for a whole window, 0 uses DefaultSlowConsumerWindow
+func WithSlowHandlerThreshold(threshold, window time.Duration) Option {
+	return func(c *Configuration) { c.SlowHandlerThreshold, c.SlowConsumerWindow = threshold, window }
+}
+
+//WithConfiguration applies f to the Configuration, for fields without an option of their own
+func WithConfiguration(f func(c *Configuration)) Option {
+	return Option(f)
+}
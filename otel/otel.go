@@ -0,0 +1,87 @@
+//Package otel creates OpenTelemetry spans for amqphelper publishes and handler invocations. It is a module of its own, so only its importers depend on OpenTelemetry
+package otel
+
+import (
+	"context"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/ermyuriel/amqphelper/otel"
+
+var propagator = propagation.TraceContext{}
+
+func attributes(exchange, routingKey, messageID string, size int) []attribute.KeyValue {
+	destination := exchange
+	if destination == "" {
+		destination = routingKey
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination.name", destination),
+		attribute.String("messaging.rabbitmq.destination.routing_key", routingKey),
+		attribute.Int("messaging.message.body.size", size),
+	}
+	if messageID != "" {
+		attrs = append(attrs, attribute.String("messaging.message.id", messageID))
+	}
+	return attrs
+}
+
+//PublishMiddleware returns an amqphelper.PublishMiddleware starting a producer span per publish and propagating it in the message headers
+func PublishMiddleware(tp trace.TracerProvider) amqphelper.PublishMiddleware {
+	tracer := tp.Tracer(instrumentationName)
+	return func(next amqphelper.PublishFunc) amqphelper.PublishFunc {
+		return func(ctx context.Context, exchange, routingKey string, msg *amqp.Publishing) error {
+			attrs := append(attributes(exchange, routingKey, msg.MessageId, len(msg.Body)), attribute.String("messaging.operation.type", "send"))
+			ctx, span := tracer.Start(ctx, routingKey+" publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attrs...))
+			defer span.End()
+
+			carrier := propagation.MapCarrier{}
+			propagator.Inject(ctx, carrier)
+			ctx = amqphelper.ContextWithTraceContext(ctx, amqphelper.TraceContext{TraceParent: carrier.Get("traceparent"), TraceState: carrier.Get("tracestate")})
+
+			err := next(ctx, exchange, routingKey, msg)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	}
+}
+
+//ConsumeMiddleware returns an amqphelper.Middleware starting a consumer span per handler invocation, as a child of the span propagated by the publisher. The span is available to the handler through Message.Context
+func ConsumeMiddleware(tp trace.TracerProvider) amqphelper.Middleware {
+	tracer := tp.Tracer(instrumentationName)
+	return func(next func(m *amqphelper.Message)) func(m *amqphelper.Message) {
+		return func(m *amqphelper.Message) {
+			ctx := m.Context()
+			carrier := propagation.MapCarrier{}
+			if tc, ok := amqphelper.TraceContextFromContext(ctx); ok {
+				carrier.Set("traceparent", tc.TraceParent)
+				if tc.TraceState != "" {
+					carrier.Set("tracestate", tc.TraceState)
+				}
+			}
+			ctx = propagator.Extract(ctx, carrier)
+
+			attrs := append(attributes(m.Exchange, m.RoutingKey, m.MessageID(), len(m.Body)), attribute.String("messaging.operation.type", "process"))
+			ctx, span := tracer.Start(ctx, m.RoutingKey+" process", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attrs...))
+			defer span.End()
+
+			next(m.WithContext(ctx))
+		}
+	}
+}
+
+//Instrument registers both middlewares on the queue
+func Instrument(q *amqphelper.Queue, tp trace.TracerProvider) {
+	q.UsePublish(PublishMiddleware(tp))
+	q.Use(ConsumeMiddleware(tp))
+}
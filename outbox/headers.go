@@ -0,0 +1,80 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//gobPrefix marks headers encoded with gob, rows saved before it are JSON
+const gobPrefix = "gob:"
+
+func init() {
+	gob.Register(amqp.Table{})
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(time.Time{})
+	gob.Register(amqp.Decimal{})
+}
+
+//encodeHeaders encodes headers with gob, which keeps the types amqp.Table allows, integers, byte slices, times and nested tables, unlike JSON
+func encodeHeaders(headers map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(toTable(headers)); err != nil {
+		return "", err
+	}
+	return gobPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+//decodeHeaders decodes what encodeHeaders produced, or the JSON of older rows with nested objects made tables again
+func decodeHeaders(s string) (amqp.Table, error) {
+	if encoded, ok := strings.CutPrefix(s, gobPrefix); ok {
+		b, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		var t amqp.Table
+		if err = gob.NewDecoder(bytes.NewReader(b)).Decode(&t); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, err
+	}
+	return toTable(m), nil
+}
+
+//toTable makes nested maps tables, which is what amqp091 validates and encodes
+func toTable(m map[string]interface{}) amqp.Table {
+	if m == nil {
+		return nil
+	}
+	t := make(amqp.Table, len(m))
+	for k, v := range m {
+		t[k] = toTableValue(v)
+	}
+	return t
+}
+
+func toTableValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return toTable(v)
+	case amqp.Table:
+		return toTable(v)
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = toTableValue(e)
+		}
+		return c
+	}
+	return v
+}
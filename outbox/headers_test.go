@@ -0,0 +1,58 @@
+package outbox
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestHeadersRoundTripKeepsTypes(t *testing.T) {
+	when := time.Unix(1700000000, 0).UTC()
+	s, err := encodeHeaders(map[string]interface{}{
+		"count":  int32(5),
+		"raw":    []byte("x"),
+		"when":   when,
+		"nested": map[string]interface{}{"id": int64(1)},
+		"list":   []interface{}{"a", int16(2)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := decodeHeaders(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = h.Validate(); err != nil {
+		t.Fatalf("decoded headers don't validate: %v", err)
+	}
+	if v, ok := h["count"].(int32); !ok || v != 5 {
+		t.Errorf("count = %#v, want int32(5)", h["count"])
+	}
+	if v, ok := h["raw"].([]byte); !ok || !bytes.Equal(v, []byte("x")) {
+		t.Errorf("raw = %#v, want []byte(\"x\")", h["raw"])
+	}
+	if v, ok := h["when"].(time.Time); !ok || !v.Equal(when) {
+		t.Errorf("when = %#v, want %v", h["when"], when)
+	}
+	if v, ok := h["nested"].(amqp.Table); !ok || v["id"] != int64(1) {
+		t.Errorf("nested = %#v, want amqp.Table{\"id\": int64(1)}", h["nested"])
+	}
+	if v, ok := h["list"].([]interface{}); !ok || len(v) != 2 || v[1] != int16(2) {
+		t.Errorf("list = %#v", h["list"])
+	}
+}
+
+func TestDecodeHeadersReadsLegacyJSON(t *testing.T) {
+	h, err := decodeHeaders(`{"nested":{"a":1}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h["nested"].(amqp.Table); !ok {
+		t.Errorf("nested = %#v, want an amqp.Table", h["nested"])
+	}
+	if err = h.Validate(); err != nil {
+		t.Errorf("legacy headers don't validate: %v", err)
+	}
+}
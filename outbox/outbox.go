@@ -0,0 +1,195 @@
+//Package outbox publishes messages saved in the application's database transactions, so a message is published if and only if the transaction commits
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Default relay settings used when the Outbox fields are 0
+const (
+	DefaultTable     = "amqp_outbox"
+	DefaultBatchSize = 100
+	DefaultInterval  = time.Second
+	//DefaultMaxAttempts is how many failed publishes a row gets before the relay skips it
+	DefaultMaxAttempts = 5
+)
+
+//Placeholder returns the bind parameter for the nth, 1 based, argument of a statement
+type Placeholder func(n int) string
+
+//Dollar numbers parameters as Postgres does
+func Dollar(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+//Question uses ? for every parameter as MySQL and SQLite do
+func Question(n int) string {
+	return "?"
+}
+
+//Message is a message waiting in the outbox. MessageID is generated when empty and stays the same across relay retries, so consumers can deduplicate
+type Message struct {
+	Exchange    string
+	RoutingKey  string
+	ContentType string
+	MessageID   string
+	Headers     map[string]interface{}
+	Body        []byte
+}
+
+//Outbox saves messages in a table and relays them to a queue. The table needs the columns
+//
+//	id          auto incrementing primary key
+//	exchange    text
+//	routing_key text
+//	content_type text
+//	message_id  text
+//	headers     text, gob encoded, rows saved by earlier versions as JSON are still read
+//	body        binary
+//	created_at  timestamp
+//	sent_at     nullable timestamp
+//	attempts    integer, default 0
+//	last_error  nullable text
+//
+//Run a single relay per table, messages are published at least once and in id order. A row whose publish fails for another reason than the broker being unreachable has its attempts counted and the relay moves past it, after MaxAttempts it is no longer relayed and stays in the table with its last_error for inspection
+type Outbox struct {
+	DB *sql.DB
+	//Queue publishes relayed messages, it should have ConfirmPublishes set so rows are only marked once the broker took the message
+	Queue       *amqphelper.Queue
+	Table       string
+	Placeholder Placeholder
+	BatchSize   int
+	Interval    time.Duration
+	MaxAttempts int
+}
+
+//New returns an Outbox relaying from table in db to q
+func New(db *sql.DB, q *amqphelper.Queue, table string, p Placeholder) *Outbox {
+	return &Outbox{DB: db, Queue: q, Table: table, Placeholder: p}
+}
+
+func (o *Outbox) table() string {
+	if o.Table == "" {
+		return DefaultTable
+	}
+	return o.Table
+}
+
+func (o *Outbox) placeholder(n int) string {
+	if o.Placeholder == nil {
+		return Question(n)
+	}
+	return o.Placeholder(n)
+}
+
+//SaveToOutbox inserts msg in tx, it is published by the relay once tx commits
+func (o *Outbox) SaveToOutbox(tx *sql.Tx, msg Message) error {
+	return o.Save(context.Background(), tx, msg)
+}
+
+//Save is SaveToOutbox with a context
+func (o *Outbox) Save(ctx context.Context, tx *sql.Tx, msg Message) error {
+	if msg.MessageID == "" {
+		msg.MessageID = amqphelper.UUIDv4(nil)
+	}
+	headers, err := encodeHeaders(msg.Headers)
+	if err != nil {
+		return err
+	}
+	p := o.placeholder
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (exchange, routing_key, content_type, message_id, headers, body, created_at) VALUES (%s, %s, %s, %s, %s, %s, %s)", o.table(), p(1), p(2), p(3), p(4), p(5), p(6), p(7)),
+		msg.Exchange, msg.RoutingKey, msg.ContentType, msg.MessageID, headers, msg.Body, o.Queue.Clock().Now().UTC())
+	return err
+}
+
+//Relay spawns a goroutine publishing unsent messages every Interval until ctx is done, marking each row sent once it was published. When the broker is unreachable the batch stops and is retried on the next tick, other failures are counted on the row and the relay moves on
+func (o *Outbox) Relay(ctx context.Context) {
+	interval := o.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	go func() {
+		t := o.Queue.Clock().NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C():
+			}
+			if _, err := o.RelayOnce(ctx); err != nil && o.Queue.Configuration().Logger != nil {
+				o.Queue.Configuration().Logger.Warn("Outbox relay failed", amqphelper.F("table", o.table()), amqphelper.F("error", err))
+			}
+		}
+	}()
+}
+
+type row struct {
+	id                   int64
+	msg                  amqp.Publishing
+	exchange, routingKey string
+	headers              string
+}
+
+//RelayOnce publishes one batch of unsent messages and returns how many were sent, with the failures of the rows it moved past joined
+func (o *Outbox) RelayOnce(ctx context.Context) (int, error) {
+	batch := o.BatchSize
+	if batch == 0 {
+		batch = DefaultBatchSize
+	}
+	maxAttempts := o.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	rows, err := o.DB.QueryContext(ctx, fmt.Sprintf("SELECT id, exchange, routing_key, content_type, message_id, headers, body FROM %s WHERE sent_at IS NULL AND attempts < %d ORDER BY id LIMIT %d", o.table(), maxAttempts, batch))
+	if err != nil {
+		return 0, err
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err = rows.Scan(&r.id, &r.exchange, &r.routingKey, &r.msg.ContentType, &r.msg.MessageId, &r.headers, &r.msg.Body); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	mark := fmt.Sprintf("UPDATE %s SET sent_at = %s WHERE id = %s", o.table(), o.placeholder(1), o.placeholder(2))
+	fail := fmt.Sprintf("UPDATE %s SET attempts = attempts + 1, last_error = %s WHERE id = %s", o.table(), o.placeholder(1), o.placeholder(2))
+	sent := 0
+	var failed []error
+	for _, r := range pending {
+		r.msg.Headers, err = decodeHeaders(r.headers)
+		if err == nil {
+			err = o.Queue.PublishTo(ctx, r.exchange, r.routingKey, r.msg, false, false)
+		}
+		if err != nil {
+			//the broker being down isn't the row's fault, its attempts are left alone
+			if errors.Is(err, amqphelper.ErrNotConnected) || errors.Is(err, amqphelper.ErrChannelClosed) || ctx.Err() != nil {
+				return sent, err
+			}
+			failed = append(failed, fmt.Errorf("Outbox row %d: %w", r.id, err))
+			if _, uerr := o.DB.ExecContext(ctx, fail, err.Error(), r.id); uerr != nil {
+				return sent, uerr
+			}
+			continue
+		}
+		if _, err = o.DB.ExecContext(ctx, mark, o.Queue.Clock().Now().UTC(), r.id); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, errors.Join(failed...)
+}
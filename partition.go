@@ -0,0 +1,81 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//ConsistentHashExchange is the exchange type of the rabbitmq_consistent_hash_exchange plugin, which routes by a hash of the routing key
+const ConsistentHashExchange = "x-consistent-hash"
+
+//Partitions spreads messages over queues bound to a consistent hash exchange, so every message with the same key lands in the same queue and is consumed in order
+type Partitions struct {
+	exchange string
+	queues   []*Queue
+}
+
+//NewPartitions declares exchange as a durable consistent hash exchange and one durable queue per weight, named exchange.N and bound with that weight (a partition with weight 2 gets twice the keys of one with 1). Queues are declared with single active consumer, so any number of instances can consume every partition while only one of them receives a partition's messages at a time
+func NewPartitions(config *Configuration, exchange string, weights []int) (*Partitions, error) {
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("No partitions for exchange %s", exchange)
+	}
+	p := &Partitions{exchange: exchange}
+	for i, w := range weights {
+		c := *config
+		c.Exchange, c.ExchangeType, c.RoutingKey, c.BindingKeys, c.Durable = exchange, ConsistentHashExchange, fmt.Sprintf("%s.%d", exchange, i), []string{strconv.Itoa(w)}, true
+		c.arguments = cloneTable(config.arguments)
+		c.arguments["x-single-active-consumer"] = true
+		q, err := GetQueue(&c)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.queues = append(p.queues, q)
+	}
+	return p, nil
+}
+
+//Publish sends body to the partition key hashes to
+func (p *Partitions) Publish(ctx context.Context, key string, body []byte, headers map[string]interface{}) error {
+	q := p.queues[0]
+	cfg := q.config()
+	msg := amqp.Publishing{ContentType: cfg.ContentType, ContentEncoding: cfg.ContentEncoding, Headers: headers, Body: body}
+	return q.PublishTo(ctx, p.exchange, key, msg, false, false)
+}
+
+//Consume spawns a single consumer on each partition, or on the given partition indexes only, handling its messages one at a time in order. Queue.Run on any partition queue should be called next
+func (p *Partitions) Consume(f func(m *Message), partitions ...int) error {
+	if len(partitions) == 0 {
+		for i := range p.queues {
+			partitions = append(partitions, i)
+		}
+	}
+	for _, i := range partitions {
+		if i < 0 || i >= len(p.queues) {
+			return fmt.Errorf("No partition %d for exchange %s", i, p.exchange)
+		}
+		if err := p.queues[i].SpawnWorkers("partition", 1, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Queues returns the partition queues in order
+func (p *Partitions) Queues() []*Queue {
+	return p.queues
+}
+
+//Close closes every partition queue
+func (p *Partitions) Close() error {
+	var err error
+	for _, q := range p.queues {
+		if cerr := q.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+//Package pipeline chains queues into multi stage processing, each stage's handler returns the payload published to the next one
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//ErrDrop can be returned by a stage to ack its message without passing anything on
+var ErrDrop = fmt.Errorf("Message dropped by pipeline stage")
+
+//Stage is a pipeline step consumed from its own queue by Workers consumers, 1 when 0
+type Stage struct {
+	Name    string
+	Workers int
+	Handle  func(ctx context.Context, in []byte, m *amqphelper.Message) ([]byte, error)
+}
+
+//Pipeline runs a sequence of stages, each bound to a durable queue named after the pipeline and the stage. Stages get the decrypted and decompressed payload, their output keeps the headers and properties of the message that entered the pipeline and is encrypted and signed again as the stage queue's configuration says
+type Pipeline struct {
+	//Sink receives the output of the last stage, it may be nil. A failing Sink requeues the message
+	Sink func(ctx context.Context, out []byte, m *amqphelper.Message) error
+	//OnError is called when a stage fails, before its message is rejected, it may be nil
+	OnError func(stage string, m *amqphelper.Message, err error)
+
+	name   string
+	stages []Stage
+	queues []*amqphelper.Queue
+}
+
+//New connects a queue named name.stage for each stage, config supplies the host and other options. Set config.DeadLetterExchange to keep messages rejected by failing stages, each stage then gets its own dead letter queue
+func New(config *amqphelper.Configuration, name string, stages ...Stage) (*Pipeline, error) {
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("Pipeline %s has no stages", name)
+	}
+	p := &Pipeline{name: name, stages: stages}
+	for _, st := range stages {
+		c := *config
+		c.RoutingKey, c.Durable, c.PersistentMessages, c.AutoAcknowledgeMessages = name+"."+st.Name, true, true, false
+		c.DeadLetterRoutingKey, c.DeadLetterQueue = "", ""
+		q, err := amqphelper.GetQueue(&c)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.queues = append(p.queues, q)
+	}
+	return p, nil
+}
+
+//Publish feeds body into the first stage
+func (p *Pipeline) Publish(ctx context.Context, body []byte, headers map[string]interface{}) error {
+	return p.queues[0].PublishWithContext(ctx, body, headers, false, false)
+}
+
+//Run spawns every stage's consumers, Queue.Run on any stage queue should be called next. A stage's output is published to the next stage before its message is acked, an error other than ErrDrop rejects it
+func (p *Pipeline) Run() error {
+	for i, st := range p.stages {
+		i := i
+		n := st.Workers
+		if n < 1 {
+			n = 1
+		}
+		err := p.queues[i].SpawnWorkers(p.name+"-"+st.Name, n, func(m *amqphelper.Message) {
+			p.handle(i, m)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) handle(i int, m *amqphelper.Message) {
+	st := p.stages[i]
+	ctx := m.Context()
+	var out []byte
+	in, err := m.Payload()
+	if err == nil {
+		out, err = st.Handle(ctx, in, m)
+	}
+	if err == ErrDrop {
+		m.Ack(false)
+		return
+	}
+	if err != nil {
+		m.Logger().Warn("Pipeline stage failed", amqphelper.F("pipeline", p.name), amqphelper.F("stage", st.Name), amqphelper.F("error", err))
+		if p.OnError != nil {
+			p.OnError(st.Name, m, err)
+		}
+		m.Reject(false)
+		return
+	}
+
+	if i == len(p.stages)-1 {
+		if p.Sink != nil {
+			err = p.Sink(ctx, out, m)
+		}
+	} else {
+		err = p.forward(ctx, i+1, m, out)
+	}
+	if err != nil {
+		m.Logger().Error("Could not pass pipeline output on", amqphelper.F("pipeline", p.name), amqphelper.F("stage", st.Name), amqphelper.F("error", err))
+		m.Nack(false, true)
+		return
+	}
+	m.Ack(false)
+}
+
+func (p *Pipeline) forward(ctx context.Context, i int, m *amqphelper.Message, body []byte) error {
+	q := p.queues[i]
+	d := m.Delivery
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	for _, h := range []string{amqphelper.EncryptionHeader, amqphelper.EncryptionKeyHeader, amqphelper.SignatureHeader, amqphelper.SignatureAlgorithmHeader} {
+		delete(headers, h)
+	}
+	msg := amqp.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		CorrelationId: d.CorrelationId,
+		MessageId:     d.MessageId,
+		Type:          d.Type,
+		AppId:         d.AppId,
+		Body:          body,
+	}
+	return q.PublishTo(ctx, q.Configuration().Exchange, q.Configuration().RoutingKey, msg, false, false)
+}
+
+//Queues returns the stage queues in order
+func (p *Pipeline) Queues() []*amqphelper.Queue {
+	return p.queues
+}
+
+//Close closes every stage queue
+func (p *Pipeline) Close() error {
+	var err error
+	for _, q := range p.queues {
+		if cerr := q.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
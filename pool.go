@@ -0,0 +1,65 @@
+package amqphelper
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//channelPool holds the publishing channels of Configuration.PublisherChannels, a publish takes one for itself until it is sent and, in confirm mode, confirmed
+type channelPool struct {
+	channels []*pooledChannel
+	idle     chan *pooledChannel
+}
+
+//pooledChannel is only used by the publish holding it
+type pooledChannel struct {
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
+	seq      uint64
+}
+
+func (q *Queue) openChannelPool(conn *amqp.Connection, n int) (*channelPool, error) {
+	p := &channelPool{idle: make(chan *pooledChannel, n)}
+	for i := 0; i < n; i++ {
+		ch, err := conn.Channel()
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		pc := &pooledChannel{ch: ch}
+		p.channels = append(p.channels, pc)
+		if q.config().ConfirmPublishes {
+			if err = ch.Confirm(false); err != nil {
+				p.close()
+				return nil, err
+			}
+			pc.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+		}
+		go q.handleReturns(ch.NotifyReturn(make(chan amqp.Return, 1)))
+		p.idle <- pc
+	}
+	return p, nil
+}
+
+//send publishes on an idle channel, waiting for one until ctx is done
+func (p *channelPool) send(ctx context.Context, q *Queue, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+	var pc *pooledChannel
+	select {
+	case pc = <-p.idle:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { p.idle <- pc }()
+	if !q.config().ConfirmPublishes {
+		return wrapError(pc.ch.PublishWithContext(ctx, exchange, routingKey, mandatory, immediate, msg))
+	}
+	return q.confirmedSend(ctx, pc.ch, pc.confirms, &pc.seq, exchange, routingKey, msg, mandatory, immediate)
+}
+
+//close closes the pool's channels, publishes holding one fail and the queue recovers
+func (p *channelPool) close() {
+	for _, pc := range p.channels {
+		pc.ch.Close()
+	}
+}
@@ -0,0 +1,113 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//AdaptivePrefetch bounds and paces the prefetch count TunePrefetch adjusts, zero values get the defaults
+type AdaptivePrefetch struct {
+	//Min and Max bound the prefetch count, 1 and 1000 by default
+	Min int
+	Max int
+	//TargetLatency is the average handler latency over an interval above which the prefetch count is cut
+	TargetLatency time.Duration
+	//Interval is how often latency is sampled and the prefetch count adjusted, 5 seconds by default
+	Interval time.Duration
+	//Increase is added to the prefetch count after an interval under TargetLatency that used the whole window, 1 by default
+	Increase int
+	//Decrease multiplies the prefetch count after an interval over TargetLatency, 0.5 by default
+	Decrease float64
+}
+
+func (a AdaptivePrefetch) withDefaults() AdaptivePrefetch {
+	if a.Min <= 0 {
+		a.Min = 1
+	}
+	if a.Max <= 0 {
+		a.Max = 1000
+	}
+	if a.Interval <= 0 {
+		a.Interval = 5 * time.Second
+	}
+	if a.Increase <= 0 {
+		a.Increase = 1
+	}
+	if a.Decrease <= 0 || a.Decrease >= 1 {
+		a.Decrease = 0.5
+	}
+	return a
+}
+
+//TunePrefetch spawns a goroutine that adjusts the channel's prefetch count until ctx is done, additive increase multiplicative decrease: every interval, if handlers averaged over TargetLatency the count is multiplied by Decrease, if they stayed under it and at least a count's worth of messages was handled, so consumers were kept busy by the window, Increase is added. It starts from Configuration.PrefetchCount, which is left unchanged, and is applied again after a recovery. Intervals without handled messages leave the count as is
+func (q *Queue) TunePrefetch(ctx context.Context, a AdaptivePrefetch) {
+	a = a.withDefaults()
+	prefetch := q.config().PrefetchCount
+	if prefetch < a.Min {
+		prefetch = a.Min
+	}
+	if prefetch > a.Max {
+		prefetch = a.Max
+	}
+	go func() {
+		t := q.Clock().NewTicker(a.Interval)
+		defer t.Stop()
+		applied := q.applyPrefetch(prefetch)
+		handled, nanos := q.stats.handled.Load(), q.stats.handlerNanos.Load()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C():
+			}
+			//a handler finishing between the loads is counted in the next interval's latency
+			h, n := q.stats.handled.Load(), q.stats.handlerNanos.Load()
+			dHandled, dNanos := h-handled, n-nanos
+			handled, nanos = h, n
+
+			next := prefetch
+			if dHandled > 0 {
+				latency := time.Duration(dNanos / dHandled)
+				switch {
+				case a.TargetLatency > 0 && latency > a.TargetLatency:
+					next = int(float64(prefetch) * a.Decrease)
+				case dHandled >= int64(prefetch):
+					next = prefetch + a.Increase
+				}
+			}
+			if next < a.Min {
+				next = a.Min
+			}
+			if next > a.Max {
+				next = a.Max
+			}
+			if next != prefetch {
+				q.record(Event{Type: EventPrefetchAdjusted, Reason: fmt.Sprintf("%d -> %d", prefetch, next)})
+				q.debug("Prefetch adjusted", F("queue", q.config().RoutingKey), F("from", prefetch), F("to", next))
+				prefetch = next
+				applied = nil
+			}
+			if applied != q.channel {
+				applied = q.applyPrefetch(prefetch)
+			}
+		}
+	}()
+}
+
+//applyPrefetch sets the prefetch count on the current channel and returns it, nil when it couldn't be set so it is tried again on the next interval
+func (q *Queue) applyPrefetch(prefetch int) *amqp.Channel {
+	cfg := q.config()
+	ch := q.channel
+	if ch == nil {
+		return nil
+	}
+	if err := ch.Qos(prefetch, cfg.PrefetchByteSize, true); err != nil {
+		q.logger().Warn("Could not set prefetch", F("queue", cfg.RoutingKey), F("prefetch", prefetch), F("error", err))
+		return nil
+	}
+	q.stats.prefetch.Store(int64(prefetch))
+	return ch
+}
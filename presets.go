@@ -0,0 +1,37 @@
+package amqphelper
+
+import amqp "github.com/rabbitmq/amqp091-go"
+
+//PresetRetries is how many times NewDurableWorkQueue retries a failed task before dead lettering it
+const PresetRetries = 3
+
+//NewDurableWorkQueue returns a WorkQueue for name that survives broker restarts: durable, persistent and confirmed publishes, manual acks with a prefetch of 1 for fair dispatch, PresetRetries retries and a dead letter queue name.dead behind the name.dlx exchange for tasks that ran out of them
+func NewDurableWorkQueue(host, name string) (*WorkQueue, error) {
+	return NewWorkQueue(&Configuration{
+		Host:               host,
+		RoutingKey:         name,
+		ConfirmPublishes:   true,
+		DeadLetterExchange: name + ".dlx",
+	}, 1, RetryPolicy{MaxRetries: PresetRetries})
+}
+
+//NewTransientPubSub returns a queue publishing to the fanout exchange and consuming its own copy of every message through a server named, exclusive and auto deleted queue bound to it, which disappears with the connection. Messages are auto acknowledged and not persisted, so subscribers only see what is published while they are connected
+func NewTransientPubSub(host, exchange string) (*Queue, error) {
+	return GetQueue(&Configuration{
+		Host:                    host,
+		Exchange:                exchange,
+		ExchangeType:            amqp.ExchangeFanout,
+		Exclusive:               true,
+		DeleteIfUnused:          true,
+		AutoAcknowledgeMessages: true,
+	})
+}
+
+//NewRPCQueue returns a queue for name suited to rpc servers and clients: transient since a request outliving a restart has no caller left to answer, with manual acks so a request is only settled once its reply went out and a prefetch of 1 so each request goes to an idle server
+func NewRPCQueue(host, name string) (*Queue, error) {
+	return GetQueue(&Configuration{
+		Host:          host,
+		RoutingKey:    name,
+		PrefetchCount: 1,
+	})
+}
@@ -0,0 +1,87 @@
+package amqphelper
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//BrokerMetrics is implemented by Metrics that also want broker round trip latencies and heartbeat timeouts
+type BrokerMetrics interface {
+	BrokerLatency(d time.Duration)
+	HeartbeatMissed()
+}
+
+//isHeartbeatTimeout reports whether a connection closed because the broker went silent for longer than the heartbeat allows, which the client sees as a read timeout
+func isHeartbeatTimeout(err *amqp.Error) bool {
+	return err != nil && strings.Contains(err.Reason, "i/o timeout")
+}
+
+func (q *Queue) heartbeatMissed() {
+	q.logger().Warn("Broker heartbeat timeout", F("queue", q.config().RoutingKey))
+	q.record(Event{Type: EventHeartbeatMissed})
+	if bm, ok := q.metrics().(BrokerMetrics); ok {
+		bm.HeartbeatMissed()
+	}
+}
+
+//BrokerLatency returns the last round trip time measured by MonitorLatency, 0 before the first probe
+func (q *Queue) BrokerLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&q.brokerLatency))
+}
+
+//MonitorLatency spawns a goroutine that measures the broker round trip every interval until ctx is done, by passively declaring the queue on a dedicated channel. PublishOnly queues declare none and aren't probed. Round trips longer than threshold are logged and journaled as EventLatencyAnomaly, a zero threshold disables that check
+func (q *Queue) MonitorLatency(ctx context.Context, interval, threshold time.Duration) {
+	go func() {
+		t := q.Clock().NewTicker(interval)
+		defer t.Stop()
+		var ch *amqp.Channel
+		defer func() {
+			if ch != nil {
+				ch.Close()
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C():
+			}
+			cfg := q.config()
+			if cfg.PublishOnly {
+				continue
+			}
+			if ch == nil {
+				if q.connection == nil || q.connection.IsClosed() {
+					continue
+				}
+				var err error
+				if ch, err = q.connection.Channel(); err != nil {
+					ch = nil
+					continue
+				}
+			}
+			name := q.Name()
+			start := q.Clock().Now()
+			_, err := ch.QueueDeclarePassive(name, cfg.Durable, cfg.DeleteIfUnused, cfg.Exclusive, false, q.queueArguments())
+			d := q.Clock().Now().Sub(start)
+			if err != nil {
+				q.logger().Warn("Latency probe failed", F("queue", name), F("error", err))
+				ch.Close()
+				ch = nil
+				continue
+			}
+			atomic.StoreInt64(&q.brokerLatency, int64(d))
+			if bm, ok := q.metrics().(BrokerMetrics); ok {
+				bm.BrokerLatency(d)
+			}
+			if threshold > 0 && d > threshold {
+				q.logger().Warn("Broker latency anomaly", F("queue", name), F("latency", d), F("threshold", threshold))
+				q.record(Event{Type: EventLatencyAnomaly, Reason: d.String()})
+			}
+		}
+	}()
+}
@@ -0,0 +1,106 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+)
+
+//ProtoTypeHeader carries the fully qualified protobuf message name on messages published with PublishProto
+const ProtoTypeHeader = "x-proto-type"
+
+//ProtoCodec encodes message bodies as application/x-protobuf, values must implement proto.Message
+type ProtoCodec struct{}
+
+//ContentType returns the content type set on messages marshaled by the codec
+func (ProtoCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+//Marshal encodes v, which must be a proto.Message
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Marshal(pm)
+}
+
+//Unmarshal decodes data into v, which must be a proto.Message
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, pm)
+}
+
+func init() {
+	RegisterCodec("application/x-protobuf", ProtoCodec{})
+	RegisterCodec("application/protobuf", ProtoCodec{})
+}
+
+//PublishProto publishes a protobuf message, setting the x-proto-type header to its full name
+func (q *Queue) PublishProto(v proto.Message, headers map[string]interface{}, mandatory, immediate bool) error {
+	body, err := proto.Marshal(v)
+	if err != nil {
+		return err
+	}
+	h := cloneTable(headers)
+	name := string(v.ProtoReflect().Descriptor().FullName())
+	h[ProtoTypeHeader] = name
+	return q.publish(context.Background(), amqp.Publishing{ContentType: ProtoCodec{}.ContentType(), ContentEncoding: q.config().ContentEncoding, Body: body, Headers: h, Type: name}, mandatory, immediate)
+}
+
+//ProtoDispatcher routes deliveries to handlers registered per protobuf message type using the x-proto-type header
+type ProtoDispatcher struct {
+	handlers map[string]func(m *Message) error
+	//Fallback receives messages with a missing or unregistered type. When nil they are logged and rejected
+	Fallback func(m *Message)
+}
+
+//NewProtoDispatcher returns an empty ProtoDispatcher
+func NewProtoDispatcher() *ProtoDispatcher {
+	return &ProtoDispatcher{handlers: map[string]func(m *Message) error{}}
+}
+
+//Handle registers f for messages of type T on the dispatcher, T is a generated message pointer type such as *orders.OrderCreated
+func Handle[T proto.Message](d *ProtoDispatcher, f func(v T, m *Message)) {
+	var zero T
+	mt := zero.ProtoReflect().Type()
+	d.handlers[string(mt.Descriptor().FullName())] = func(m *Message) error {
+		v := mt.New().Interface().(T)
+		body, err := m.payload()
+		if err != nil {
+			return err
+		}
+		if err = proto.Unmarshal(body, v); err != nil {
+			return err
+		}
+		f(v, m)
+		return nil
+	}
+}
+
+//Dispatch decodes the message and invokes the handler registered for its type, it can be passed directly to SpawnWorkers
+func (d *ProtoDispatcher) Dispatch(m *Message) {
+	name, _ := m.HeaderTable()[ProtoTypeHeader].(string)
+	h, ok := d.handlers[name]
+	if !ok {
+		if d.Fallback != nil {
+			d.Fallback(m)
+			return
+		}
+		m.logger().Warn("No handler registered for proto type", m.fields(F("type", name))...)
+		m.queue.reportError(ErrorScopeValidation, fmt.Errorf("No handler registered for proto type %q", name))
+		m.reject()
+		return
+	}
+	if err := h(m); err != nil {
+		m.logger().Warn("Could not handle proto message", m.fields(F("type", name), F("error", err))...)
+		m.queue.reportError(ErrorScopeDecode, err)
+		m.reject()
+	}
+}
@@ -0,0 +1,46 @@
+package amqphelper
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//PublishTarget is a destination of PublishAll
+type PublishTarget struct {
+	Exchange   string
+	RoutingKey string
+	Headers    map[string]interface{}
+}
+
+type txChannelKey struct{}
+
+//PublishAll publishes body to every target inside an AMQP transaction on a dedicated channel, so the broker accepts either all of the publishes or none of them. The transaction doesn't make them routed: a target whose exchange routes the message to no queue drops it and the commit still succeeds, the publishes aren't mandatory. Messages go through the same stamping, encryption and middleware as Publish, a failed publish or commit rolls the transaction back
+func (q *Queue) PublishAll(ctx context.Context, targets []PublishTarget, body []byte) error {
+	cfg := q.config()
+	if q.connection == nil {
+		return ErrNotConnected
+	}
+	ch, err := q.connection.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	if err = ch.Tx(); err != nil {
+		return err
+	}
+
+	txCtx := context.WithValue(ctx, txChannelKey{}, ch)
+	for _, t := range targets {
+		msg := amqp.Publishing{ContentType: cfg.ContentType, ContentEncoding: cfg.ContentEncoding, Headers: t.Headers, Body: body}
+		if err = q.publishTo(txCtx, t.Exchange, t.RoutingKey, msg, false, false); err != nil {
+			ch.TxRollback()
+			return err
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		ch.TxRollback()
+		return err
+	}
+	return ch.TxCommit()
+}
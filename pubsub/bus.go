@@ -0,0 +1,85 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//EventBus publishes events by topic and subscribes handlers to topic patterns over a single topic exchange
+type EventBus struct {
+	config    amqphelper.Configuration
+	exchange  string
+	publisher *amqphelper.Queue
+	mu        sync.Mutex
+	subs      []*Subscription
+}
+
+//NewEventBus connects with config, which supplies the host and options shared by the publisher and subscriptions, and declares exchange as a durable topic exchange
+func NewEventBus(config *amqphelper.Configuration, exchange string) (*EventBus, error) {
+	c := *config
+	c.Exchange, c.ExchangeType, c.RoutingKey, c.PublishOnly = exchange, amqp.ExchangeTopic, "", true
+	q, err := amqphelper.GetQueue(&c)
+	if err != nil {
+		return nil, err
+	}
+	return &EventBus{config: *config, exchange: exchange, publisher: q}, nil
+}
+
+//Publish marshals payload with the bus' codec and publishes it with topic as its routing key and type
+func (b *EventBus) Publish(ctx context.Context, topic string, payload interface{}) error {
+	c := b.publisher.Codec()
+	body, err := c.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	msg := amqp.Publishing{ContentType: c.ContentType(), ContentEncoding: b.config.ContentEncoding, Type: topic, Body: body}
+	return b.publisher.PublishTo(ctx, b.exchange, topic, msg, false, false)
+}
+
+//Subscribe handles events whose topic matches pattern on a private queue that only receives events while the subscription is open. f decodes payloads with Message.Decode and must ack them unless the bus' configuration sets AutoAcknowledgeMessages
+func (b *EventBus) Subscribe(pattern string, f func(m *amqphelper.Message)) (*Subscription, error) {
+	return b.track(SubscribeTopic(&b.config, b.exchange, []string{pattern}, f))
+}
+
+//SubscribeDurable handles events whose topic matches pattern on a durable queue named name, which keeps events while no one is subscribed and spreads them over every instance subscribing with the same name
+func (b *EventBus) SubscribeDurable(name, pattern string, f func(m *amqphelper.Message)) (*Subscription, error) {
+	c := b.config
+	c.Exchange, c.ExchangeType, c.RoutingKey, c.BindingKeys, c.Durable, c.PublishOnly = b.exchange, amqp.ExchangeTopic, name, []string{pattern}, true, false
+	q, err := amqphelper.GetQueue(&c)
+	if err != nil {
+		return nil, err
+	}
+	if err = q.SpawnWorkers("subscriber", 1, f); err != nil {
+		q.Close()
+		return nil, err
+	}
+	return b.track(&Subscription{q}, nil)
+}
+
+func (b *EventBus) track(s *Subscription, err error) (*Subscription, error) {
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	b.subs = append(b.subs, s)
+	b.mu.Unlock()
+	return s, nil
+}
+
+//Close closes the bus' publisher and every subscription made through it
+func (b *EventBus) Close() error {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs = nil
+	b.mu.Unlock()
+	err := b.publisher.Close()
+	for _, s := range subs {
+		if cerr := s.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+//Package pubsub broadcasts messages to every subscriber of an exchange, declaring the exchange and a private queue per subscriber
+package pubsub
+
+import (
+	"context"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Publisher publishes to a fanout exchange
+type Publisher struct {
+	queue *amqphelper.Queue
+}
+
+//NewPublisher connects with config, which supplies the host and options such as Logger or ConfirmPublishes, and declares exchange as a durable fanout exchange
+func NewPublisher(config *amqphelper.Configuration, exchange string) (*Publisher, error) {
+	c := *config
+	c.Exchange, c.ExchangeType, c.RoutingKey, c.PublishOnly = exchange, amqp.ExchangeFanout, "", true
+	q, err := amqphelper.GetQueue(&c)
+	if err != nil {
+		return nil, err
+	}
+	return &Publisher{q}, nil
+}
+
+//Publish sends body to every subscriber
+func (p *Publisher) Publish(ctx context.Context, body []byte, headers map[string]interface{}) error {
+	return p.queue.PublishWithContext(ctx, body, headers, false, false)
+}
+
+//Queue returns the underlying queue, to register publish middleware or read Stats
+func (p *Publisher) Queue() *amqphelper.Queue {
+	return p.queue
+}
+
+//Close closes the publisher's connection
+func (p *Publisher) Close() error {
+	return p.queue.Close()
+}
+
+//Subscription is a subscriber's private queue, deleted by the broker once the subscription is closed
+type Subscription struct {
+	queue *amqphelper.Queue
+}
+
+//Subscribe declares exchange as a durable fanout exchange and binds an exclusive, auto deleted queue to it, handling everything published there with f, which must ack messages unless config sets AutoAcknowledgeMessages
+func Subscribe(config *amqphelper.Configuration, exchange string, f func(m *amqphelper.Message)) (*Subscription, error) {
+	c := *config
+	c.Exchange, c.ExchangeType, c.RoutingKey = exchange, amqp.ExchangeFanout, ""
+	return subscribe(&c, f)
+}
+
+func subscribe(c *amqphelper.Configuration, f func(m *amqphelper.Message)) (*Subscription, error) {
+	c.Exclusive, c.DeleteIfUnused, c.Durable, c.PublishOnly = true, true, false, false
+	q, err := amqphelper.GetQueue(c)
+	if err != nil {
+		return nil, err
+	}
+	err = q.SpawnWorkers("subscriber", 1, f)
+	if err != nil {
+		q.Close()
+		return nil, err
+	}
+	return &Subscription{q}, nil
+}
+
+//Queue returns the subscription's queue
+func (s *Subscription) Queue() *amqphelper.Queue {
+	return s.queue
+}
+
+//Close stops the subscription, its queue is deleted with it
+func (s *Subscription) Close() error {
+	return s.queue.Close()
+}
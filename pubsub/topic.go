@@ -0,0 +1,43 @@
+package pubsub
+
+import (
+	"strings"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//SubscribeTopic declares exchange as a durable topic exchange and binds an exclusive, auto deleted queue to it once for every pattern, such as orders.*.created or orders.#. The routing key a message was published with is m.RoutingKey, Match tells which pattern it matched
+func SubscribeTopic(config *amqphelper.Configuration, exchange string, patterns []string, f func(m *amqphelper.Message)) (*Subscription, error) {
+	c := *config
+	c.Exchange, c.ExchangeType, c.RoutingKey, c.BindingKeys = exchange, amqp.ExchangeTopic, "", append([]string(nil), patterns...)
+	return subscribe(&c, f)
+}
+
+//Match reports whether routingKey matches the topic pattern, where * stands for exactly one dot separated word and # for zero or more
+func Match(pattern, routingKey string) bool {
+	return match(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func match(pattern, words []string) bool {
+	for i, p := range pattern {
+		switch p {
+		case "#":
+			for j := i; j <= len(words); j++ {
+				if match(pattern[i+1:], words[j:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(words) <= i {
+				return false
+			}
+		default:
+			if len(words) <= i || words[i] != p {
+				return false
+			}
+		}
+	}
+	return len(words) == len(pattern)
+}
@@ -0,0 +1,60 @@
+package amqphelper
+
+import (
+	"net/url"
+	"strings"
+)
+
+const redactedPassword = "xxxxx"
+
+//SafeURI returns uri with its password replaced by xxxxx, for logs and error messages. URIs that don't parse are masked between the first colon of their user info and the @
+func SafeURI(uri string) string {
+	if u, err := url.Parse(uri); err == nil {
+		return u.Redacted()
+	}
+	scheme := strings.Index(uri, "://")
+	at := strings.LastIndex(uri, "@")
+	if scheme < 0 || at < scheme {
+		return uri
+	}
+	userinfo := uri[scheme+3 : at]
+	if colon := strings.Index(userinfo, ":"); colon >= 0 {
+		return uri[:scheme+3] + userinfo[:colon+1] + redactedPassword + uri[at:]
+	}
+	return uri
+}
+
+//SafeURI returns Host with its password redacted
+func (c *Configuration) SafeURI() string {
+	return SafeURI(c.Host)
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+//RedactError returns err with uri, and its password wherever it appears alone, replaced in the message by SafeURI(uri). The original error is still reachable through errors.Is and errors.As
+func RedactError(err error, uri string) error {
+	if err == nil || uri == "" {
+		return err
+	}
+	msg := err.Error()
+	safe := strings.ReplaceAll(msg, uri, SafeURI(uri))
+	if u, perr := url.Parse(uri); perr == nil {
+		if pass, ok := u.User.Password(); ok && pass != "" {
+			safe = strings.ReplaceAll(safe, pass, redactedPassword)
+		}
+	} else if scheme, at := strings.Index(uri, "://"), strings.LastIndex(uri, "@"); scheme >= 0 && at > scheme {
+		if colon := strings.Index(uri[scheme+3:at], ":"); colon >= 0 && colon+1 < at-scheme-3 {
+			safe = strings.ReplaceAll(safe, uri[scheme+3+colon+1:at], redactedPassword)
+		}
+	}
+	if safe == msg {
+		return err
+	}
+	return &redactedError{safe, err}
+}
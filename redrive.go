@@ -0,0 +1,131 @@
+package amqphelper
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	//RedriveCountHeader counts how many times a dead lettered message was re-driven
+	RedriveCountHeader = "x-redrive-count"
+	//RedriveFirstHeader holds when a message was first dead lettered, as milliseconds since the Unix epoch
+	RedriveFirstHeader = "x-redrive-first"
+	//RedriveLastHeader holds when a message was last re-driven, as milliseconds since the Unix epoch
+	RedriveLastHeader = "x-redrive-last"
+)
+
+//Redriver periodically publishes dead lettered messages back to where they were first published, waiting Schedule[n] after the nth attempt. Messages older than MaxAge, or that used up the schedule, are moved to the Archive queue
+type Redriver struct {
+	DLQ      string
+	Archive  string
+	Schedule []time.Duration
+	//MaxAge is counted from the first time a message was dead lettered, 0 disables it
+	MaxAge time.Duration
+
+	queue *Queue
+}
+
+//NewRedriver returns a Redriver for dlq publishing through q, archiving to dlq.archive
+func (q *Queue) NewRedriver(dlq string, schedule []time.Duration, maxAge time.Duration) *Redriver {
+	return &Redriver{DLQ: dlq, Archive: dlq + ".archive", Schedule: schedule, MaxAge: maxAge, queue: q}
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+//Run spawns a goroutine calling RedriveOnce every interval until ctx is done
+func (r *Redriver) Run(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := r.queue.Clock().NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C():
+			}
+			redriven, archived, err := r.RedriveOnce(ctx)
+			if err != nil {
+				r.queue.logger().Warn("Dead letter re-drive failed", F("queue", r.DLQ), F("error", err))
+				r.queue.reportError(ErrorScopeRecover, err)
+				continue
+			}
+			if redriven > 0 || archived > 0 {
+				r.queue.logger().Info("Dead letters re-driven", F("queue", r.DLQ), F("redriven", redriven), F("archived", archived))
+			}
+		}
+	}()
+}
+
+//RedriveOnce goes through the dead letter queue once on a dedicated channel, re-driving messages that are due, archiving expired ones and leaving the rest in place
+func (r *Redriver) RedriveOnce(ctx context.Context) (redriven, archived int, err error) {
+	q := r.queue
+	if q.connection == nil {
+		return 0, 0, ErrNotConnected
+	}
+	ch, err := q.connection.Channel()
+	if err != nil {
+		return 0, 0, err
+	}
+	//messages that aren't due stay unacked until the channel closes, which returns them to the queue
+	defer ch.Close()
+	if _, err = ch.QueueDeclare(r.Archive, true, false, false, false, nil); err != nil {
+		return 0, 0, err
+	}
+
+	now := q.Clock().Now()
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		d, ok, gerr := ch.Get(r.DLQ, false)
+		if gerr != nil || !ok {
+			return redriven, archived, gerr
+		}
+		m := q.newMessage(ctx, d)
+		msg := m.republishing()
+
+		//a missing, non integer or negative count is a first attempt
+		n, _ := GetIntHeader(m.HeaderTable(), RedriveCountHeader)
+		if n < 0 {
+			n = 0
+		}
+		first := now
+		if ms, ok := GetIntHeader(m.HeaderTable(), RedriveFirstHeader); ok {
+			first = fromMillis(ms)
+		} else if t, ok := GetTimeHeader(m.HeaderTable(), "x-death", "0", "time"); ok {
+			first = t
+		}
+		last := first
+		if ms, ok := GetIntHeader(m.HeaderTable(), RedriveLastHeader); ok {
+			last = fromMillis(ms)
+		}
+		msg.Headers[RedriveFirstHeader] = millis(first)
+
+		counter := &redriven
+		switch {
+		case n >= int64(len(r.Schedule)) || (r.MaxAge > 0 && now.Sub(first) > r.MaxAge):
+			counter = &archived
+			err = q.PublishTo(m.Context(), "", r.Archive, msg, false, false)
+		case now.Sub(last) >= r.Schedule[n]:
+			exchange, _ := GetStringHeader(m.HeaderTable(), "x-death", "0", "exchange")
+			msg.Headers[RedriveCountHeader] = int32(n + 1)
+			msg.Headers[RedriveLastHeader] = millis(now)
+			err = q.PublishTo(m.Context(), exchange, originalRoutingKey(m), msg, false, false)
+		default:
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if err = d.Ack(false); err != nil {
+			return
+		}
+		*counter++
+	}
+}
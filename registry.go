@@ -0,0 +1,148 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Registry keeps an application's queues by name on one shared Connection, redialed by whichever queue recovers first, and shuts them down together:
+//
+//	reg, err := NewRegistry("amqp://localhost")
+//	err = reg.Register("emails", &Configuration{RoutingKey: "emails", Durable: true})
+//	err = reg.Queue("emails").Publish(body, nil, false, false)
+type Registry struct {
+	conn   *Connection
+	mu     sync.RWMutex
+	queues map[string]*Queue
+}
+
+//NewRegistry dials host with opts for the registry's connection
+func NewRegistry(host string, opts ...Option) (*Registry, error) {
+	conn, err := Dial(host, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistryWithConnection(conn), nil
+}
+
+//NewRegistryWithConnection returns a Registry opening its queues on conn
+func NewRegistryWithConnection(conn *Connection) *Registry {
+	return &Registry{conn: conn, queues: map[string]*Queue{}}
+}
+
+//Register opens a queue for config on the registry's connection, declaring it right away so configuration errors surface at startup, and stores it under name
+func (r *Registry) Register(name string, config *Configuration) error {
+	if _, ok := r.Get(name); ok {
+		return fmt.Errorf("Queue %q is already registered", name)
+	}
+	//declaring without the lock lets RegisterAll declare in parallel
+	q, err := r.conn.open(config)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.queues[name]; ok {
+		q.Close()
+		return fmt.Errorf("Queue %q is already registered", name)
+	}
+	r.queues[name] = q
+	return nil
+}
+
+//DefaultDeclareConcurrency is the number of queues RegisterAll declares at once when its concurrency is 0
+const DefaultDeclareConcurrency = 8
+
+//RegisterAll registers every configuration of configs under its name like Register, declaring up to concurrency queues at once, each on its own channel, to cut the startup time of services with many queues. Queues that were declared stay registered when others fail, it returns the error of the first name in sorted order that failed, or ctx's error when it is done before every declaration started
+func (r *Registry) RegisterAll(ctx context.Context, configs map[string]*Configuration, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = DefaultDeclareConcurrency
+	}
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]error, len(names))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var err error
+	for i, name := range names {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = r.Register(name, configs[name])
+		}(i, name)
+	}
+	wg.Wait()
+	for _, e := range errs {
+		if e != nil {
+			return e
+		}
+	}
+	return err
+}
+
+//Get returns the queue registered under name
+func (r *Registry) Get(name string) (*Queue, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	q, ok := r.queues[name]
+	return q, ok
+}
+
+//Queue returns the queue registered under name and panics when there is none, registering queues is expected to happen at startup
+func (r *Registry) Queue(name string) *Queue {
+	q, ok := r.Get(name)
+	if !ok {
+		panic(fmt.Sprintf("amqphelper: queue %q is not registered", name))
+	}
+	return q
+}
+
+//Names returns the registered names, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.queues))
+	for name := range r.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Shutdown shuts every queue down gracefully, in parallel and within ctx, then closes the connection. It returns the first error
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	queues := r.queues
+	r.queues = map[string]*Queue{}
+	r.mu.Unlock()
+
+	errs := make(chan error, len(queues))
+	for _, q := range queues {
+		go func(q *Queue) { errs <- q.Shutdown(ctx) }(q)
+	}
+	var err error
+	for range queues {
+		if qerr := <-errs; err == nil {
+			err = qerr
+		}
+	}
+	if cerr := r.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package amqphelper
+
+import "fmt"
+
+//UpdateConfig validates cfg and swaps it in on the next connection, so rotated credentials or a moved host are used by the next Recover without restarting. The live connection keeps its settings, when there is none, or it was closed, the queue reconnects right away and returns the result. Consumers are not restarted, spawn them again after a reconnect. Queues on a shared Connection keep the connection's settings, changing Host for them is an error
+func (q *Queue) UpdateConfig(cfg *Configuration) error {
+	if cfg == nil {
+		return fmt.Errorf("Configuration is nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	cur := q.config()
+	c := *cfg
+	if q.shared != nil {
+		if c.Host != cur.Host {
+			return fmt.Errorf("Host can't be changed for a queue on a shared Connection, it would keep using %s", cur.SafeURI())
+		}
+		c.TLSConfig, c.Heartbeat = cur.TLSConfig, cur.Heartbeat
+	}
+	if c.arguments == nil && cur != nil {
+		c.arguments = cur.arguments
+	}
+	q.configMu.Lock()
+	q.pendingConfig = &c
+	q.configMu.Unlock()
+	q.logger().Info("Configuration updated", F("queue", c.RoutingKey))
+
+	if q.connection == nil || q.connection.IsClosed() {
+		return q.Recover()
+	}
+	return nil
+}
+
+//applyPendingConfig swaps in the Configuration passed to UpdateConfig, it is called before dialing
+func (q *Queue) applyPendingConfig() {
+	q.configMu.Lock()
+	defer q.configMu.Unlock()
+	if q.pendingConfig == nil {
+		return
+	}
+	q.current.Store(q.pendingConfig)
+	q.pendingConfig = nil
+	q.handlerSlots.resized()
+	q.record(Event{Type: EventConfigApplied})
+}
@@ -0,0 +1,66 @@
+package amqphelper
+
+import (
+	"context"
+	"time"
+)
+
+//originalRoutingKey returns the routing key a dead lettered delivery was first published with, from its x-death header
+func originalRoutingKey(m *Message) string {
+	if rk, ok := GetStringHeader(m.HeaderTable(), "x-death", "0", "routing-keys", "0"); ok {
+		return rk
+	}
+	return m.RoutingKey
+}
+
+//ReplayDLQ drains dlqName on a dedicated channel and republishes its messages through the queue to targetExchange with their original routing key, at most rate per second when rate is positive. filter may edit a message before it is republished and returns false to leave it in the dead letter queue, nil replays everything. Each message is acked once republished, so stopping through ctx or a failed publish leaves the rest in place. It returns the number of messages replayed
+func (q *Queue) ReplayDLQ(ctx context.Context, dlqName, targetExchange string, filter func(m *Message) bool, rate int) (int, error) {
+	if q.connection == nil {
+		return 0, ErrNotConnected
+	}
+	ch, err := q.connection.Channel()
+	if err != nil {
+		return 0, err
+	}
+	//skipped messages stay unacked until the channel closes, which returns them to the queue
+	defer ch.Close()
+
+	var tick <-chan time.Time
+	if rate > 0 {
+		t := q.Clock().NewTicker(time.Second / time.Duration(rate))
+		defer t.Stop()
+		tick = t.C()
+	}
+
+	replayed := 0
+	for {
+		if err = ctx.Err(); err != nil {
+			return replayed, err
+		}
+		d, ok, err := ch.Get(dlqName, false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			return replayed, nil
+		}
+		m := q.newMessage(ctx, d)
+		if filter != nil && !filter(m) {
+			continue
+		}
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return replayed, ctx.Err()
+			}
+		}
+		if err = q.PublishTo(m.Context(), targetExchange, originalRoutingKey(m), m.republishing(), false, false); err != nil {
+			return replayed, err
+		}
+		if err = m.Delivery.Ack(false); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+}
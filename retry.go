@@ -0,0 +1,57 @@
+package amqphelper
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//ErrRetriesExhausted is returned by a tiered retry function for messages that went through every tier, they are rejected instead
+var ErrRetriesExhausted = fmt.Errorf("Message ran out of retries")
+
+//waitQueue names the queue holding retries of the queue for d
+func waitQueue(queue string, d time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", queue, d)
+}
+
+//NewTieredRetry declares a wait queue per delay, named queue.retry.<delay>, whose messages expire after that delay back into q through the default exchange. The returned function is meant for paths that would otherwise nack: it republishes the message to the wait queue of its next tier with RetryCountHeader incremented and acks it, once every tier was used it rejects the message, dead lettering it if q has a dead letter exchange, and returns ErrRetriesExhausted
+func NewTieredRetry(q *Queue, delays []time.Duration) (func(m *Message) error, error) {
+	cfg := q.config()
+	tiers := append([]time.Duration(nil), delays...)
+	for _, d := range tiers {
+		_, err := q.channel.QueueDeclare(waitQueue(q.Name(), d), cfg.Durable, false, false, cfg.NoWait, amqp.Table{
+			"x-message-ttl":             int64(d / time.Millisecond),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": q.Name(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(m *Message) error {
+		n, _ := GetIntHeader(m.HeaderTable(), RetryCountHeader)
+		if int(n) >= len(tiers) {
+			m.logger().Warn("Message ran out of retries", m.fields(F("retries", n))...)
+			if err := m.reject(); err != nil {
+				return err
+			}
+			return ErrRetriesExhausted
+		}
+		msg := m.republishing()
+		msg.Headers[RetryCountHeader] = int32(n + 1)
+		msg.Expiration = ""
+		if cfg.Durable {
+			msg.DeliveryMode = amqp.Persistent
+		}
+		err := q.PublishTo(m.Context(), "", waitQueue(q.Name(), tiers[n]), msg, false, false)
+		if err != nil {
+			return err
+		}
+		if cfg.AutoAcknowledgeMessages {
+			return nil
+		}
+		return m.Ack(false)
+	}, nil
+}
@@ -0,0 +1,67 @@
+package amqphelper
+
+import (
+	"context"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//Publication is a publish whose Publishing and header table are reused across publishes, for hot paths where allocating them each time shows in profiles. Get one from Queue.NewPublication, fill Publishing.Headers in place and give it back with Release once PublishReuse returned
+type Publication struct {
+	Exchange   string
+	RoutingKey string
+	Mandatory  bool
+	Immediate  bool
+	Publishing amqp.Publishing
+}
+
+var publicationPool = sync.Pool{New: func() interface{} {
+	return &Publication{Publishing: amqp.Publishing{Headers: amqp.Table{}}}
+}}
+
+//NewPublication returns a pooled Publication of body to the configured exchange and routing key, with the configured content type and an empty header table
+func (q *Queue) NewPublication(body []byte) *Publication {
+	cfg := q.config()
+	p := publicationPool.Get().(*Publication)
+	p.Exchange, p.RoutingKey = cfg.Exchange, cfg.RoutingKey
+	p.Publishing.ContentType, p.Publishing.ContentEncoding = cfg.ContentType, cfg.ContentEncoding
+	p.Publishing.Body = body
+	return p
+}
+
+//Release clears p, keeping its header table, and puts it back in the pool. p must not be used afterwards
+func (p *Publication) Release() {
+	headers := p.Publishing.Headers
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	clear(headers)
+	*p = Publication{Publishing: amqp.Publishing{Headers: headers}}
+	publicationPool.Put(p)
+}
+
+//PublishReuse publishes p like PublishTo, except that the stamping, trace context and middleware change p.Publishing in place instead of a copy, so apart from the client library's frames and a stamped message id nothing is allocated per publish. Encryption, signing and claim checks still replace the body and headers
+func (q *Queue) PublishReuse(ctx context.Context, p *Publication) error {
+	return q.publishReuse(ctx, nil, p)
+}
+
+func (q *Queue) publishReuse(ctx context.Context, deliver sendFunc, p *Publication) error {
+	if tc, ok := TraceContextFromContext(ctx); ok && traceParentPattern.MatchString(tc.TraceParent) {
+		if p.Publishing.Headers == nil {
+			p.Publishing.Headers = amqp.Table{}
+		}
+		//storing a string in the table allocates, a header left by the previous publish of the same trace is kept
+		if v, _ := p.Publishing.Headers[TraceParentHeader].(string); v != tc.TraceParent {
+			p.Publishing.Headers[TraceParentHeader] = tc.TraceParent
+		}
+		if tc.TraceState != "" {
+			if v, _ := p.Publishing.Headers[TraceStateHeader].(string); v != tc.TraceState {
+				p.Publishing.Headers[TraceStateHeader] = tc.TraceState
+			}
+		} else {
+			delete(p.Publishing.Headers, TraceStateHeader)
+		}
+	}
+	return q.publishVia(ctx, deliver, p.Exchange, p.RoutingKey, &p.Publishing, p.Mandatory, p.Immediate)
+}
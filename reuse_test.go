@@ -0,0 +1,76 @@
+package amqphelper
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func discard(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, mandatory, immediate bool) error {
+	return nil
+}
+
+//reuseQueue is a queue publishing to discard
+func reuseQueue(stamp bool) *Queue {
+	q := newQueue(&Configuration{RoutingKey: "reuse", ContentType: "application/octet-stream", AutoStampMessages: stamp})
+	q.channel = &amqp.Channel{}
+	return q
+}
+
+var traced = ContextWithTraceContext(context.Background(), TraceContext{TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+
+//TestPublishReuseAllocations fails when the PublishReuse path allocates more than it did, the client library's frames aside. A stamped message id is the random bytes read for it and the string
+func TestPublishReuseAllocations(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		ctx   context.Context
+		stamp bool
+		want  float64
+	}{
+		{"plain", context.Background(), false, 0},
+		{"traced", traced, false, 0},
+		{"stamped", traced, true, 2},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			q := reuseQueue(c.stamp)
+			p := q.NewPublication(make([]byte, 256))
+			defer p.Release()
+			allocs := testing.AllocsPerRun(1000, func() {
+				p.Publishing.MessageId = ""
+				if err := q.publishReuse(c.ctx, discard, p); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if allocs > c.want {
+				t.Errorf("PublishReuse allocated %.1f times per publish, want at most %.0f", allocs, c.want)
+			}
+		})
+	}
+}
+
+func BenchmarkPublishReuse(b *testing.B) {
+	q := reuseQueue(true)
+	body := make([]byte, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p := q.NewPublication(body)
+		if err := q.publishReuse(traced, discard, p); err != nil {
+			b.Fatal(err)
+		}
+		p.Release()
+	}
+}
+
+//BenchmarkPublishCopy is the publish PublishReuse is compared with, copying the message and building its header table each time
+func BenchmarkPublishCopy(b *testing.B) {
+	q := reuseQueue(true)
+	body := make([]byte, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg := amqp.Publishing{ContentType: "application/octet-stream", Body: body}
+		if err := q.publishVia(traced, discard, "", "reuse", &msg, false, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
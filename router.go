@@ -0,0 +1,104 @@
+package amqphelper
+
+import "fmt"
+
+//Router dispatches deliveries by header values, sending each to the first rule whose conditions all hold. Build it fluently:
+//
+//	r := NewRouter()
+//	r.When("region", "eu").And("tenant", "acme").Handle(acmeEU)
+//	r.When("region", "us").Republish(usQueue, "", "orders.us")
+//	r.Otherwise(fallback)
+//	q.SpawnWorkers("router", 4, r.Route)
+type Router struct {
+	rules     []*Rule
+	otherwise func(m *Message)
+}
+
+//Rule is a set of header conditions and the action taken on messages meeting all of them
+type Rule struct {
+	router     *Router
+	conditions []headerCondition
+	action     func(m *Message)
+}
+
+type headerCondition struct {
+	header string
+	value  string
+}
+
+//NewRouter returns a Router without rules
+func NewRouter() *Router {
+	return &Router{}
+}
+
+//When starts a rule matching messages whose header equals value. Values are compared in their printed form, so 1 matches an int32 or int64 header and byte slices match strings
+func (r *Router) When(header string, value interface{}) *Rule {
+	rule := &Rule{router: r}
+	r.rules = append(r.rules, rule)
+	return rule.And(header, value)
+}
+
+//Otherwise handles messages no rule matched, without it they are logged and rejected
+func (r *Router) Otherwise(f func(m *Message)) *Router {
+	r.otherwise = f
+	return r
+}
+
+//And adds a condition to the rule
+func (rule *Rule) And(header string, value interface{}) *Rule {
+	rule.conditions = append(rule.conditions, headerCondition{header, fmt.Sprint(value)})
+	return rule
+}
+
+//Handle sends the rule's messages to f
+func (rule *Rule) Handle(f func(m *Message)) *Router {
+	rule.action = f
+	return rule.router
+}
+
+//Republish forwards the rule's messages as received through q to exchange and routing key, acking them once published and requeueing them when that failed
+func (rule *Rule) Republish(q *Queue, exchange, routingKey string) *Router {
+	rule.action = func(m *Message) {
+		err := q.PublishTo(m.Context(), exchange, routingKey, m.republishing(), false, false)
+		if m.queue != nil && m.queue.config().AutoAcknowledgeMessages {
+			return
+		}
+		if err != nil {
+			m.logger().Error("Could not republish routed message", m.fields(F("exchange", exchange), F("target", routingKey), F("error", err))...)
+			m.Nack(false, true)
+			return
+		}
+		m.Ack(false)
+	}
+	return rule.router
+}
+
+func (rule *Rule) matches(m *Message) bool {
+	for _, c := range rule.conditions {
+		v, ok := m.HeaderTable()[c.header]
+		if b, isBytes := v.([]byte); isBytes {
+			v = string(b)
+		}
+		if !ok || fmt.Sprint(v) != c.value {
+			return false
+		}
+	}
+	return true
+}
+
+//Route sends the message to the first matching rule, it can be passed directly to SpawnWorkers
+func (r *Router) Route(m *Message) {
+	for _, rule := range r.rules {
+		if rule.action != nil && rule.matches(m) {
+			rule.action(m)
+			return
+		}
+	}
+	if r.otherwise != nil {
+		r.otherwise(m)
+		return
+	}
+	m.logger().Warn("No route for message", m.fields()...)
+	m.queue.reportError(ErrorScopeValidation, fmt.Errorf("No route for message %s", m.MessageID()))
+	m.reject()
+}
@@ -0,0 +1,270 @@
+//Package rpc implements request reply over amqphelper queues, with replies matched to calls by correlation id
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//DefaultTimeout bounds calls whose context has no deadline when Client.Timeout is 0
+const DefaultTimeout = 30 * time.Second
+
+//ErrTimeout is returned by Call when no reply arrived in time
+var ErrTimeout = fmt.Errorf("RPC call timed out")
+
+//errReplyQueueLost fails the calls whose replies were sent to a reply queue deleted with its connection, and those made until it is recovered
+var errReplyQueueLost = fmt.Errorf("%w: the reply queue was lost", amqphelper.ErrChannelClosed)
+
+//recoverInterval is how long the client waits between attempts to recover its reply queue
+const recoverInterval = time.Second
+
+//Client publishes requests to a queue and waits for their replies on an exclusive queue of its own, or through direct reply-to
+type Client struct {
+	//Timeout bounds calls whose context has no deadline, DefaultTimeout is used when it is 0
+	Timeout time.Duration
+
+	requests *amqphelper.Queue
+	replies  *amqphelper.Queue
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopped  chan struct{}
+	mu       sync.Mutex
+	replyTo  string
+	//lost is closed while the reply queue is lost and replaced once it is recovered
+	lost    chan struct{}
+	pending map[string]*pendingCall
+}
+
+//pendingCall buffers the replies of a call, streams block the reply consumer rather than drop replies until done is closed. replyTo is the reply queue the call was made with and lost is closed if that queue is lost
+type pendingCall struct {
+	replies chan *amqphelper.Message
+	stream  bool
+	done    chan struct{}
+	replyTo string
+	lost    <-chan struct{}
+}
+
+//NewClient returns a Client publishing to requests, it opens a second connection to the same host for a broker named, exclusive and auto deleted reply queue. The reply queue is deleted with its connection, when that is lost the pending calls fail with an error wrapping ErrChannelClosed, as do calls made until the queue is declared again under a new name
+func NewClient(requests *amqphelper.Queue) (*Client, error) {
+	replies, err := amqphelper.GetQueue(&amqphelper.Configuration{
+		Host:                    requests.Configuration().Host,
+		Exclusive:               true,
+		DeleteIfUnused:          true,
+		AutoAcknowledgeMessages: true,
+		Logger:                  requests.Configuration().Logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{requests: requests, replies: replies, replyTo: replies.Name(), lost: make(chan struct{}), pending: map[string]*pendingCall{}, stopped: make(chan struct{})}
+	err = replies.SpawnWorkers("rpc-client", 1, c.dispatch)
+	if err != nil {
+		replies.Close()
+		return nil, err
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.serve()
+	return c, nil
+}
+
+//serve waits for the reply consumer to stop until Close. A consumer stopping otherwise lost its connection and with it the reply queue, the pending calls are failed and the queue is recovered and consumed again
+func (c *Client) serve() {
+	defer close(c.stopped)
+	for {
+		if err := c.replies.Run(context.Background()); err != amqphelper.ErrConsumersStopped || c.ctx.Err() != nil {
+			return
+		}
+		c.lose()
+		c.replies.Close()
+		for {
+			err := c.replies.RecoverContext(c.ctx)
+			if err == nil {
+				err = c.replies.SpawnWorkers("rpc-client", 1, c.dispatch)
+			}
+			if err == nil {
+				break
+			}
+			//RecoverContext and SpawnWorkers log and report their failures
+			select {
+			case <-c.requests.Clock().After(recoverInterval):
+			case <-c.ctx.Done():
+				return
+			}
+		}
+		//Close may have closed the old connection while the new one was being opened
+		if c.ctx.Err() != nil {
+			c.replies.Close()
+			return
+		}
+		c.restore(c.replies.Name())
+	}
+}
+
+//lose fails the pending calls and the next ones until restore
+func (c *Client) lose() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.lost:
+	default:
+		close(c.lost)
+	}
+}
+
+//restore makes the next calls wait for their replies on replyTo
+func (c *Client) restore(replyTo string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replyTo, c.lost = replyTo, make(chan struct{})
+}
+
+//NewDirectClient returns a Client publishing to requests that receives replies through RabbitMQ's direct reply-to on the requests queue's channel, without a reply queue or a second connection. Replies stop arriving if the channel is recovered, create a new client then
+func NewDirectClient(requests *amqphelper.Queue) (*Client, error) {
+	c := &Client{requests: requests, replyTo: amqphelper.DirectReplyTo, lost: make(chan struct{}), pending: map[string]*pendingCall{}}
+	if err := requests.ConsumeDirectReplies(c.dispatch); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) dispatch(m *amqphelper.Message) {
+	c.mu.Lock()
+	call, ok := c.pending[m.CorrelationID()]
+	c.mu.Unlock()
+	if !ok {
+		m.Logger().Warn("Discarding reply without a pending call")
+		return
+	}
+	if call.stream {
+		select {
+		case call.replies <- m:
+		case <-call.done:
+		}
+		return
+	}
+	select {
+	case call.replies <- m:
+	default:
+	}
+}
+
+//await registers a call expecting up to n replies, or a stream when stream is set, the returned function unregisters it. It returns errReplyQueueLost while the reply queue is lost
+func (c *Client) await(id string, n int, stream bool) (*pendingCall, func(), error) {
+	call := &pendingCall{replies: make(chan *amqphelper.Message, n), stream: stream, done: make(chan struct{})}
+	c.mu.Lock()
+	call.replyTo, call.lost = c.replyTo, c.lost
+	select {
+	case <-c.lost:
+		c.mu.Unlock()
+		return nil, nil, errReplyQueueLost
+	default:
+	}
+	c.pending[id] = call
+	c.mu.Unlock()
+	return call, func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		close(call.done)
+	}, nil
+}
+
+//Call publishes body as a request and returns the body of its reply. It returns ErrTimeout when ctx's deadline, or Timeout when ctx has none, passes before the reply arrives and ctx's error when ctx is cancelled. A failed handler is reported as a RemoteError. The request expires with the deadline, so servers don't answer callers that gave up, and carries it in DeadlineHeader for the server's handler context. The call is forgotten as soon as Call returns
+func (c *Client) Call(ctx context.Context, body []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := c.Timeout
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	id := amqphelper.UUIDv4(nil)
+	call, done, err := c.await(id, 1, false)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	msg := amqp.Publishing{
+		ContentType:     c.requests.Configuration().ContentType,
+		ContentEncoding: c.requests.Configuration().ContentEncoding,
+		CorrelationId:   id,
+		ReplyTo:         call.replyTo,
+		Expiration:      expiration(ctx, c.requests.Clock()),
+		Headers:         deadlineHeader(ctx),
+		Body:            body,
+	}
+	err = c.requests.PublishTo(ctx, c.requests.Configuration().Exchange, c.requests.Configuration().RoutingKey, msg, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case m := <-call.replies:
+		if err := remoteError(m); err != nil {
+			return nil, err
+		}
+		return m.Body, nil
+	case <-call.lost:
+		return nil, errReplyQueueLost
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+//expiration returns the time left until ctx's deadline on clock as a per message TTL
+func expiration(ctx context.Context, clock amqphelper.Clock) string {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return ""
+	}
+	return ttl(d.Sub(clock.Now()))
+}
+
+//ttl formats d as a per message TTL, at least a millisecond since an expiration of 0 discards the message unless it can be delivered immediately
+func ttl(d time.Duration) string {
+	ms := d.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+func deadlineHeader(ctx context.Context) amqp.Table {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	return amqp.Table{DeadlineHeader: d.UnixNano() / int64(time.Millisecond)}
+}
+
+func remoteError(m *amqphelper.Message) error {
+	if e, ok := amqphelper.GetStringHeader(m.HeaderTable(), ErrorHeader); ok {
+		return &RemoteError{e}
+	}
+	return nil
+}
+
+//Close closes the reply queue's connection, pending calls keep waiting until their deadline. Direct clients own no connection and have nothing to close
+func (c *Client) Close() error {
+	if c.replies == nil {
+		return nil
+	}
+	c.cancel()
+	err := c.replies.Close()
+	<-c.stopped
+	return err
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ermyuriel/amqphelper"
+)
+
+func isLost(call *pendingCall) bool {
+	select {
+	case <-call.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+//TestReplyQueueLost loses and restores the reply queue the way serve does when the reply consumer's connection is lost and recovered
+func TestReplyQueueLost(t *testing.T) {
+	c := &Client{replyTo: "amq.gen-1", lost: make(chan struct{}), pending: map[string]*pendingCall{}}
+	before, done, err := c.await("before", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+	if before.replyTo != "amq.gen-1" || isLost(before) {
+		t.Fatalf("call waits on %s, lost %v, want amq.gen-1 and not lost", before.replyTo, isLost(before))
+	}
+
+	c.lose()
+	c.lose()
+	if !isLost(before) {
+		t.Error("pending call wasn't failed when the reply queue was lost")
+	}
+	if _, _, err := c.await("during", 1, false); !errors.Is(err, amqphelper.ErrChannelClosed) {
+		t.Errorf("await while the reply queue is lost returned %v, want ErrChannelClosed", err)
+	}
+	//Call fails before publishing, it would panic without a requests queue
+	if _, err := c.Call(context.Background(), nil); !errors.Is(err, amqphelper.ErrChannelClosed) {
+		t.Errorf("Call while the reply queue is lost returned %v, want ErrChannelClosed", err)
+	}
+	if _, err := c.CallStream(context.Background(), nil); !errors.Is(err, amqphelper.ErrChannelClosed) {
+		t.Errorf("CallStream while the reply queue is lost returned %v, want ErrChannelClosed", err)
+	}
+
+	c.restore("amq.gen-2")
+	after, done, err := c.await("after", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+	if after.replyTo != "amq.gen-2" || isLost(after) {
+		t.Errorf("call after recovery waits on %s, lost %v, want amq.gen-2 and not lost", after.replyTo, isLost(after))
+	}
+	if !isLost(before) {
+		t.Error("call made before the loss is waiting again")
+	}
+}
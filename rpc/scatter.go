@@ -0,0 +1,62 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//ErrNoQuorum is returned by ScatterGather when fewer replies than requested arrived in the window
+var ErrNoQuorum = fmt.Errorf("Not enough replies before the window closed")
+
+//Response is a reply collected by ScatterGather, Err is a RemoteError when the responder's handler failed
+type Response struct {
+	AppID string
+	Body  []byte
+	Err   error
+}
+
+//ScatterGather publishes body to exchange, typically a fanout or topic exchange bound to every responder, and collects the replies sent to the client's reply queue. It returns as soon as minResponses replies arrived, or with what it collected and ErrNoQuorum once window elapses, or ctx's error when ctx is done first
+func (c *Client) ScatterGather(ctx context.Context, exchange string, body []byte, minResponses int, window time.Duration) ([]Response, error) {
+	if minResponses < 1 {
+		minResponses = 1
+	}
+	id := amqphelper.UUIDv4(nil)
+	call, done, err := c.await(id, minResponses, false)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	msg := amqp.Publishing{
+		ContentType:     c.requests.Configuration().ContentType,
+		ContentEncoding: c.requests.Configuration().ContentEncoding,
+		CorrelationId:   id,
+		ReplyTo:         call.replyTo,
+		Expiration:      ttl(window),
+		Body:            body,
+	}
+	err = c.requests.PublishTo(ctx, exchange, c.requests.Configuration().RoutingKey, msg, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := c.requests.Clock().After(window)
+	var responses []Response
+	for len(responses) < minResponses {
+		select {
+		case m := <-call.replies:
+			responses = append(responses, Response{AppID: m.AppID(), Body: m.Body, Err: remoteError(m)})
+		case <-call.lost:
+			return responses, errReplyQueueLost
+		case <-timeout:
+			return responses, ErrNoQuorum
+		case <-ctx.Done():
+			return responses, ctx.Err()
+		}
+	}
+	return responses, nil
+}
@@ -0,0 +1,136 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	//ErrorHeader carries the error of a failed handler on its reply
+	ErrorHeader = "x-rpc-error"
+	//DeadlineHeader carries the caller's deadline as milliseconds since the Unix epoch
+	DeadlineHeader = "x-rpc-deadline"
+	//EndOfStreamHeader marks the last reply of a stream
+	EndOfStreamHeader = "x-rpc-end-of-stream"
+)
+
+//RemoteError is returned by Client.Call when the server's handler failed
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "RPC handler failed: " + e.Message
+}
+
+//Handler answers a request with the body of its reply
+type Handler func(ctx context.Context, req []byte) ([]byte, error)
+
+//StreamHandler answers a request with any number of replies passed to send, send fails once the reply can't be published
+type StreamHandler func(ctx context.Context, req []byte, send func(reply []byte) error) error
+
+//Server consumes requests from a queue and publishes its handler's replies to their ReplyTo queue with the request's CorrelationId
+type Server struct {
+	queue   *amqphelper.Queue
+	handler Handler
+	stream  StreamHandler
+}
+
+//NewServer returns a Server answering requests consumed from q with h
+func NewServer(q *amqphelper.Queue, h Handler) *Server {
+	return &Server{queue: q, handler: h}
+}
+
+//NewStreamServer returns a Server answering requests consumed from q with a stream of replies from h, for Client.CallStream. Once h returns a reply with EndOfStreamHeader set, and ErrorHeader when h failed, closes the stream
+func NewStreamServer(q *amqphelper.Queue, h StreamHandler) *Server {
+	return &Server{queue: q, stream: h}
+}
+
+//Serve spawns n consumers handling requests, Queue.Run should be called next. Requests without ReplyTo or CorrelationId are logged and rejected, handlers get a context with the caller's deadline, handler errors and panics are sent back with ErrorHeader set and surface as a RemoteError in Client.Call
+func (s *Server) Serve(consumers int) error {
+	return s.queue.SpawnWorkers("rpc-server", consumers, s.handle)
+}
+
+func (s *Server) handle(m *amqphelper.Message) {
+	if m.ReplyQueue() == "" || m.CorrelationID() == "" {
+		m.Logger().Warn("Discarding malformed RPC request", amqphelper.F("reply_to", m.ReplyQueue()))
+		if !s.queue.Configuration().AutoAcknowledgeMessages {
+			m.Reject(false)
+		}
+		return
+	}
+
+	var err error
+	if s.stream != nil {
+		err = s.serveStream(m)
+	} else {
+		err = s.serveCall(m)
+	}
+	if s.queue.Configuration().AutoAcknowledgeMessages {
+		return
+	}
+	if err != nil {
+		m.Logger().Error("Could not publish RPC reply", amqphelper.F("reply_to", m.ReplyQueue()), amqphelper.F("error", err))
+		m.Nack(false, false)
+		return
+	}
+	m.Ack(false)
+}
+
+func (s *Server) reply(m *amqphelper.Message, body []byte, headers amqp.Table) error {
+	reply := amqp.Publishing{
+		ContentType:     s.queue.Configuration().ContentType,
+		ContentEncoding: s.queue.Configuration().ContentEncoding,
+		CorrelationId:   m.CorrelationID(),
+		Headers:         headers,
+		Body:            body,
+	}
+	return s.queue.PublishTo(m.Context(), "", m.ReplyQueue(), reply, false, false)
+}
+
+func (s *Server) serveCall(m *amqphelper.Message) error {
+	var body []byte
+	err := s.call(m, func(ctx context.Context) (err error) {
+		body, err = s.handler(ctx, m.Body)
+		return err
+	})
+	if err != nil {
+		m.Logger().Warn("RPC handler failed", amqphelper.F("error", err))
+		return s.reply(m, nil, amqp.Table{ErrorHeader: err.Error()})
+	}
+	return s.reply(m, body, nil)
+}
+
+func (s *Server) serveStream(m *amqphelper.Message) error {
+	err := s.call(m, func(ctx context.Context) error {
+		return s.stream(ctx, m.Body, func(reply []byte) error {
+			return s.reply(m, reply, nil)
+		})
+	})
+	end := amqp.Table{EndOfStreamHeader: true}
+	if err != nil {
+		m.Logger().Warn("RPC handler failed", amqphelper.F("error", err))
+		end[ErrorHeader] = err.Error()
+	}
+	return s.reply(m, nil, end)
+}
+
+//call runs f with a context carrying the caller's deadline, turning panics into errors
+func (s *Server) call(m *amqphelper.Message, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	ctx := m.Context()
+	if ms, ok := amqphelper.GetIntHeader(m.HeaderTable(), DeadlineHeader); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(0, ms*int64(time.Millisecond)))
+		defer cancel()
+	}
+	return f(ctx)
+}
@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//CallStream publishes body as a request to a server created with NewStreamServer and returns a channel of its replies, closed after the end of stream marker, when the server's handler failed or when ctx is done. Failures are logged through the requests queue's logger. Replies for every call of the client share one consumer, so the channel should be drained promptly
+func (c *Client) CallStream(ctx context.Context, body []byte) (<-chan []byte, error) {
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := c.Timeout
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	id := amqphelper.UUIDv4(nil)
+	call, done, err := c.await(id, 16, true)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	msg := amqp.Publishing{
+		ContentType:     c.requests.Configuration().ContentType,
+		ContentEncoding: c.requests.Configuration().ContentEncoding,
+		CorrelationId:   id,
+		ReplyTo:         call.replyTo,
+		Expiration:      expiration(ctx, c.requests.Clock()),
+		Headers:         deadlineHeader(ctx),
+		Body:            body,
+	}
+	err = c.requests.PublishTo(ctx, c.requests.Configuration().Exchange, c.requests.Configuration().RoutingKey, msg, false, false)
+	if err != nil {
+		done()
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		defer cancel()
+		defer done()
+		for {
+			select {
+			case m := <-call.replies:
+				if err := remoteError(m); err != nil {
+					m.Logger().Warn("RPC stream failed", amqphelper.F("error", err))
+					return
+				}
+				if end, _ := amqphelper.GetBoolHeader(m.HeaderTable(), EndOfStreamHeader); end {
+					return
+				}
+				select {
+				case out <- m.Body:
+				case <-ctx.Done():
+					return
+				}
+			case <-call.lost:
+				if l := c.requests.Configuration().Logger; l != nil {
+					l.Warn("RPC stream failed", amqphelper.F("error", errReplyQueueLost))
+				}
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,46 @@
+//Package s3blob implements amqphelper.BlobStore over Amazon S3. It is a module of its own, so only its importers depend on the AWS SDK
+package s3blob
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+//Store keeps blobs as objects in Bucket, under Prefix
+type Store struct {
+	Client *s3.Client
+	Bucket string
+	Prefix string
+}
+
+//New returns a Store for bucket
+func New(client *s3.Client, bucket, prefix string) *Store {
+	return &Store{Client: client, Bucket: bucket, Prefix: prefix}
+}
+
+//Put uploads data as the object Prefix+key
+func (s *Store) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+//Get downloads the object Prefix+key
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
@@ -0,0 +1,210 @@
+//Package saga coordinates long running workflows whose steps are queues, compensating completed steps in reverse when a later one fails
+package saga
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	//IDHeader carries the saga id
+	IDHeader = "x-saga-id"
+	//StepHeader carries the name of the step the message is addressed to
+	StepHeader = "x-saga-step"
+	//StateHeader carries the saga's state values as a table
+	StateHeader = "x-saga-state"
+	//CompensatingHeader is set on messages undoing a step
+	CompensatingHeader = "x-saga-compensating"
+)
+
+//Decision tells the coordinator how to continue after a step
+type Decision int
+
+const (
+	//Next moves on to the following step, completing the saga after the last one
+	Next Decision = iota
+	//Compensate undoes the steps completed so far in reverse order
+	Compensate
+	//Abort stops the saga without compensating
+	Abort
+)
+
+//Outcome is how a saga ended
+type Outcome string
+
+const (
+	//Completed sagas ran every step
+	Completed Outcome = "completed"
+	//Compensated sagas had their completed steps undone
+	Compensated Outcome = "compensated"
+	//Aborted sagas were stopped by a step
+	Aborted Outcome = "aborted"
+)
+
+//State is the saga as carried between steps, handlers may change Body and Values to pass data on
+type State struct {
+	ID     string
+	Step   string
+	Body   []byte
+	Values map[string]string
+}
+
+//Step is a saga stage consumed from its own queue. Compensate undoes Handle, it may be nil for steps with nothing to undo, and is retried through redelivery while it returns an error
+type Step struct {
+	Name       string
+	Handle     func(ctx context.Context, s *State) Decision
+	Compensate func(ctx context.Context, s *State) error
+}
+
+//Saga runs a fixed sequence of steps, each bound to a durable queue named after the saga and the step
+type Saga struct {
+	//OnDone is called with the final state once a saga ends, it may be nil
+	OnDone func(s *State, o Outcome)
+
+	name   string
+	steps  []Step
+	queues []*amqphelper.Queue
+}
+
+//New connects a queue named name.step for each step, config supplies the host and other options
+func New(config *amqphelper.Configuration, name string, steps ...Step) (*Saga, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("Saga %s has no steps", name)
+	}
+	s := &Saga{name: name, steps: steps}
+	for _, st := range steps {
+		c := *config
+		c.RoutingKey, c.Durable, c.PersistentMessages, c.AutoAcknowledgeMessages = name+"."+st.Name, true, true, false
+		q, err := amqphelper.GetQueue(&c)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.queues = append(s.queues, q)
+	}
+	return s, nil
+}
+
+//Start begins a saga at the first step and returns its id
+func (s *Saga) Start(ctx context.Context, body []byte, values map[string]string) (string, error) {
+	st := &State{ID: amqphelper.UUIDv4(nil), Body: body, Values: values}
+	return st.ID, s.send(ctx, 0, st, false)
+}
+
+//Run spawns n consumers for every step, Queue.Run on any of the step queues should be called next
+func (s *Saga) Run(consumers int) error {
+	for i := range s.steps {
+		i := i
+		err := s.queues[i].SpawnWorkers("saga-"+s.steps[i].Name, consumers, func(m *amqphelper.Message) {
+			s.handle(i, m)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Queues returns the step queues in order
+func (s *Saga) Queues() []*amqphelper.Queue {
+	return s.queues
+}
+
+//Close closes every step queue
+func (s *Saga) Close() error {
+	var err error
+	for _, q := range s.queues {
+		if cerr := q.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *Saga) handle(i int, m *amqphelper.Message) {
+	st := stateOf(m)
+	st.Step = s.steps[i].Name
+	ctx := m.Context()
+	compensating, _ := amqphelper.GetBoolHeader(m.HeaderTable(), CompensatingHeader)
+
+	var err error
+	if compensating {
+		err = s.compensate(ctx, i, st)
+	} else {
+		switch s.steps[i].Handle(ctx, st) {
+		case Next:
+			if i == len(s.steps)-1 {
+				s.done(st, Completed)
+			} else {
+				err = s.send(ctx, i+1, st, false)
+			}
+		case Compensate:
+			err = s.compensate(ctx, i-1, st)
+		case Abort:
+			s.done(st, Aborted)
+		}
+	}
+
+	if err != nil {
+		m.Logger().Error("Saga step failed", amqphelper.F("saga", s.name), amqphelper.F("saga_id", st.ID), amqphelper.F("step", st.Step), amqphelper.F("compensating", compensating), amqphelper.F("error", err))
+		m.Nack(false, true)
+		return
+	}
+	m.Ack(false)
+}
+
+//compensate undoes step i when it is addressed to it, sending the saga on to step i-1, and ends the saga once there is nothing left to undo
+func (s *Saga) compensate(ctx context.Context, i int, st *State) error {
+	if i < 0 {
+		s.done(st, Compensated)
+		return nil
+	}
+	if st.Step != s.steps[i].Name {
+		return s.send(ctx, i, st, true)
+	}
+	if f := s.steps[i].Compensate; f != nil {
+		if err := f(ctx, st); err != nil {
+			return err
+		}
+	}
+	if i == 0 {
+		s.done(st, Compensated)
+		return nil
+	}
+	return s.send(ctx, i-1, st, true)
+}
+
+func (s *Saga) done(st *State, o Outcome) {
+	if s.OnDone != nil {
+		s.OnDone(st, o)
+	}
+}
+
+func (s *Saga) send(ctx context.Context, i int, st *State, compensating bool) error {
+	values := amqp.Table{}
+	for k, v := range st.Values {
+		values[k] = v
+	}
+	headers := amqp.Table{IDHeader: st.ID, StepHeader: s.steps[i].Name, StateHeader: values}
+	if compensating {
+		headers[CompensatingHeader] = true
+	}
+	q := s.queues[i]
+	msg := amqp.Publishing{ContentType: q.Configuration().ContentType, ContentEncoding: q.Configuration().ContentEncoding, CorrelationId: st.ID, Headers: headers, Body: st.Body}
+	return q.PublishTo(ctx, q.Configuration().Exchange, q.Configuration().RoutingKey, msg, false, false)
+}
+
+func stateOf(m *amqphelper.Message) *State {
+	st := &State{Body: m.Body, Values: map[string]string{}}
+	st.ID, _ = amqphelper.GetStringHeader(m.HeaderTable(), IDHeader)
+	values, _ := amqphelper.GetTableHeader(m.HeaderTable(), StateHeader)
+	for k, v := range values {
+		if s, ok := v.(string); ok {
+			st.Values[k] = s
+		}
+	}
+	return st
+}
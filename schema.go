@@ -0,0 +1,80 @@
+package amqphelper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var schemas = struct {
+	sync.RWMutex
+	m map[string]*jsonschema.Schema
+}{m: map[string]*jsonschema.Schema{}}
+
+//RegisterSchema compiles a JSON Schema and associates it with a routing key, replacing any previous schema for that key
+func RegisterSchema(routingKey, schema string) error {
+	s, err := jsonschema.CompileString(routingKey+".json", schema)
+	if err != nil {
+		return err
+	}
+	schemas.Lock()
+	schemas.m[routingKey] = s
+	schemas.Unlock()
+	return nil
+}
+
+func validateJSON(routingKey string, body []byte) error {
+	schemas.RLock()
+	s, ok := schemas.m[routingKey]
+	schemas.RUnlock()
+	if !ok {
+		return nil
+	}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	if err := s.Validate(v); err != nil {
+		return fmt.Errorf("Message for %s does not match its schema: %v", routingKey, err)
+	}
+	return nil
+}
+
+//PublishJSON marshals v as JSON, validates it against the schema registered for the queue's routing key if any, and publishes it
+func (q *Queue) PublishJSON(v interface{}, headers map[string]interface{}, mandatory, immediate bool) error {
+	cfg := q.config()
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err = validateJSON(cfg.RoutingKey, body); err != nil {
+		return err
+	}
+	return q.publish(context.Background(), amqp.Publishing{ContentType: JSONCodec{}.ContentType(), ContentEncoding: cfg.ContentEncoding, Body: body, Headers: headers}, mandatory, immediate)
+}
+
+//ValidateSchemas returns a Middleware that logs and rejects messages whose body doesn't match the schema registered for their routing key, so queues with a dead letter exchange divert them there
+func ValidateSchemas() Middleware {
+	return func(next func(m *Message)) func(m *Message) {
+		return func(m *Message) {
+			body, err := m.payload()
+			if err == nil {
+				err = validateJSON(m.RoutingKey, body)
+			}
+			if err != nil {
+				m.logger().Warn("Message failed schema validation", m.fields(F("error", err))...)
+				m.queue.reportError(ErrorScopeValidation, err)
+				m.reject()
+				return
+			}
+			next(m)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Shovel moves messages from a queue on one broker to an exchange on another, acking each source message only once the destination confirmed it
+type Shovel struct {
+	//Exchange and RoutingKey are where messages are published on the destination, an empty RoutingKey keeps each message's own
+	Exchange   string
+	RoutingKey string
+
+	source      *Queue
+	destination *Queue
+	tags        []string
+	wg          sync.WaitGroup
+	moved       int64
+}
+
+//NewShovel connects to both brokers, consuming the queue declared by source with manual acks and publishing with confirms through destination
+func NewShovel(source, destination *Configuration) (*Shovel, error) {
+	sc, dc := *source, *destination
+	sc.AutoAcknowledgeMessages, dc.ConfirmPublishes = false, true
+	src, err := GetQueue(&sc)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := GetQueue(&dc)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return &Shovel{Exchange: dc.Exchange, source: src, destination: dst}, nil
+}
+
+//Start spawns n consumers moving messages through the source's middleware until Stop. A message the destination doesn't confirm is requeued on the source
+func (s *Shovel) Start(consumers int) error {
+	now := time.Now().UnixNano()
+	move := s.source.wrap(s.move)
+	for i := 0; i < consumers; i++ {
+		tag := fmt.Sprintf("shovel:%v:%v", now, i)
+		msgs, err := s.source.GetConsumer(tag)
+		if err != nil {
+			return err
+		}
+		s.tags = append(s.tags, tag)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.source.consume(context.Background(), tag, msgs, move)
+		}()
+	}
+	return nil
+}
+
+func (s *Shovel) move(m *Message) {
+	rk := s.RoutingKey
+	if rk == "" {
+		rk = m.RoutingKey
+	}
+	if err := s.destination.PublishTo(m.Context(), s.Exchange, rk, m.republishing(), false, false); err != nil {
+		m.logger().Error("Could not shovel message", m.fields(F("error", err))...)
+		m.Nack(false, true)
+		return
+	}
+	m.Ack(false)
+	atomic.AddInt64(&s.moved, 1)
+}
+
+//Moved returns how many messages were moved so far
+func (s *Shovel) Moved() int64 {
+	return atomic.LoadInt64(&s.moved)
+}
+
+//Lag returns how many messages wait on the source queue. Call MonitorLag on Source to have it exposed through Stats and metrics with an estimated time to drain
+func (s *Shovel) Lag() (int, error) {
+	messages, _, err := s.source.Depth()
+	return messages, err
+}
+
+//Source returns the queue messages are consumed from
+func (s *Shovel) Source() *Queue {
+	return s.source
+}
+
+//Destination returns the queue messages are published through
+func (s *Shovel) Destination() *Queue {
+	return s.destination
+}
+
+//Stop cancels the consumers, waits for messages in flight to be moved until ctx is done and closes both connections. Unacked messages left on the source are redelivered to its next consumer
+func (s *Shovel) Stop(ctx context.Context) error {
+	for _, tag := range s.tags {
+		s.source.channel.Cancel(tag, false)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(stopped)
+	}()
+	var err error
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.source.Close()
+	s.destination.Close()
+	return err
+}
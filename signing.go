@@ -0,0 +1,130 @@
+package amqphelper
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	//SignatureHeader carries the base64 encoded body signature
+	SignatureHeader = "x-signature"
+	//SignatureAlgorithmHeader names the algorithm the body was signed with
+	SignatureAlgorithmHeader = "x-signature-alg"
+)
+
+//Signer signs message bodies on publish
+type Signer interface {
+	Algorithm() string
+	Sign(body []byte) ([]byte, error)
+}
+
+//Verifier checks a body signature produced with the named algorithm
+type Verifier interface {
+	Verify(algorithm string, body, signature []byte) error
+}
+
+//HMACSigner signs and verifies bodies with HMAC-SHA256 over a shared key
+type HMACSigner struct {
+	Key []byte
+}
+
+//Algorithm returns the name stored in the signature algorithm header
+func (s HMACSigner) Algorithm() string {
+	return "hmac-sha256"
+}
+
+//Sign returns the HMAC-SHA256 of body
+func (s HMACSigner) Sign(body []byte) ([]byte, error) {
+	h := hmac.New(sha256.New, s.Key)
+	h.Write(body)
+	return h.Sum(nil), nil
+}
+
+//Verify checks that signature is the HMAC-SHA256 of body
+func (s HMACSigner) Verify(algorithm string, body, signature []byte) error {
+	if algorithm != s.Algorithm() {
+		return fmt.Errorf("Unexpected signature algorithm %q", algorithm)
+	}
+	expected, _ := s.Sign(body)
+	if !hmac.Equal(expected, signature) {
+		return fmt.Errorf("Invalid message signature")
+	}
+	return nil
+}
+
+//Ed25519Signer signs bodies with an ed25519 private key
+type Ed25519Signer struct {
+	PrivateKey ed25519.PrivateKey
+}
+
+//Algorithm returns the name stored in the signature algorithm header
+func (s Ed25519Signer) Algorithm() string {
+	return "ed25519"
+}
+
+//Sign returns the ed25519 signature of body
+func (s Ed25519Signer) Sign(body []byte) ([]byte, error) {
+	return ed25519.Sign(s.PrivateKey, body), nil
+}
+
+//Ed25519Verifier verifies bodies against an ed25519 public key
+type Ed25519Verifier struct {
+	PublicKey ed25519.PublicKey
+}
+
+//Verify checks the ed25519 signature of body
+func (v Ed25519Verifier) Verify(algorithm string, body, signature []byte) error {
+	if algorithm != "ed25519" {
+		return fmt.Errorf("Unexpected signature algorithm %q", algorithm)
+	}
+	if !ed25519.Verify(v.PublicKey, body, signature) {
+		return fmt.Errorf("Invalid message signature")
+	}
+	return nil
+}
+
+func sign(s Signer, msg *amqp.Publishing) error {
+	sig, err := s.Sign(msg.Body)
+	if err != nil {
+		return err
+	}
+	h := cloneTable(msg.Headers)
+	h[SignatureHeader] = base64.StdEncoding.EncodeToString(sig)
+	h[SignatureAlgorithmHeader] = s.Algorithm()
+	msg.Headers = h
+	return nil
+}
+
+//VerifySignature checks a message's signature against its body as received
+func (m *Message) VerifySignature(v Verifier) error {
+	enc, ok := m.HeaderTable()[SignatureHeader].(string)
+	if !ok {
+		return fmt.Errorf("Message is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return err
+	}
+	alg, _ := m.HeaderTable()[SignatureAlgorithmHeader].(string)
+	return v.Verify(alg, m.Body, sig)
+}
+
+//VerifySignatures returns a Middleware that logs and rejects unsigned or tampered messages before they reach the handler
+func VerifySignatures(v Verifier) Middleware {
+	return func(next func(m *Message)) func(m *Message) {
+		return func(m *Message) {
+			if err := m.VerifySignature(v); err != nil {
+				m.logger().Warn("Message failed signature verification", m.fields(F("error", err))...)
+				m.queue.reportError(ErrorScopeValidation, err)
+				m.reject()
+				return
+			}
+			next(m)
+		}
+	}
+}
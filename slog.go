@@ -0,0 +1,56 @@
+package amqphelper
+
+import (
+	"context"
+	"log/slog"
+)
+
+//SlogLogger adapts a *slog.Logger to Logger. Connection and recovery events are logged at info, failures at error and returned or rejected messages at warn. Entries below MinLevel are dropped, which lets the package be quieter than the rest of the application sharing the handler
+type SlogLogger struct {
+	Logger   *slog.Logger
+	MinLevel slog.Leveler
+}
+
+//NewSlogLogger returns a Logger writing to l
+func NewSlogLogger(l *slog.Logger) *SlogLogger {
+	return &SlogLogger{Logger: l}
+}
+
+func (s *SlogLogger) log(level slog.Level, msg string, fields []Field) {
+	if s.MinLevel != nil && level < s.MinLevel.Level() {
+		return
+	}
+	l := s.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	ctx := context.Background()
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	l.LogAttrs(ctx, level, msg, attrs...)
+}
+
+//Debug logs at slog.LevelDebug
+func (s *SlogLogger) Debug(msg string, fields ...Field) {
+	s.log(slog.LevelDebug, msg, fields)
+}
+
+//Info logs at slog.LevelInfo
+func (s *SlogLogger) Info(msg string, fields ...Field) {
+	s.log(slog.LevelInfo, msg, fields)
+}
+
+//Warn logs at slog.LevelWarn
+func (s *SlogLogger) Warn(msg string, fields ...Field) {
+	s.log(slog.LevelWarn, msg, fields)
+}
+
+//Error logs at slog.LevelError
+func (s *SlogLogger) Error(msg string, fields ...Field) {
+	s.log(slog.LevelError, msg, fields)
+}
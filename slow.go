@@ -0,0 +1,85 @@
+package amqphelper
+
+import (
+	"sync"
+	"time"
+)
+
+//DefaultSlowConsumerWindow is how long handlers must stay over Configuration.SlowHandlerThreshold, or deliveries find the DeliveryBuffer full, before the consumer is reported slow when Configuration.SlowConsumerWindow is 0
+const DefaultSlowConsumerWindow = 30 * time.Second
+
+//SlowConsumerMetrics is implemented by Metrics that also want slow consumer transitions
+type SlowConsumerMetrics interface {
+	SlowConsumer(slow bool)
+}
+
+//slowCause is what can keep a consumer behind, each is tracked over its own window
+type slowCause int
+
+const (
+	//slowHandlers is handlers running over Configuration.SlowHandlerThreshold
+	slowHandlers slowCause = iota
+	//slowBuffer is deliveries finding the DeliveryBuffer full
+	slowBuffer
+)
+
+type slowDetector struct {
+	sync.Mutex
+	//since is when each cause started holding, zero while it doesn't
+	since [2]time.Time
+	slow  bool
+}
+
+//observeSlow tracks handler durations against Configuration.SlowHandlerThreshold, reporting the consumer slow once every handler over a whole window exceeded it
+func (q *Queue) observeSlow(d time.Duration) {
+	cfg := q.config()
+	q.detectSlow(slowHandlers, d > cfg.SlowHandlerThreshold, d.String(), F("threshold", cfg.SlowHandlerThreshold), F("last_duration", d))
+}
+
+//observeBuffer tracks whether deliveries of the consumer tag find the DeliveryBuffer full, reporting the consumer slow once every delivery over a whole window did
+func (q *Queue) observeBuffer(tag string, full bool) {
+	q.detectSlow(slowBuffer, full, "delivery buffer full", F("consumer", tag), F("buffer", q.config().DeliveryBuffer))
+}
+
+//detectSlow reports the consumer slow once cause held for a whole window and recovered once no cause holds anymore, reason and fields describe the last observation
+func (q *Queue) detectSlow(cause slowCause, holds bool, reason string, fields ...Field) {
+	cfg := q.config()
+	window := cfg.SlowConsumerWindow
+	if window == 0 {
+		window = DefaultSlowConsumerWindow
+	}
+	now := q.Clock().Now()
+	s := &q.slowDetector
+	s.Lock()
+	changed := false
+	if holds {
+		if s.since[cause].IsZero() {
+			s.since[cause] = now
+		}
+		if !s.slow && now.Sub(s.since[cause]) >= window {
+			s.slow, changed = true, true
+		}
+	} else {
+		s.since[cause] = time.Time{}
+		if s.slow && s.since == [2]time.Time{} {
+			s.slow, changed = false, true
+		}
+	}
+	slow := s.slow
+	s.Unlock()
+
+	if !changed {
+		return
+	}
+	if sm, ok := q.metrics().(SlowConsumerMetrics); ok {
+		sm.SlowConsumer(slow)
+	}
+	fields = append([]Field{F("queue", cfg.RoutingKey)}, fields...)
+	if slow {
+		q.logger().Warn("Slow consumer", append(fields, F("window", window))...)
+		q.record(Event{Type: EventSlowConsumer, Reason: reason})
+		return
+	}
+	q.logger().Info("Consumer recovered", fields...)
+	q.record(Event{Type: EventSlowConsumerRecovered, Reason: reason})
+}
@@ -0,0 +1,18 @@
+package amqphelper
+
+import amqp "github.com/rabbitmq/amqp091-go"
+
+//stamp fills AppId from Configuration.AppID and a MessageId from Configuration.MessageIDGenerator (UUIDv4 by default) on messages that don't carry them, every publish is already timestamped
+func (q *Queue) stamp(msg *amqp.Publishing) {
+	cfg := q.config()
+	if msg.AppId == "" {
+		msg.AppId = cfg.AppID
+	}
+	if msg.MessageId == "" {
+		gen := cfg.MessageIDGenerator
+		if gen == nil {
+			gen = UUIDv4
+		}
+		msg.MessageId = gen(msg)
+	}
+}
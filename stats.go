@@ -0,0 +1,216 @@
+package amqphelper
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//QueueStats is a snapshot of a queue's cumulative counters. Nacked counts nacks and rejects without requeue and Requeued those with it, InFlight counts deliveries whose handler is running and Reconnects the recoveries attempted. ReconnectFailures those that failed. SinceConnected is the time since the last successful connection and LastDisconnect the last close reported by the broker or client library, nil if there was none. Depth, ConsumeRate in messages per second and TimeToDrain, NotDraining while nothing is consumed, are filled by MonitorLag and Prefetch, the prefetch count in effect, by TunePrefetch
+type QueueStats struct {
+	Published         int64
+	PublishErrors     int64
+	Confirmed         int64
+	ConfirmNacks      int64
+	Returned          int64
+	Consumed          int64
+	Acked             int64
+	Nacked            int64
+	Requeued          int64
+	InFlight          int64
+	Reconnects        int64
+	ReconnectFailures int64
+	SinceConnected    time.Duration
+	LastDisconnect    *Disconnect
+	Depth             int64
+	ConsumeRate       float64
+	TimeToDrain       time.Duration
+	Prefetch          int
+}
+
+//queueStats counts with atomics so the publish and consume paths never wait on each other for Stats, the mutex only guards the values set together or on connection changes
+type queueStats struct {
+	published         atomic.Int64
+	publishErrors     atomic.Int64
+	confirmed         atomic.Int64
+	confirmNacks      atomic.Int64
+	returned          atomic.Int64
+	consumed          atomic.Int64
+	acked             atomic.Int64
+	nacked            atomic.Int64
+	requeued          atomic.Int64
+	inFlight          atomic.Int64
+	reconnectFailures atomic.Int64
+	handled           atomic.Int64
+	handlerNanos      atomic.Int64
+	prefetch          atomic.Int64
+
+	sync.Mutex
+	connectedAt    time.Time
+	lastDisconnect *Disconnect
+	depth          int64
+	consumeRate    float64
+	timeToDrain    time.Duration
+}
+
+//Disconnect describes a connection or channel being closed
+type Disconnect struct {
+	Time    time.Time `json:"time"`
+	Channel bool      `json:"channel"`
+	Code    int       `json:"code"`
+	Reason  string    `json:"reason"`
+}
+
+func (s *queueStats) connected(now time.Time) {
+	s.Lock()
+	s.connectedAt = now
+	s.Unlock()
+}
+
+func (s *queueStats) disconnected(now time.Time, channel bool, err *amqp.Error) {
+	d := &Disconnect{Time: now, Channel: channel}
+	if err != nil {
+		d.Code, d.Reason = err.Code, err.Reason
+	}
+	s.Lock()
+	s.lastDisconnect = d
+	s.Unlock()
+}
+
+//Stats returns a snapshot of the queue's counters, each is read atomically but not all at once, so one taken while messages flow may count an operation in one counter and not yet in a related one
+func (q *Queue) Stats() QueueStats {
+	s := &q.stats
+	s.Lock()
+	defer s.Unlock()
+	var since time.Duration
+	if !s.connectedAt.IsZero() {
+		since = q.Clock().Now().Sub(s.connectedAt)
+	}
+	return QueueStats{
+		Published:         s.published.Load(),
+		PublishErrors:     s.publishErrors.Load(),
+		Confirmed:         s.confirmed.Load(),
+		ConfirmNacks:      s.confirmNacks.Load(),
+		Returned:          s.returned.Load(),
+		Consumed:          s.consumed.Load(),
+		Acked:             s.acked.Load(),
+		Nacked:            s.nacked.Load(),
+		Requeued:          s.requeued.Load(),
+		InFlight:          s.inFlight.Load(),
+		Reconnects:        q.reconnectCount(),
+		ReconnectFailures: s.reconnectFailures.Load(),
+		SinceConnected:    since,
+		LastDisconnect:    s.lastDisconnect,
+		Depth:             s.depth,
+		ConsumeRate:       s.consumeRate,
+		TimeToDrain:       s.timeToDrain,
+		Prefetch:          int(s.prefetch.Load()),
+	}
+}
+
+//queueMetrics updates the queue's Stats counters and forwards every event to Configuration.Metrics
+type queueMetrics struct {
+	q *Queue
+}
+
+func (m queueMetrics) next() Metrics {
+	return m.q.config().Metrics
+}
+
+func (m queueMetrics) Published(err error) {
+	if err != nil {
+		m.q.stats.publishErrors.Add(1)
+	} else {
+		m.q.stats.published.Add(1)
+	}
+	if n := m.next(); n != nil {
+		n.Published(err)
+	}
+}
+
+func (m queueMetrics) Confirmed(ack bool) {
+	if ack {
+		m.q.stats.confirmed.Add(1)
+	} else {
+		m.q.stats.confirmNacks.Add(1)
+	}
+	if n := m.next(); n != nil {
+		n.Confirmed(ack)
+	}
+}
+
+func (m queueMetrics) Returned() {
+	m.q.stats.returned.Add(1)
+	if n := m.next(); n != nil {
+		n.Returned()
+	}
+}
+
+func (m queueMetrics) Consumed() {
+	m.q.stats.consumed.Add(1)
+	if n := m.next(); n != nil {
+		n.Consumed()
+	}
+}
+
+func (m queueMetrics) Acked() {
+	m.q.stats.acked.Add(1)
+	if n := m.next(); n != nil {
+		n.Acked()
+	}
+}
+
+func (m queueMetrics) Nacked(requeue bool) {
+	if requeue {
+		m.q.stats.requeued.Add(1)
+	} else {
+		m.q.stats.nacked.Add(1)
+	}
+	if n := m.next(); n != nil {
+		n.Nacked(requeue)
+	}
+}
+
+func (m queueMetrics) HandlerDuration(d time.Duration) {
+	if n := m.next(); n != nil {
+		n.HandlerDuration(d)
+	}
+}
+
+func (m queueMetrics) Reconnected() {
+	if n := m.next(); n != nil {
+		n.Reconnected()
+	}
+}
+
+func (m queueMetrics) ConnectionState(connected bool) {
+	if n := m.next(); n != nil {
+		n.ConnectionState(connected)
+	}
+}
+
+func (m queueMetrics) BrokerLatency(d time.Duration) {
+	if bm, ok := m.next().(BrokerMetrics); ok {
+		bm.BrokerLatency(d)
+	}
+}
+
+func (m queueMetrics) HeartbeatMissed() {
+	if bm, ok := m.next().(BrokerMetrics); ok {
+		bm.HeartbeatMissed()
+	}
+}
+
+func (m queueMetrics) Lag(depth int, consumeRate float64, timeToDrain time.Duration) {
+	if lm, ok := m.next().(LagMetrics); ok {
+		lm.Lag(depth, consumeRate, timeToDrain)
+	}
+}
+
+func (m queueMetrics) SlowConsumer(slow bool) {
+	if sm, ok := m.next().(SlowConsumerMetrics); ok {
+		sm.SlowConsumer(slow)
+	}
+}
@@ -0,0 +1,50 @@
+package amqphelper
+
+import (
+	"testing"
+	"time"
+)
+
+type noopMetrics struct{}
+
+func (noopMetrics) Published(err error)             {}
+func (noopMetrics) Confirmed(ack bool)              {}
+func (noopMetrics) Returned()                       {}
+func (noopMetrics) Consumed()                       {}
+func (noopMetrics) Acked()                          {}
+func (noopMetrics) Nacked(requeue bool)             {}
+func (noopMetrics) HandlerDuration(d time.Duration) {}
+func (noopMetrics) Reconnected()                    {}
+func (noopMetrics) ConnectionState(connected bool)  {}
+
+//roundTrip records what a message published with confirms and then consumed and acked goes through
+func roundTrip(m Metrics) {
+	m.Published(nil)
+	m.Confirmed(true)
+	m.Consumed()
+	m.HandlerDuration(time.Millisecond)
+	m.Acked()
+}
+
+//BenchmarkQueueMetrics compares the events of a message sent to a no-op Metrics directly and through the queue's Stats counters. The difference is what Stats adds to each message, to stay under 2% of a confirmed publish to a broker, see BenchmarkPublish in testkit
+func BenchmarkQueueMetrics(b *testing.B) {
+	var direct Metrics = noopMetrics{}
+	b.Run("direct", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			roundTrip(direct)
+		}
+	})
+	q := newQueue(&Configuration{Metrics: noopMetrics{}})
+	b.Run("stats", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			roundTrip(q.metrics())
+		}
+	})
+	b.Run("stats-parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				roundTrip(q.metrics())
+			}
+		})
+	})
+}
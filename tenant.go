@@ -0,0 +1,211 @@
+package amqphelper
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+//ErrTenantLimit is returned by TenantManager.Queue when a tenant already has as many queues as its limits allow
+var ErrTenantLimit = fmt.Errorf("Tenant queue limit reached")
+
+//TenantLimits bounds what a tenant may open through a TenantManager, zero values don't limit
+type TenantLimits struct {
+	MaxQueues int
+	//PrefetchCount replaces the base configuration's for the tenant's queues
+	PrefetchCount int
+}
+
+//TenantManager lazily opens one Connection per tenant, to the tenant's vhost on the base configuration's broker, and caches the queues opened on it. When MaxTenants connections are open the least recently used tenant is evicted, closing its connection and queues
+type TenantManager struct {
+	//Base is the configuration of every tenant queue, Host's vhost and RoutingKey are replaced
+	Base       *Configuration
+	MaxTenants int
+	//Limits holds per tenant limits, tenants without an entry get DefaultLimits
+	Limits        map[string]TenantLimits
+	DefaultLimits TenantLimits
+	//VHost maps a tenant to its vhost, the tenant name is used when it is nil
+	VHost func(tenant string) string
+
+	mu      sync.Mutex
+	tenants map[string]*list.Element
+	lru     list.List
+}
+
+//tenantEntry is added while its connection is dialed, ready is closed once conn or err is set. Both are guarded by the manager's lock until then, queues by mu so declaring a queue only blocks the tenant's other calls
+type tenantEntry struct {
+	tenant  string
+	ready   chan struct{}
+	conn    *Connection
+	err     error
+	evicted bool
+	mu      sync.Mutex
+	queues  map[string]*Queue
+	opened  atomic.Int32
+}
+
+//NewTenantManager returns a TenantManager over base keeping at most maxTenants connections, 0 keeps them all
+func NewTenantManager(base *Configuration, maxTenants int) *TenantManager {
+	return &TenantManager{Base: base, MaxTenants: maxTenants}
+}
+
+func (m *TenantManager) limits(tenant string) TenantLimits {
+	if l, ok := m.Limits[tenant]; ok {
+		return l
+	}
+	return m.DefaultLimits
+}
+
+//tenantHost returns the base host with the tenant's vhost as its path
+func (m *TenantManager) tenantHost(tenant string) (string, error) {
+	u, err := url.Parse(m.Base.Host)
+	if err != nil {
+		return "", RedactError(err, m.Base.Host)
+	}
+	vhost := tenant
+	if m.VHost != nil {
+		vhost = m.VHost(tenant)
+	}
+	u.Path, u.RawPath = "/"+vhost, "/"+url.PathEscape(vhost)
+	return u.String(), nil
+}
+
+//Queue returns the tenant's queue named queue, connecting to the tenant's vhost and declaring the queue on first use. It returns ErrTenantLimit when that would exceed the tenant's MaxQueues. The connection is dialed without holding up other tenants, concurrent calls for a tenant wait for the first one's dial and share its outcome, a failed dial is retried by the next call
+func (m *TenantManager) Queue(ctx context.Context, tenant, queue string) (*Queue, error) {
+	m.mu.Lock()
+	if m.tenants == nil {
+		m.tenants = map[string]*list.Element{}
+	}
+	el, ok := m.tenants[tenant]
+	if ok {
+		m.lru.MoveToFront(el)
+		m.mu.Unlock()
+	} else {
+		host, err := m.tenantHost(tenant)
+		if err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		el = m.lru.PushFront(&tenantEntry{tenant: tenant, ready: make(chan struct{}), queues: map[string]*Queue{}})
+		m.tenants[tenant] = el
+		m.evict()
+		m.mu.Unlock()
+		m.dial(ctx, el, host)
+	}
+	e := el.Value.(*tenantEntry)
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if q, ok := e.queues[queue]; ok {
+		return q, nil
+	}
+	limits := m.limits(tenant)
+	if limits.MaxQueues > 0 && len(e.queues) >= limits.MaxQueues {
+		return nil, ErrTenantLimit
+	}
+	cfg := *m.Base
+	cfg.RoutingKey = queue
+	if limits.PrefetchCount > 0 {
+		cfg.PrefetchCount = limits.PrefetchCount
+	}
+	q, err := e.conn.open(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	e.queues[queue] = q
+	e.opened.Add(1)
+	return q, nil
+}
+
+//dial connects the entry of el to host and makes it ready, forgetting it when that fails and closing the connection when the tenant was evicted meanwhile
+func (m *TenantManager) dial(ctx context.Context, el *list.Element, host string) {
+	e := el.Value.(*tenantEntry)
+	conn, err := DialContext(ctx, host, WithTLS(m.Base.TLSConfig), WithHeartbeat(m.Base.Heartbeat), WithLogger(m.Base.Logger), WithClock(m.Base.Clock))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err != nil:
+		if m.tenants[e.tenant] == el {
+			m.lru.Remove(el)
+			delete(m.tenants, e.tenant)
+		}
+	case e.evicted:
+		conn.Close()
+		err = fmt.Errorf("Tenant %s was evicted while connecting", e.tenant)
+	}
+	e.conn, e.err = conn, err
+	close(e.ready)
+}
+
+//close closes the entry's connection, or has dial close it once connected, it must be called with the lock held
+func (e *tenantEntry) close() error {
+	e.evicted = true
+	if e.conn == nil {
+		return nil
+	}
+	return e.conn.Close()
+}
+
+//evict closes least recently used tenants over MaxTenants, it must be called with the lock held
+func (m *TenantManager) evict() {
+	for m.MaxTenants > 0 && m.lru.Len() > m.MaxTenants {
+		e := m.lru.Remove(m.lru.Back()).(*tenantEntry)
+		delete(m.tenants, e.tenant)
+		if m.Base.Logger != nil {
+			m.Base.Logger.Info("Evicting tenant", F("tenant", e.tenant), F("queues", e.opened.Load()))
+		}
+		e.close()
+	}
+}
+
+//Evict closes the tenant's connection and forgets its queues, the next Queue call reconnects
+func (m *TenantManager) Evict(tenant string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.tenants[tenant]
+	if !ok {
+		return nil
+	}
+	m.lru.Remove(el)
+	delete(m.tenants, tenant)
+	return el.Value.(*tenantEntry).close()
+}
+
+//Tenants returns the tenants with an open connection, sorted by name
+func (m *TenantManager) Tenants() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenants := make([]string, 0, len(m.tenants))
+	for t := range m.tenants {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+//Close closes every tenant connection, returning the first error
+func (m *TenantManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var err error
+	for t, el := range m.tenants {
+		if cerr := el.Value.(*tenantEntry).close(); err == nil {
+			err = cerr
+		}
+		delete(m.tenants, t)
+	}
+	m.lru.Init()
+	return err
+}
@@ -0,0 +1,138 @@
+package testkit_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+	"github.com/ermyuriel/amqphelper/testkit"
+	"github.com/testcontainers/testcontainers-go/modules/rabbitmq"
+)
+
+//targetRate is the publish throughput, in messages per second with confirms, the benchmarks are measured against
+const targetRate = 50000
+
+var (
+	brokerOnce sync.Once
+	brokerURL  string
+	brokerErr  error
+	container  *rabbitmq.RabbitMQContainer
+)
+
+//TestMain terminates the broker the benchmarks share, started by the first one that needs it
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if container != nil {
+		container.Terminate(context.Background())
+	}
+	os.Exit(code)
+}
+
+//benchQueue connects to a queue of its own on the shared broker, skipping the benchmark without Docker
+func benchQueue(b *testing.B, configure func(c *amqphelper.Configuration)) *amqphelper.Queue {
+	b.Helper()
+	brokerOnce.Do(func() {
+		//testcontainers panics when it finds no Docker
+		defer func() {
+			if r := recover(); r != nil {
+				brokerErr = fmt.Errorf("%v", r)
+			}
+		}()
+		ctx := context.Background()
+		if container, brokerErr = rabbitmq.Run(ctx, testkit.DefaultImage); brokerErr == nil {
+			brokerURL, brokerErr = container.AmqpURL(ctx)
+		}
+	})
+	if brokerErr != nil {
+		b.Skipf("RabbitMQ is not available: %v", brokerErr)
+	}
+	c := &amqphelper.Configuration{Host: brokerURL, RoutingKey: fmt.Sprintf("%s-%d", b.Name(), time.Now().UnixNano()), ConfirmPublishes: true, DeleteIfUnused: true}
+	if configure != nil {
+		configure(c)
+	}
+	q, err := amqphelper.GetQueue(c)
+	if err != nil {
+		b.Fatalf("Could not connect to %s: %v", c.RoutingKey, err)
+	}
+	b.Cleanup(func() { q.Close() })
+	return q
+}
+
+//reportRate reports the messages published per second and logs when it is under targetRate
+func reportRate(b *testing.B, start time.Time) {
+	rate := float64(b.N) / time.Since(start).Seconds()
+	b.ReportMetric(rate, "msgs/s")
+	if b.N >= 1000 && rate < targetRate {
+		b.Logf("%.0f msgs/s is under the %d msgs/s target", rate, targetRate)
+	}
+}
+
+var benchBody = make([]byte, 256)
+
+//BenchmarkPublish publishes one message at a time, each waiting for its confirmation
+func BenchmarkPublish(b *testing.B) {
+	q := benchQueue(b, nil)
+	ctx := context.Background()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		if err := q.PublishWithContext(ctx, benchBody, nil, false, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportRate(b, start)
+}
+
+//BenchmarkAsyncPublish enqueues every message and waits for all the confirmations, which are received a batch at a time
+func BenchmarkAsyncPublish(b *testing.B) {
+	q := benchQueue(b, nil)
+	ctx := context.Background()
+	results := make(chan (<-chan error), 1024)
+	failed := make(chan error, 1)
+	go func() {
+		defer close(failed)
+		for r := range results {
+			if err := <-r; err != nil {
+				failed <- err
+				for range results {
+				}
+				return
+			}
+		}
+	}()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		results <- q.AsyncPublish(ctx, benchBody, nil, false, false)
+	}
+	close(results)
+	if err := <-failed; err != nil {
+		b.Fatal(err)
+	}
+	reportRate(b, start)
+}
+
+//BenchmarkPublishParallel publishes from GOMAXPROCS goroutines, over the queue's channel and over pools of PublisherChannels
+func BenchmarkPublishParallel(b *testing.B) {
+	for _, n := range []int{0, 4, 16} {
+		b.Run(fmt.Sprintf("channels=%d", n), func(b *testing.B) {
+			q := benchQueue(b, func(c *amqphelper.Configuration) { c.PublisherChannels = n })
+			ctx := context.Background()
+			b.ResetTimer()
+			start := time.Now()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := q.PublishWithContext(ctx, benchBody, nil, false, false); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			reportRate(b, start)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+//Package testkit starts RabbitMQ in a container for integration tests, using testcontainers-go. It is a module of its own, so only the tests importing it depend on testcontainers and Docker
+package testkit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ermyuriel/amqphelper"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/rabbitmq"
+)
+
+//DefaultImage is the RabbitMQ image Start runs
+const DefaultImage = "rabbitmq:3.13-management-alpine"
+
+//Broker is a running RabbitMQ container
+type Broker struct {
+	Container *rabbitmq.RabbitMQContainer
+	//URL is the AMQP URL of the broker
+	URL string
+}
+
+//Start runs image, DefaultImage when empty, and terminates it when the test ends. The test fails when the container can't be started, for instance without Docker
+func Start(t testing.TB, image string, opts ...testcontainers.ContainerCustomizer) *Broker {
+	t.Helper()
+	if image == "" {
+		image = DefaultImage
+	}
+	ctx := context.Background()
+	c, err := rabbitmq.Run(ctx, image, opts...)
+	if err != nil {
+		t.Fatalf("Could not start RabbitMQ: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := c.Terminate(context.Background()); err != nil {
+			t.Logf("Could not terminate RabbitMQ: %v", err)
+		}
+	})
+	url, err := c.AmqpURL(ctx)
+	if err != nil {
+		t.Fatalf("Could not get the RabbitMQ URL: %v", err)
+	}
+	return &Broker{Container: c, URL: url}
+}
+
+//Config returns a Configuration for queue on the broker, with manual acks and confirms so tests observe what the broker did
+func (b *Broker) Config(queue string) *amqphelper.Configuration {
+	return &amqphelper.Configuration{Host: b.URL, RoutingKey: queue, ConfirmPublishes: true}
+}
+
+//Queue connects to queue with Config and closes it when the test ends
+func (b *Broker) Queue(t testing.TB, queue string) *amqphelper.Queue {
+	t.Helper()
+	return Connect(t, b.Config(queue))
+}
+
+//Connect connects with config and closes the queue when the test ends
+func Connect(t testing.TB, config *amqphelper.Configuration) *amqphelper.Queue {
+	t.Helper()
+	q, err := amqphelper.GetQueue(config)
+	if err != nil {
+		t.Fatalf("Could not connect to %s: %v", config.RoutingKey, err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+//pollInterval is how often WaitForMessage polls an empty queue
+const pollInterval = 10 * time.Millisecond
+
+//WaitForMessage polls q with basic.get until a message satisfying match arrives and returns it acked, failing the test after timeout. Messages that don't match are acked and skipped, a nil match takes the first message. It gets them on a connection of its own closed on return, so it never holds deliveries back from q's consumers
+func WaitForMessage(t testing.TB, q *amqphelper.Queue, match func(m *amqphelper.Message) bool, timeout time.Duration) *amqphelper.Message {
+	t.Helper()
+	cfg := q.Configuration()
+	conn, err := amqp.DialConfig(cfg.Host, amqp.Config{TLSClientConfig: cfg.TLSConfig})
+	if err != nil {
+		t.Fatalf("Could not connect to poll %s: %v", q.Name(), err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatalf("Could not open a channel to poll %s: %v", q.Name(), err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		d, ok, err := ch.Get(q.Name(), false)
+		if err != nil {
+			t.Fatalf("Could not get a message from %s: %v", q.Name(), err)
+		}
+		if ok {
+			d.Ack(false)
+			m := &amqphelper.Message{Delivery: &d}
+			if match == nil || match(m) {
+				return m
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("No matching message on %s within %s", q.Name(), timeout)
+			return nil
+		}
+		if !ok {
+			time.Sleep(pollInterval)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package amqphelper
+
+import (
+	"context"
+	"regexp"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	//TraceParentHeader is the W3C trace context traceparent header
+	TraceParentHeader = "traceparent"
+	//TraceStateHeader is the W3C trace context tracestate header
+	TraceStateHeader = "tracestate"
+)
+
+var traceParentPattern = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+//TraceContext holds W3C trace context values propagated through message headers
+type TraceContext struct {
+	TraceParent string
+	TraceState  string
+}
+
+//TraceID returns the trace id of TraceParent, empty when it isn't a valid traceparent
+func (tc TraceContext) TraceID() string {
+	if !traceParentPattern.MatchString(tc.TraceParent) {
+		return ""
+	}
+	return tc.TraceParent[3:35]
+}
+
+type traceContextKey struct{}
+
+//ContextWithTraceContext returns a copy of ctx carrying tc, it is injected into messages published with that context
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+//TraceContextFromContext returns the trace context carried by ctx
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+func injectTraceContext(ctx context.Context, msg *amqp.Publishing) {
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok || !traceParentPattern.MatchString(tc.TraceParent) {
+		return
+	}
+	//already injected, by PublishReuse into its own table
+	if msg.Headers[TraceParentHeader] == tc.TraceParent && (tc.TraceState == "" && msg.Headers[TraceStateHeader] == nil || msg.Headers[TraceStateHeader] == tc.TraceState) {
+		return
+	}
+	h := cloneTable(msg.Headers)
+	h[TraceParentHeader] = tc.TraceParent
+	if tc.TraceState != "" {
+		h[TraceStateHeader] = tc.TraceState
+	} else {
+		delete(h, TraceStateHeader)
+	}
+	msg.Headers = h
+}
+
+func extractTraceContext(ctx context.Context, headers amqp.Table) context.Context {
+	tp, _ := GetStringHeader(headers, TraceParentHeader)
+	if !traceParentPattern.MatchString(tp) {
+		return ctx
+	}
+	ts, _ := GetStringHeader(headers, TraceStateHeader)
+	return ContextWithTraceContext(ctx, TraceContext{TraceParent: tp, TraceState: ts})
+}
+
+//Context returns the context for processing the message, carrying the trace context extracted from its headers
+func (m *Message) Context() context.Context {
+	if m == nil || m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+//WithContext returns a shallow copy of the message using ctx, middleware can use it to pass values such as spans to the handler
+func (m *Message) WithContext(ctx context.Context) *Message {
+	c := *m
+	c.ctx = ctx
+	return &c
+}
@@ -0,0 +1,74 @@
+package amqphelper
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+//TypedQueue publishes and consumes values of type T through the queue's Codec
+type TypedQueue[T any] struct {
+	Queue *Queue
+}
+
+//NewTypedQueue returns a TypedQueue over q
+func NewTypedQueue[T any](q *Queue) *TypedQueue[T] {
+	return &TypedQueue[T]{Queue: q}
+}
+
+//Publish marshals v with the queue's Codec and publishes it, propagating the trace context carried by ctx
+func (t *TypedQueue[T]) Publish(ctx context.Context, v T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return t.Queue.publishObject(ctx, v, nil, false, false)
+}
+
+//Consume decodes each delivery into T and passes it to f until ctx is done. The context passed to f carries the trace context extracted from the message headers. Messages are acknowledged when f returns nil and rejected without requeue when it returns an error or decoding fails, so f must not acknowledge them itself
+func (t *TypedQueue[T]) Consume(ctx context.Context, f func(ctx context.Context, v T, m *Message) error) error {
+	q := t.Queue
+	cfg := q.config()
+	tag := fmt.Sprintf("typed:%v", time.Now().UnixNano())
+	msgs, err := q.GetConsumer(tag)
+	if err != nil {
+		return err
+	}
+
+	handle := q.wrap(func(m *Message) {
+		var v T
+		if err := m.Decode(&v); err != nil {
+			m.logger().Warn("Could not decode message", m.fields(F("error", err))...)
+			q.reportError(ErrorScopeDecode, err)
+			m.reject()
+			return
+		}
+		if err := f(m.Context(), v, m); err != nil {
+			m.logger().Error("Handler failed", m.fields(F("error", err))...)
+			q.reportError(ErrorScopeConsume, err)
+			m.reject()
+			return
+		}
+		if !cfg.AutoAcknowledgeMessages {
+			m.Ack(false)
+		}
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			q.channel.Cancel(tag, false)
+			for d := range msgs {
+				if !cfg.AutoAcknowledgeMessages {
+					d.Nack(false, true)
+				}
+			}
+			return ctx.Err()
+		case d, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			q.track(&d)
+			q.handle(handle, q.newMessage(ctx, d))
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package amqphelper
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+//FieldError describes a Configuration field that is invalid on its own or contradicts another one
+type FieldError struct {
+	Field   string
+	Problem string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Problem
+}
+
+//ValidationError lists every problem Configuration.Validate found
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	problems := make([]string, len(e))
+	for i, fe := range e {
+		problems[i] = fe.Error()
+	}
+	return fmt.Sprintf("Invalid configuration: %s", strings.Join(problems, "; "))
+}
+
+//Validate reports settings that are missing, out of range or contradict each other without connecting, as a ValidationError naming every bad field, or nil. With Strict it also reports settings that would be silently ignored
+func (c *Configuration) Validate() error {
+	var errs ValidationError
+	add := func(field, problem string, args ...interface{}) {
+		errs = append(errs, FieldError{field, fmt.Sprintf(problem, args...)})
+	}
+
+	if c.Host == "" {
+		add("Host", "is empty")
+	} else if u, err := url.Parse(c.Host); err != nil {
+		add("Host", "does not parse: %v", RedactError(err, c.Host))
+	} else if u.Scheme != "amqp" && u.Scheme != "amqps" {
+		add("Host", "has unsupported scheme %q", u.Scheme)
+	}
+
+	if c.PrefetchCount < 0 {
+		add("PrefetchCount", "is negative")
+	}
+	if c.PrefetchByteSize < 0 {
+		add("PrefetchByteSize", "is negative")
+	}
+	if c.Heartbeat < 0 {
+		add("Heartbeat", "is negative")
+	}
+	if c.DebugRateLimit < 0 {
+		add("DebugRateLimit", "is negative")
+	}
+	if c.NoWait && c.ConfirmPublishes {
+		add("NoWait", "hides declaration errors from ConfirmPublishes, which needs the broker's replies")
+	}
+	if c.ExchangeType != "" && c.Exchange == "" {
+		add("ExchangeType", "is set but the default exchange can't be declared, set Exchange")
+	}
+	if len(c.BindingKeys) > 0 && c.Exchange == "" {
+		add("BindingKeys", "are set without an Exchange to bind to")
+	}
+
+	if c.PublishOnly {
+		if len(c.BindingKeys) > 0 {
+			add("BindingKeys", "are ignored with PublishOnly")
+		}
+		if c.DeadLetterExchange != "" {
+			add("DeadLetterExchange", "is ignored with PublishOnly, no queue is declared")
+		}
+		if c.Exclusive || c.DeleteIfUnused {
+			add("PublishOnly", "no queue is declared, so Exclusive and DeleteIfUnused have no effect")
+		}
+	} else if c.Exclusive && c.Durable && c.RoutingKey != "" {
+		add("Exclusive", "contradicts Durable on the named queue %q, an exclusive queue is deleted with its connection and can't be shared", c.RoutingKey)
+	}
+
+	if c.AutoAcknowledgeMessages && c.DeadLetterExchange != "" {
+		add("AutoAcknowledgeMessages", "contradicts DeadLetterExchange, deliveries are settled on arrival so none are ever rejected or retried")
+	}
+	if c.DeadLetterExchange == "" {
+		if c.DeadLetterRoutingKey != "" {
+			add("DeadLetterRoutingKey", "is set without a DeadLetterExchange")
+		}
+		if c.DeadLetterQueue != "" {
+			add("DeadLetterQueue", "is set without a DeadLetterExchange")
+		}
+		if c.DeadLetterRateLimit > 0 {
+			add("DeadLetterRateLimit", "is set without a DeadLetterExchange")
+		}
+	}
+	if c.DeadLetterRateLimit < 0 {
+		add("DeadLetterRateLimit", "is negative")
+	}
+	if c.MaxLatencyKeys < 0 {
+		add("MaxLatencyKeys", "is negative")
+	}
+	if c.SlowHandlerThreshold < 0 {
+		add("SlowHandlerThreshold", "is negative")
+	}
+	if c.SlowConsumerWindow != 0 && c.SlowHandlerThreshold == 0 && c.DeliveryBuffer == 0 {
+		add("SlowConsumerWindow", "is set without a SlowHandlerThreshold or a DeliveryBuffer")
+	}
+	if c.BlobStore == nil && c.ClaimCheckThreshold != 0 {
+		add("ClaimCheckThreshold", "is set without a BlobStore")
+	}
+	if c.ClaimCheckThreshold < 0 {
+		add("ClaimCheckThreshold", "is negative")
+	}
+	if c.DeliveryBuffer < 0 {
+		add("DeliveryBuffer", "is negative")
+	}
+	if c.Backpressure != BackpressureBlock && c.Backpressure != BackpressurePause {
+		add("Backpressure", "is unknown policy %d", int(c.Backpressure))
+	}
+	if c.MaxConcurrentHandlers < 0 {
+		add("MaxConcurrentHandlers", "is negative")
+	}
+	if c.AckBatchSize < 0 {
+		add("AckBatchSize", "is negative")
+	}
+	if c.AckBatchInterval < 0 {
+		add("AckBatchInterval", "is negative")
+	}
+	if c.PrefetchCount > 0 && c.AckBatchSize > c.PrefetchCount {
+		add("AckBatchSize", "exceeds PrefetchCount, the broker would stop delivering before a batch is complete")
+	}
+	if c.AutoAcknowledgeMessages && (c.AckBatchSize != 0 || c.AckBatchInterval != 0) {
+		add("AckBatchSize", "is set with AutoAcknowledgeMessages, there is nothing to acknowledge")
+	}
+	if c.PublisherChannels < 0 {
+		add("PublisherChannels", "is negative")
+	}
+	if c.AsyncBatchWindow < 0 {
+		add("AsyncBatchWindow", "is negative")
+	}
+	if c.AsyncPublishBuffer < 0 {
+		add("AsyncPublishBuffer", "is negative")
+	}
+
+	if c.Strict {
+		errs = append(errs, c.strictProblems()...)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+//strictProblems reports settings that are accepted but silently ignored, or that RabbitMQ doesn't honor
+func (c *Configuration) strictProblems() []FieldError {
+	var errs []FieldError
+	add := func(field, problem string) {
+		errs = append(errs, FieldError{field, problem})
+	}
+	if c.NoLocal {
+		add("NoLocal", "is not supported by RabbitMQ, which ignores it")
+	}
+	if c.PrefetchByteSize != 0 {
+		add("PrefetchByteSize", "is not implemented by RabbitMQ")
+	}
+	if c.PublishOnly && c.Exchange != "" && c.ExchangeType == "" {
+		add("Exchange", "is never declared or bound with PublishOnly and no ExchangeType, it must already exist")
+	}
+	if c.PublishOnly && (c.Durable || c.PrefetchCount != 0 || c.AutoAcknowledgeMessages) {
+		add("PublishOnly", "no queue is declared or consumed, so Durable, PrefetchCount and AutoAcknowledgeMessages have no effect")
+	}
+	if c.Backpressure != BackpressureBlock && c.DeliveryBuffer == 0 {
+		add("Backpressure", "is set without a DeliveryBuffer")
+	}
+	if c.ReuseMessages && c.CopyBodies {
+		add("ReuseMessages", "is ignored with CopyBodies, whose bodies are meant to outlive the handler")
+	}
+	if c.DebugRateLimit != 0 && !c.Debug {
+		add("DebugRateLimit", "is set without Debug")
+	}
+	if c.ContentEncoding != "" && c.ContentType == "" {
+		add("ContentEncoding", "is set without a ContentType")
+	}
+	if c.DeadLetterRateWindow != 0 && c.DeadLetterRateLimit == 0 {
+		add("DeadLetterRateWindow", "is set without a DeadLetterRateLimit")
+	}
+	if c.EventJournalSize < 0 {
+		add("EventJournalSize", "is negative")
+	}
+	if c.ConfirmTimeout != 0 && !c.ConfirmPublishes {
+		add("ConfirmTimeout", "is set without ConfirmPublishes")
+	}
+	return errs
+}
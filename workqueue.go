@@ -0,0 +1,58 @@
+package amqphelper
+
+//RetryCountHeader counts how many times a message was published again after its handler failed
+const RetryCountHeader = "x-retry-count"
+
+//RetryPolicy bounds how often a failed message is retried
+type RetryPolicy struct {
+	//MaxRetries is how many times a message is published again after a failure before it is rejected, 0 rejects it on the first failure
+	MaxRetries int
+}
+
+//WorkQueue is a queue of tasks shared by competing consumers: durable, persistent, manually acknowledged and dispatched fairly by prefetch
+type WorkQueue struct {
+	*Queue
+	Retry RetryPolicy
+}
+
+//NewWorkQueue connects with a copy of config made durable, persistent and manually acknowledged, with a prefetch of prefetch messages per consumer (at least 1, so a busy worker isn't handed more tasks). Set config.DeadLetterExchange to keep tasks that run out of retries
+func NewWorkQueue(config *Configuration, prefetch int, retry RetryPolicy) (*WorkQueue, error) {
+	c := *config
+	c.Durable, c.PersistentMessages, c.AutoAcknowledgeMessages = true, true, false
+	if prefetch < 1 {
+		prefetch = 1
+	}
+	c.PrefetchCount = prefetch
+	q, err := GetQueue(&c)
+	if err != nil {
+		return nil, err
+	}
+	return &WorkQueue{Queue: q, Retry: retry}, nil
+}
+
+//Work spawns n workers running f on each task. Tasks are acked when f succeeds, when it fails they are published again to the back of the queue with RetryCountHeader incremented until Retry.MaxRetries is reached and rejected after that
+func (w *WorkQueue) Work(workers int, f func(m *Message) error) error {
+	return w.SpawnWorkers("worker", workers, func(m *Message) {
+		err := f(m)
+		if err == nil {
+			m.Ack(false)
+			return
+		}
+
+		n, _ := GetIntHeader(m.HeaderTable(), RetryCountHeader)
+		if int(n) >= w.Retry.MaxRetries {
+			m.logger().Warn("Task failed, giving up", m.fields(F("error", err), F("retries", n))...)
+			m.Reject(false)
+			return
+		}
+		m.logger().Info("Task failed, retrying", m.fields(F("error", err), F("retries", n))...)
+		msg := m.republishing()
+		msg.Headers[RetryCountHeader] = int32(n + 1)
+		if perr := w.PublishTo(m.Context(), "", w.Name(), msg, false, false); perr != nil {
+			m.logger().Error("Could not retry task", m.fields(F("error", perr))...)
+			m.Nack(false, true)
+			return
+		}
+		m.Ack(false)
+	})
+}